@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/voocel/mas/agent"
+	"github.com/voocel/mas/llm"
 	"github.com/voocel/mas/orchestrator"
+	"github.com/voocel/mas/tools"
 )
 
 // Agency represents a group of collaborating agents and their workflows
@@ -30,6 +32,9 @@ type Agency struct {
 	// Shared instructions
 	SharedInstructions string
 
+	// Whether AddAgent gives agents the messaging tools
+	messagingTools bool
+
 	// Mutex, protects shared state
 	mu sync.RWMutex
 }
@@ -53,6 +58,10 @@ type Config struct {
 
 	// Maximum tokens to generate
 	MaxTokens int
+
+	// MessagingTools makes AddAgent give every agent that accepts tools a send_message and a
+	// get_available_recipients tool, limited to the recipients the FlowChart allows
+	MessagingTools bool
 }
 
 // New creates a new Agency
@@ -63,6 +72,7 @@ func New(config Config) *Agency {
 		FlowChart:          NewFlowChart(),
 		SharedState:        make(map[string]interface{}),
 		SharedInstructions: config.SharedInstructions,
+		messagingTools:     config.MessagingTools,
 	}
 
 	// Use provided orchestrator or create a default one
@@ -85,6 +95,11 @@ func (a *Agency) AddAgent(agent agent.Agent) error {
 		return fmt.Errorf("agent with ID %s already exists", agentID)
 	}
 
+	// Inject before the agent is published, so no run can start without its tools
+	if a.messagingTools {
+		a.addMessagingTools(agent)
+	}
+
 	a.Agents[agentID] = agent
 
 	// Also register with the orchestrator
@@ -97,6 +112,33 @@ func (a *Agency) AddAgent(agent agent.Agent) error {
 	return nil
 }
 
+// addMessagingTools gives an agent the tools to message the others. The FlowChart is
+// consulted on every call, so it may be defined after the agents are added.
+func (a *Agency) addMessagingTools(ag agent.Agent) {
+	adder, ok := ag.(interface{ AddTools(...tools.Tool) })
+	if !ok {
+		return
+	}
+
+	var missing []tools.Tool
+	for _, tool := range []tools.Tool{NewSendMessageTool(a, ag), NewGetAvailableRecipientsTool(a, ag)} {
+		if !hasTool(ag, tool.Name()) {
+			missing = append(missing, tool)
+		}
+	}
+	adder.AddTools(missing...)
+}
+
+// hasTool reports whether an agent already has a tool with the given name
+func hasTool(ag agent.Agent, name string) bool {
+	for _, tool := range ag.GetTools() {
+		if tool.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAgent gets an agent by specified ID
 func (a *Agency) GetAgent(id string) (agent.Agent, error) {
 	a.mu.RLock()
@@ -123,6 +165,13 @@ func (a *Agency) ListAgents() []agent.Agent {
 	return agents
 }
 
+// flowChart returns the current communication flow chart
+func (a *Agency) flowChart() *FlowChart {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.FlowChart
+}
+
 // SetFlowChart sets the communication flow chart
 func (a *Agency) SetFlowChart(flowChart *FlowChart) {
 	a.mu.Lock()
@@ -170,6 +219,7 @@ func (a *Agency) Execute(ctx context.Context, input string) (string, error) {
 		Description: fmt.Sprintf("Process input via %s", entryAgentID),
 		AgentIDs:    []string{entryAgentID},
 		Input:       input,
+		Metadata:    map[string]interface{}{llm.TagAgency: a.Name},
 	}
 
 	// Submit task to orchestrator
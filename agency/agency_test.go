@@ -2,9 +2,15 @@ package agency
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
-	"github.com/voocel/mas/agent"
+	"time"
 
+	"github.com/voocel/mas/agent"
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
 )
 
 /**
@@ -102,3 +108,152 @@ func TestAgency_RegisterWorkflow_NotImplemented(t *testing.T) {
 		t.Errorf("expected not implemented error, got %v", err)
 	}
 }
+
+func TestAgency_Execute_ScriptedLLMAgent(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptRule{
+		Match:    llm.MatchAnyMessageContains("fjords"),
+		Response: llm.TextResponse("Fjords are glacial valleys flooded by the sea."),
+	})
+	ag := New(Config{Name: "TestAgency"})
+	ag.Orchestrator.Start()
+	defer ag.Orchestrator.Stop()
+
+	researcher := agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Researcher", Provider: provider})
+	if err := ag.AddAgent(researcher); err != nil {
+		t.Fatalf("failed to add agent: %v", err)
+	}
+	if err := ag.DefineFlowChart([]Flow{{researcher}}); err != nil {
+		t.Fatalf("failed to define flow chart: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := ag.Execute(ctx, "tell me about fjords")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "Fjords are glacial valleys flooded by the sea." {
+		t.Errorf("unexpected result: %q", result)
+	}
+}
+
+func TestAgency_Execute_RecordsUsage(t *testing.T) {
+	resp := llm.TextResponse("Fjords are deep.")
+	resp.Model = "gpt-4o-mini"
+	resp.Usage = llm.Usage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}
+
+	ledger := llm.NewLedger()
+	provider := llm.Wrap(llm.NewScriptedProvider(llm.ScriptRule{Response: resp}), ledger.Middleware())
+
+	ag := New(Config{Name: "Billing"})
+	ag.Orchestrator.Start()
+	defer ag.Orchestrator.Stop()
+
+	researcher := agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Researcher", Provider: provider})
+	ag.AddAgent(researcher)
+	ag.DefineFlowChart([]Flow{{researcher}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := ag.Execute(ctx, "fjords"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries := ledger.Entries(llm.UsageFilter{Agency: "Billing"})
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 usage entry for the agency, got %d", len(entries))
+	}
+	if entries[0].Agent != "Researcher" || entries[0].TaskID == "" {
+		t.Errorf("expected agent and task tags, got %+v", entries[0])
+	}
+	if entries[0].Cost <= 0 {
+		t.Errorf("expected a priced entry, got %+v", entries[0])
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	type summary struct {
+		Title string `json:"title"`
+		Words int    `json:"words"`
+	}
+	process := JSONOutput[summary]()
+
+	out, err := process(context.Background(), "```json\n{\"title\":\"Fjords\",\"words\":120}\n```")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := out.(summary); !ok || got.Title != "Fjords" || got.Words != 120 {
+		t.Errorf("unexpected output: %#v", out)
+	}
+
+	if _, err := process(context.Background(), `{"title":"Fjords"}`); !errors.Is(err, llm.ErrResponseInvalid) {
+		t.Errorf("expected ErrResponseInvalid for output missing a field, got %v", err)
+	}
+}
+
+func TestAgency_MessagingToolsFollowFlowChart(t *testing.T) {
+	send := llm.ToolCall{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "send_message", Arguments: `{"recipient":"Writer","content":"Write a haiku about fjords","wait_reply":true}`}}
+	managerProvider := llm.NewSequenceProvider(llm.ToolCallResponse(send), llm.TextResponse("Here is the haiku."))
+	writerProvider := llm.NewScriptedProvider(llm.ScriptRule{Response: llm.TextResponse("Deep blue water sleeps")})
+
+	ag := New(Config{Name: "Studio", MessagingTools: true})
+	ag.Orchestrator.Start()
+	defer ag.Orchestrator.Stop()
+
+	manager := agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Manager", Provider: managerProvider})
+	writer := agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Writer", Description: "Writes poems.", Provider: writerProvider})
+	for _, member := range []agent.Agent{manager, writer} {
+		if err := ag.AddAgent(member); err != nil {
+			t.Fatalf("failed to add %s: %v", member.Name(), err)
+		}
+	}
+	if err := ag.DefineFlowChart([]Flow{{manager}, {manager, writer}}); err != nil {
+		t.Fatalf("failed to define flow chart: %v", err)
+	}
+
+	if len(manager.GetTools()) != 2 {
+		t.Fatalf("expected the messaging tools to be injected, got %d tools", len(manager.GetTools()))
+	}
+	toolNamed := func(a agent.Agent, name string) tools.Tool {
+		for _, tool := range a.GetTools() {
+			if tool.Name() == name {
+				return tool
+			}
+		}
+		t.Fatalf("%s has no %s tool", a.Name(), name)
+		return nil
+	}
+	var schema struct {
+		Properties struct {
+			Recipient struct {
+				Enum []string `json:"enum"`
+			} `json:"recipient"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(toolNamed(manager, "send_message").Schema(), &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	if len(schema.Properties.Recipient.Enum) != 1 || schema.Properties.Recipient.Enum[0] != "Writer" {
+		t.Errorf("expected the flow chart's recipients in the schema, got %v", schema.Properties.Recipient.Enum)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := manager.Run(ctx, "get me a haiku")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.Steps[0].ToolResults[0]; got.Output != "Reply from Writer: Deep blue water sleeps" {
+		t.Errorf("unexpected tool result: %+v", got)
+	}
+
+	// The flow chart only lets the manager talk to the writer
+	reply := toolNamed(writer, "send_message")
+	if _, err := reply.Execute(ctx, map[string]interface{}{"recipient": "Manager", "content": "done"}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected the writer to be refused, got %v", err)
+	}
+	listing, _ := toolNamed(manager, "get_available_recipients").Execute(ctx, nil)
+	if listing != "Available agents for communication:\n- Writer: Writes poems.\n" {
+		t.Errorf("unexpected recipients: %q", listing)
+	}
+}
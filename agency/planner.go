@@ -0,0 +1,375 @@
+package agency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/voocel/mas/agent"
+	"github.com/voocel/mas/llm"
+)
+
+// DefaultMaxPlanSteps is the largest plan a Planner accepts when PlannerConfig.MaxSteps is not set
+const DefaultMaxPlanSteps = 10
+
+// DefaultMaxReplans is how often a Planner re-plans a failed workflow when
+// PlannerConfig.MaxReplans is not set
+const DefaultMaxReplans = 2
+
+// ErrInvalidPlan is returned when a plan refers to unknown agents or steps, or its
+// dependencies form a cycle
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// Plan is a goal broken down into steps for the agents of an agency
+type Plan struct {
+	Goal  string     `json:"goal" description:"The goal the plan achieves"`
+	Steps []PlanStep `json:"steps" description:"The steps in any order, each run once its dependencies are done"`
+}
+
+// PlanStep is one task of a plan
+type PlanStep struct {
+	ID        string   `json:"id" description:"Short unique identifier such as step_1"`
+	Agent     string   `json:"agent" description:"Name of the agent doing the step, taken from the roster"`
+	Task      string   `json:"task" description:"What the agent must do, stated so that it can be done without seeing the other steps"`
+	DependsOn []string `json:"depends_on" description:"IDs of the steps whose results this step needs, empty for none"`
+}
+
+// RosterEntry describes an agent a plan may assign steps to
+type RosterEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Roster lists the agents of the agency in name order, with their descriptions where they have one
+func (a *Agency) Roster() []RosterEntry {
+	agents := a.ListAgents()
+	roster := make([]RosterEntry, 0, len(agents))
+	for _, ag := range agents {
+		entry := RosterEntry{Name: ag.Name()}
+		if describer, ok := ag.(interface{ Description() string }); ok {
+			entry.Description = describer.Description()
+		}
+		roster = append(roster, entry)
+	}
+	sort.Slice(roster, func(i, j int) bool { return roster[i].Name < roster[j].Name })
+	return roster
+}
+
+// Validate checks that the plan only uses agents of the roster, that its step IDs are
+// unique and that every dependency names an earlier step or one of done without forming a cycle
+func (p *Plan) Validate(roster []RosterEntry, done ...string) error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("%w: the plan has no steps", ErrInvalidPlan)
+	}
+
+	agents := make(map[string]bool, len(roster))
+	for _, entry := range roster {
+		agents[entry.Name] = true
+	}
+	finished := make(map[string]bool, len(done))
+	for _, id := range done {
+		finished[id] = true
+	}
+
+	ids := make(map[string]bool, len(p.Steps))
+	for _, step := range p.Steps {
+		switch {
+		case step.ID == "":
+			return fmt.Errorf("%w: a step has no id", ErrInvalidPlan)
+		case ids[step.ID] || finished[step.ID]:
+			return fmt.Errorf("%w: step id %s is used twice", ErrInvalidPlan, step.ID)
+		case !agents[step.Agent]:
+			return fmt.Errorf("%w: step %s uses unknown agent %q", ErrInvalidPlan, step.ID, step.Agent)
+		case strings.TrimSpace(step.Task) == "":
+			return fmt.Errorf("%w: step %s has no task", ErrInvalidPlan, step.ID)
+		}
+		ids[step.ID] = true
+	}
+	for _, step := range p.Steps {
+		for _, dep := range step.DependsOn {
+			if dep == step.ID {
+				return fmt.Errorf("%w: step %s depends on itself", ErrInvalidPlan, step.ID)
+			}
+			if !ids[dep] && !finished[dep] {
+				return fmt.Errorf("%w: step %s depends on unknown step %s", ErrInvalidPlan, step.ID, dep)
+			}
+		}
+	}
+
+	_, err := p.order()
+	return err
+}
+
+// order sorts the steps so that every step comes after its dependencies, keeping the
+// plan's order where it is free to
+func (p *Plan) order() ([]PlanStep, error) {
+	pending := make(map[string]bool, len(p.Steps))
+	for _, step := range p.Steps {
+		pending[step.ID] = true
+	}
+
+	ordered := make([]PlanStep, 0, len(p.Steps))
+	for len(ordered) < len(p.Steps) {
+		progress := false
+		for _, step := range p.Steps {
+			if !pending[step.ID] || !ready(step, pending) {
+				continue
+			}
+			ordered = append(ordered, step)
+			delete(pending, step.ID)
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("%w: the dependencies of the steps form a cycle", ErrInvalidPlan)
+		}
+	}
+	return ordered, nil
+}
+
+// ready reports whether none of a step's dependencies is still pending
+func ready(step PlanStep, pending map[string]bool) bool {
+	for _, dep := range step.DependsOn {
+		if pending[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// Workflow compiles the plan into a workflow running the steps in dependency order. Each
+// agent receives the goal, its task and the results of the steps it depends on. Results of
+// steps finished before a re-plan can be passed in done, keyed by step ID.
+func (p *Plan) Workflow(done map[string]interface{}) (*Workflow, error) {
+	steps, err := p.order()
+	if err != nil {
+		return nil, err
+	}
+
+	workflow := NewWorkflow("plan", p.Goal)
+	for id, output := range done {
+		workflow.StepOutputs[id] = output
+	}
+	for _, step := range steps {
+		step := step
+		err := workflow.AddStep(&WorkflowStep{
+			ID:          step.ID,
+			Name:        step.ID,
+			Description: step.Task,
+			AgentID:     step.Agent,
+			InputFrom:   step.DependsOn,
+			Transform: func(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+				return stepPrompt(p.Goal, step, inputs), nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return workflow, nil
+}
+
+// stepPrompt is the input of the agent running a plan step
+func stepPrompt(goal string, step PlanStep, inputs map[string]interface{}) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Overall goal: %s\n\nYour task: %s\n", goal, step.Task)
+	if len(step.DependsOn) > 0 {
+		sb.WriteString("\nResults of the steps you build on:\n")
+		for _, dep := range step.DependsOn {
+			fmt.Fprintf(&sb, "[%s]\n%v\n", dep, inputs[dep])
+		}
+	}
+	return sb.String()
+}
+
+// PlannerConfig configures a Planner
+type PlannerConfig struct {
+	Name     string
+	Provider llm.Provider
+	Model    string
+	// Instructions are added to the planner's system prompt, such as house rules for plans
+	Instructions string
+	// MaxSteps limits the size of a plan, DefaultMaxPlanSteps when zero
+	MaxSteps int
+	// MaxReplans is how often Execute re-plans after a failed step, DefaultMaxReplans when
+	// zero and never when negative
+	MaxReplans int
+	// MaxRepairs is how often an invalid plan is sent back for correction,
+	// llm.DefaultMaxRepairs when zero and never when negative
+	MaxRepairs int
+}
+
+// Planner is an agent that breaks a goal down into a Plan for the agents of an agency
+// and runs it as a Workflow, re-planning the remaining work when a step fails
+type Planner struct {
+	agent      *agent.LLMAgent
+	maxSteps   int
+	maxReplans int
+	maxRepairs int
+}
+
+const plannerPrompt = `You are a planner for a team of AI agents. Break the goal down into as few steps as ` +
+	`needed, assign each step to the agent of the roster best suited for it and list the steps ` +
+	`whose results it needs. Steps without dependencies between them may run in any order. ` +
+	`The result of the last step is the answer to the goal.`
+
+// NewPlanner creates a planner
+func NewPlanner(config PlannerConfig) *Planner {
+	name := config.Name
+	if name == "" {
+		name = "planner"
+	}
+	prompt := plannerPrompt
+	if config.Instructions != "" {
+		prompt += "\n\n" + config.Instructions
+	}
+
+	planner := &Planner{
+		agent: agent.NewLLMAgent(agent.LLMAgentConfig{
+			Name:         name,
+			Description:  "Breaks goals down into plans for the other agents.",
+			Provider:     config.Provider,
+			Model:        config.Model,
+			SystemPrompt: prompt,
+			MaxRepairs:   config.MaxRepairs,
+		}),
+		maxSteps:   DefaultMaxPlanSteps,
+		maxReplans: DefaultMaxReplans,
+		maxRepairs: llm.DefaultMaxRepairs,
+	}
+	if config.MaxSteps > 0 {
+		planner.maxSteps = config.MaxSteps
+	}
+	if config.MaxReplans != 0 {
+		planner.maxReplans = max(config.MaxReplans, 0)
+	}
+	if config.MaxRepairs != 0 {
+		planner.maxRepairs = max(config.MaxRepairs, 0)
+	}
+	return planner
+}
+
+// Agent returns the agent the planner asks for plans
+func (p *Planner) Agent() *agent.LLMAgent {
+	return p.agent
+}
+
+// Plan asks the model for a plan reaching goal with the agents of roster
+func (p *Planner) Plan(ctx context.Context, goal string, roster []RosterEntry) (*Plan, error) {
+	return p.plan(ctx, goal, roster, planRequest(goal, roster), nil)
+}
+
+// Replan asks the model for a plan of the work left after step failed with cause. The
+// results of the finished steps are shown to the model and the new steps may depend on them.
+func (p *Planner) Replan(ctx context.Context, goal string, roster []RosterEntry, previous *Plan, failed PlanStep, cause error, done map[string]interface{}) (*Plan, error) {
+	var sb strings.Builder
+	sb.WriteString(planRequest(goal, roster))
+	sb.WriteString("\n\nAn earlier plan failed.\n")
+	if data, err := json.Marshal(previous); err == nil {
+		fmt.Fprintf(&sb, "Earlier plan: %s\n", data)
+	}
+	fmt.Fprintf(&sb, "Step %s (%s: %s) failed: %v\n", failed.ID, failed.Agent, failed.Task, cause)
+	if len(done) > 0 {
+		sb.WriteString("Finished steps, their results can be used as dependencies:\n")
+		for _, id := range sortedKeys(done) {
+			fmt.Fprintf(&sb, "[%s]\n%v\n", id, done[id])
+		}
+	}
+	sb.WriteString("Plan only the remaining work, with new step ids, and work around the failure.")
+
+	return p.plan(ctx, goal, roster, sb.String(), sortedKeys(done))
+}
+
+// plan runs the planner agent and sends plans failing validation back for correction
+func (p *Planner) plan(ctx context.Context, goal string, roster []RosterEntry, request string, done []string) (*Plan, error) {
+	prompt := request
+	for attempt := 0; ; attempt++ {
+		plan, _, err := agent.RunAs[Plan](ctx, p.agent, prompt)
+		if err != nil {
+			return nil, err
+		}
+		plan.Goal = goal
+
+		err = plan.Validate(roster, done...)
+		if err == nil && len(plan.Steps) > p.maxSteps {
+			err = fmt.Errorf("%w: %d steps, at most %d are allowed", ErrInvalidPlan, len(plan.Steps), p.maxSteps)
+		}
+		if err == nil {
+			return &plan, nil
+		}
+		if attempt >= p.maxRepairs {
+			return nil, err
+		}
+
+		data, _ := json.Marshal(plan)
+		prompt = fmt.Sprintf("%s\n\nYour previous plan was rejected: %v\nPrevious plan: %s\nReply with a corrected plan.", request, err, data)
+	}
+}
+
+// planRequest describes the goal and the roster to the planner
+func planRequest(goal string, roster []RosterEntry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Goal: %s\n\nRoster:\n", goal)
+	for _, entry := range roster {
+		if entry.Description != "" {
+			fmt.Fprintf(&sb, "- %s: %s\n", entry.Name, entry.Description)
+		} else {
+			fmt.Fprintf(&sb, "- %s\n", entry.Name)
+		}
+	}
+	return sb.String()
+}
+
+// Execute plans goal for the agents of agency and runs the plan. When a step fails the
+// remaining work is re-planned, keeping the results of the finished steps, up to MaxReplans times.
+func (p *Planner) Execute(ctx context.Context, agency *Agency, goal string) (interface{}, error) {
+	roster := agency.Roster()
+	plan, err := p.Plan(ctx, goal, roster)
+	if err != nil {
+		return nil, err
+	}
+
+	done := map[string]interface{}{}
+	for replans := 0; ; replans++ {
+		workflow, err := plan.Workflow(done)
+		if err != nil {
+			return nil, err
+		}
+
+		output, runErr := workflow.Execute(ctx, agency, goal)
+		if runErr == nil {
+			return output, nil
+		}
+		if replans >= p.maxReplans || ctx.Err() != nil {
+			return nil, runErr
+		}
+
+		var failed PlanStep
+		for _, step := range plan.Steps {
+			status, _ := workflow.GetStepStatus(step.ID)
+			if status == WorkflowStatusCompleted {
+				done[step.ID], _ = workflow.GetStepOutput(step.ID)
+			}
+			if step.ID == workflow.CurrentStepID {
+				failed = step
+			}
+		}
+
+		plan, err = p.Replan(ctx, goal, roster, plan, failed, runErr, done)
+		if err != nil {
+			return nil, fmt.Errorf("re-planning after %v failed: %w", runErr, err)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package agency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voocel/mas/agent"
+	"github.com/voocel/mas/llm"
+)
+
+/**
+ * Norwegian-style doc: Like the skipper who charts the course before the boat leaves the harbour, these tests make sure every leg of the journey has a crew member, no leg waits on itself, and a new course is plotted when the wind turns.
+ */
+
+var testRoster = []RosterEntry{{Name: "Researcher", Description: "Finds facts."}, {Name: "Writer", Description: "Writes prose."}}
+
+func TestPlan_Validate(t *testing.T) {
+	cases := []struct {
+		name  string
+		steps []PlanStep
+		done  []string
+		want  string
+	}{
+		{"valid", []PlanStep{{ID: "a", Agent: "Researcher", Task: "find"}, {ID: "b", Agent: "Writer", Task: "write", DependsOn: []string{"a"}}}, nil, ""},
+		{"empty", nil, nil, "no steps"},
+		{"unknown agent", []PlanStep{{ID: "a", Agent: "Painter", Task: "paint"}}, nil, "unknown agent"},
+		{"duplicate id", []PlanStep{{ID: "a", Agent: "Writer", Task: "x"}, {ID: "a", Agent: "Writer", Task: "y"}}, nil, "used twice"},
+		{"unknown dependency", []PlanStep{{ID: "a", Agent: "Writer", Task: "x", DependsOn: []string{"z"}}}, nil, "unknown step"},
+		{"finished dependency", []PlanStep{{ID: "b", Agent: "Writer", Task: "x", DependsOn: []string{"a"}}}, []string{"a"}, ""},
+		{"cycle", []PlanStep{{ID: "a", Agent: "Writer", Task: "x", DependsOn: []string{"b"}}, {ID: "b", Agent: "Writer", Task: "y", DependsOn: []string{"a"}}}, nil, "cycle"},
+	}
+	for _, c := range cases {
+		plan := &Plan{Goal: "g", Steps: c.steps}
+		err := plan.Validate(testRoster, c.done...)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidPlan) || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected %q, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestPlan_WorkflowOrdersByDependency(t *testing.T) {
+	plan := &Plan{Goal: "article", Steps: []PlanStep{
+		{ID: "write", Agent: "Writer", Task: "write it", DependsOn: []string{"facts", "outline"}},
+		{ID: "outline", Agent: "Writer", Task: "outline it", DependsOn: []string{"facts"}},
+		{ID: "facts", Agent: "Researcher", Task: "find facts"},
+	}}
+	workflow, err := plan.Workflow(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(workflow.Order, ","); got != "facts,outline,write" {
+		t.Errorf("unexpected order: %s", got)
+	}
+
+	step, _ := workflow.GetStep("write")
+	input, _ := step.Transform(context.Background(), map[string]interface{}{"facts": "F", "outline": "O"})
+	prompt := input.(string)
+	if !strings.Contains(prompt, "Overall goal: article") || !strings.Contains(prompt, "[facts]\nF") || !strings.Contains(prompt, "[outline]\nO") {
+		t.Errorf("unexpected step prompt: %q", prompt)
+	}
+}
+
+func TestPlanner_RepairsInvalidPlan(t *testing.T) {
+	provider := llm.NewScriptedProvider(
+		llm.ScriptRule{Match: llm.MatchLastMessageContains("rejected"), Response: llm.TextResponse(`{"goal":"g","steps":[{"id":"s1","agent":"Writer","task":"write","depends_on":[]}]}`)},
+		llm.ScriptRule{Response: llm.TextResponse(`{"goal":"g","steps":[{"id":"s1","agent":"Painter","task":"paint","depends_on":[]}]}`)},
+	)
+	planner := NewPlanner(PlannerConfig{Provider: provider})
+
+	plan, err := planner.Plan(context.Background(), "a poem", testRoster)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.Goal != "a poem" || plan.Steps[0].Agent != "Writer" {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+	if !strings.Contains(provider.Requests()[1].Messages[1].Content, `unknown agent "Painter"`) {
+		t.Errorf("expected the validation error to be sent back")
+	}
+}
+
+func TestPlanner_ExecuteReplansAfterFailure(t *testing.T) {
+	plannerProvider := llm.NewScriptedProvider(
+		llm.ScriptRule{Match: llm.MatchLastMessageContains("An earlier plan failed"), Response: llm.TextResponse(
+			`{"goal":"g","steps":[{"id":"retry","agent":"Writer","task":"write the summary again","depends_on":["facts"]}]}`)},
+		llm.ScriptRule{Response: llm.TextResponse(
+			`{"goal":"g","steps":[{"id":"facts","agent":"Researcher","task":"find facts about fjords","depends_on":[]},{"id":"summary","agent":"Writer","task":"summarize","depends_on":["facts"]}]}`)},
+	)
+	researcherProvider := llm.NewScriptedProvider(llm.ScriptRule{Response: llm.TextResponse("Fjords are glacial.")})
+	writerProvider := llm.NewScriptedProvider(
+		llm.ScriptRule{Err: llm.ErrServerError, Once: true},
+		llm.ScriptRule{Match: llm.MatchLastMessageContains("Fjords are glacial."), Response: llm.TextResponse("Fjords were carved by glaciers.")},
+	)
+
+	ag := New(Config{Name: "Newsroom"})
+	ag.AddAgent(agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Researcher", Description: "Finds facts.", Provider: researcherProvider}))
+	ag.AddAgent(agent.NewLLMAgent(agent.LLMAgentConfig{Name: "Writer", Description: "Writes prose.", Provider: writerProvider}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	planner := NewPlanner(PlannerConfig{Provider: plannerProvider})
+	output, err := planner.Execute(ctx, ag, "a summary about fjords")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output != "Fjords were carved by glaciers." {
+		t.Errorf("unexpected output: %v", output)
+	}
+
+	requests := plannerProvider.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected a plan and a re-plan, got %d planner requests", len(requests))
+	}
+	replan := requests[1].Messages[1].Content
+	if !strings.Contains(replan, "Step summary (Writer: summarize) failed") || !strings.Contains(replan, "[facts]\nFjords are glacial.") {
+		t.Errorf("expected the failure and finished results in the re-plan request, got %q", replan)
+	}
+	if len(researcherProvider.Requests()) != 1 {
+		t.Errorf("expected the finished step not to run again, got %d researcher requests", len(researcherProvider.Requests()))
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/voocel/mas/agent"
+	"github.com/voocel/mas/llm"
 	"github.com/voocel/mas/orchestrator"
+	"github.com/voocel/mas/tools"
 )
 
 // Tool represents a tool that agents can use
+//
+// Deprecated: LLMAgent only calls tools.Tool implementations, see SendMessageTool.
 type Tool struct {
 	Name        string
 	Description string
@@ -18,6 +23,8 @@ type Tool struct {
 }
 
 // ToolHandler is the handler function type for tools
+//
+// Deprecated: implement tools.Tool instead.
 type ToolHandler func(ctx context.Context, params map[string]interface{}, agent *agent.Agent) (string, error)
 
 // ToolResult represents the result of a tool execution
@@ -34,7 +41,8 @@ func UnmarshalParams(paramsJSON string) (map[string]interface{}, error) {
 	return params, nil
 }
 
-// SendMessageTool defines an inter-agent communication tool
+// SendMessageTool defines an inter-agent communication tool. It lets the sender message
+// the agents the agency's FlowChart allows and implements tools.Tool.
 type SendMessageTool struct {
 	agency *Agency
 	sender agent.Agent
@@ -55,7 +63,37 @@ func (t *SendMessageTool) Name() string {
 
 // Description returns the tool description
 func (t *SendMessageTool) Description() string {
-	return "Send a message to other agents"
+	return "Send a message to another agent of the agency, optionally waiting for its reply. Use get_available_recipients to see who can be messaged."
+}
+
+// Schema returns the parameter schema, the recipient is limited to the agents the
+// FlowChart currently allows
+func (t *SendMessageTool) Schema() json.RawMessage {
+	recipient := map[string]interface{}{
+		"type":        "string",
+		"description": "Name of the agent to send the message to",
+	}
+	if recipients := t.agency.recipients(t.sender.Name()); len(recipients) > 0 {
+		recipient["enum"] = recipients
+	}
+
+	schema, _ := json.Marshal(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"recipient": recipient,
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "The message, written so that the recipient can act on it without further context",
+			},
+			"wait_reply": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Wait for the recipient to finish and return its reply",
+			},
+		},
+		"required":             []string{"recipient", "content"},
+		"additionalProperties": false,
+	})
+	return schema
 }
 
 // SendMessageParams parameters for the send message tool
@@ -65,73 +103,58 @@ type SendMessageParams struct {
 	WaitReply bool   `json:"wait_reply,omitempty"`
 }
 
-// Execute executes the tool
-func (t *SendMessageTool) Execute(ctx context.Context, paramsJSON string) (string, error) {
-	var params SendMessageParams
-	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
-		return "", err
+// Execute sends the message as a task for the recipient
+func (t *SendMessageTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	var msg SendMessageParams
+	if err := decodeParams(params, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Recipient == "" || msg.Content == "" {
+		return nil, fmt.Errorf("%w: recipient and content are required", tools.ErrInvalidParameters)
 	}
 
 	// Verify recipient exists
-	_, err := t.agency.GetAgent(params.Recipient)
+	_, err := t.agency.GetAgent(msg.Recipient)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Check communication permission
-	if !t.agency.FlowChart.CanCommunicate(t.sender.Name(), params.Recipient) {
-		return "", fmt.Errorf("agent %s is not allowed to communicate with %s", t.sender.Name(), params.Recipient)
+	if !t.agency.flowChart().CanCommunicate(t.sender.Name(), msg.Recipient) {
+		return nil, fmt.Errorf("agent %s is not allowed to communicate with %s", t.sender.Name(), msg.Recipient)
 	}
 
 	// Create task
 	task := orchestrator.Task{
 		Name:        fmt.Sprintf("Process message from %s", t.sender.Name()),
 		Description: "Process inter-agent message",
-		AgentIDs:    []string{params.Recipient},
-		Input:       params.Content,
+		AgentIDs:    []string{msg.Recipient},
+		Input:       msg.Content,
 		Metadata: map[string]interface{}{
-			"sender": t.sender.Name(),
+			"sender":      t.sender.Name(),
+			llm.TagAgency: t.agency.Name,
 		},
 	}
 
 	// Submit task
 	taskID, err := t.agency.Orchestrator.SubmitTask(ctx, task)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if !params.WaitReply {
-		return fmt.Sprintf("Message sent to %s, task ID: %s", params.Recipient, taskID), nil
+	if !msg.WaitReply {
+		return fmt.Sprintf("Message sent to %s, task ID: %s", msg.Recipient, taskID), nil
 	}
 
-	// Wait for reply
-	for {
-		task, err := t.agency.Orchestrator.GetTask(taskID)
-		if err != nil {
-			return "", err
-		}
-
-		if task.Status == orchestrator.TaskStatusCompleted {
-			result, ok := task.Output.(string)
-			if !ok {
-				return "", fmt.Errorf("task output is not a string")
-			}
-			return fmt.Sprintf("Reply from %s: %s", params.Recipient, result), nil
-		} else if task.Status == orchestrator.TaskStatusFailed {
-			return "", fmt.Errorf("task failed: %s", task.Error)
-		}
-
-		// Wait for a while before checking again
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(100 * time.Millisecond):
-			// Continue checking
-		}
+	reply, err := t.agency.awaitTask(ctx, taskID)
+	if err != nil {
+		return nil, err
 	}
+	return fmt.Sprintf("Reply from %s: %v", msg.Recipient, reply), nil
 }
 
-// GetAvailableRecipientsTool tool for getting available communication recipients
+// GetAvailableRecipientsTool tool for getting available communication recipients, it
+// implements tools.Tool
 type GetAvailableRecipientsTool struct {
 	agency *Agency
 	sender agent.Agent
@@ -155,18 +178,24 @@ func (t *GetAvailableRecipientsTool) Description() string {
 	return "Get all other agents the current agent can communicate with"
 }
 
-// Execute executes the tool
-func (t *GetAvailableRecipientsTool) Execute(ctx context.Context, paramsJSON string) (string, error) {
-	recipients := t.agency.FlowChart.GetReceivers(t.sender.Name())
+// Schema returns the parameter schema, the tool takes no parameters
+func (t *GetAvailableRecipientsTool) Schema() json.RawMessage {
+	return json.RawMessage(`{"type":"object","properties":{},"additionalProperties":false}`)
+}
 
+// Execute lists the recipients with their descriptions where the agents have one
+func (t *GetAvailableRecipientsTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	recipients := t.agency.recipients(t.sender.Name())
 	if len(recipients) == 0 {
 		return "No agents available for communication", nil
 	}
 
 	result := "Available agents for communication:\n"
 	for _, recipient := range recipients {
-		_, err := t.agency.GetAgent(recipient)
-		if err == nil {
+		a, _ := t.agency.GetAgent(recipient)
+		if describer, ok := a.(interface{ Description() string }); ok && describer.Description() != "" {
+			result += fmt.Sprintf("- %s: %s\n", recipient, describer.Description())
+		} else {
 			result += fmt.Sprintf("- %s\n", recipient)
 		}
 	}
@@ -174,6 +203,54 @@ func (t *GetAvailableRecipientsTool) Execute(ctx context.Context, paramsJSON str
 	return result, nil
 }
 
+// recipients lists in sorted order the agents of the agency that sender may message
+func (a *Agency) recipients(sender string) []string {
+	var recipients []string
+	for _, receiver := range a.flowChart().GetReceivers(sender) {
+		if _, err := a.GetAgent(receiver); err == nil {
+			recipients = append(recipients, receiver)
+		}
+	}
+	sort.Strings(recipients)
+	return recipients
+}
+
+// awaitTask waits for a task to finish and returns its output
+func (a *Agency) awaitTask(ctx context.Context, taskID string) (interface{}, error) {
+	for {
+		task, err := a.Orchestrator.GetTask(taskID)
+		if err != nil {
+			return nil, err
+		}
+
+		if task.Status == orchestrator.TaskStatusCompleted {
+			return task.Output, nil
+		} else if task.Status == orchestrator.TaskStatusFailed {
+			return nil, fmt.Errorf("task failed: %s", task.Error)
+		}
+
+		// Wait for a while before checking again
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			// Continue checking
+		}
+	}
+}
+
+// decodeParams converts tool parameters into a typed struct
+func decodeParams(params map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s", tools.ErrInvalidParameters, err.Error())
+	}
+	return nil
+}
+
 // SendMessage sends a message to the specified agent
 func (a *Agency) SendMessage(ctx context.Context, agentID string, content string) (string, error) {
 	// Check if the agent exists
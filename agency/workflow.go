@@ -2,11 +2,13 @@ package agency
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/voocel/mas/llm"
 )
 
 // WorkflowStatus defines the workflow status
@@ -307,3 +309,38 @@ func (w *Workflow) GetStepOutput(stepID string) (interface{}, error) {
 
 	return output, nil
 }
+
+// JSONOutput returns an OutputProcessor that validates a step's JSON output against the
+// schema derived from T and decodes it, so later steps receive a T instead of text.
+// Pair it with an agent configured with a matching ResponseFormat.
+func JSONOutput[T any]() func(ctx context.Context, output interface{}) (interface{}, error) {
+	return func(ctx context.Context, output interface{}) (interface{}, error) {
+		var out T
+		var content string
+		switch v := output.(type) {
+		case T:
+			return v, nil
+		case string:
+			content = v
+		case []byte:
+			content = string(v)
+		case json.RawMessage:
+			content = string(v)
+		default:
+			return nil, fmt.Errorf("expected JSON output, got %T", output)
+		}
+
+		format, err := llm.JSONSchemaFormatFor("output", out)
+		if err != nil {
+			return nil, err
+		}
+		data, err := llm.ParseStructuredOutput(content, format)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+}
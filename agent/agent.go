@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"errors"
+	"slices"
+	"sync"
 
 	"github.com/voocel/mas/knowledge"
 	"github.com/voocel/mas/memory"
@@ -53,6 +55,7 @@ type BaseAgent struct {
 	memory    memory.Memory
 	knowledge knowledge.Graph
 	tools     []tools.Tool
+	toolsMu   sync.RWMutex
 }
 
 // NewBaseAgent creates a new base agent
@@ -89,9 +92,20 @@ func (a *BaseAgent) GetKnowledgeGraph() knowledge.Graph {
 
 // GetTools gets the tools available to the agent
 func (a *BaseAgent) GetTools() []tools.Tool {
+	a.toolsMu.RLock()
+	defer a.toolsMu.RUnlock()
 	return a.tools
 }
 
+// AddTools gives the agent more tools. Runs and session turns already in progress keep the
+// tools they started with, the step-by-step cycle sees them from its next Think or Act.
+func (a *BaseAgent) AddTools(extra ...tools.Tool) {
+	a.toolsMu.Lock()
+	defer a.toolsMu.Unlock()
+	// Clone so the caller's configured slice is never appended to in place
+	a.tools = append(slices.Clone(a.tools), extra...)
+}
+
 // Perceive default implementation - not implemented
 func (a *BaseAgent) Perceive(ctx context.Context, input interface{}) error {
 	return errors.New("unimplemented method: Perceive is not available for base agent")
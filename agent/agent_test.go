@@ -42,6 +42,21 @@ func TestBaseAgent_GetTools(t *testing.T) {
 	}
 }
 
+func TestBaseAgent_AddTools_KeepsConfigSlice(t *testing.T) {
+	noop := func(ctx context.Context, params map[string]interface{}) (interface{}, error) { return nil, nil }
+	configured := make([]tools.Tool, 1, 4)
+	configured[0] = tools.NewTool("a", "desc", nil, noop)
+	agent := NewBaseAgentWithOptions("A", nil, nil, configured)
+
+	agent.AddTools(tools.NewTool("b", "desc", nil, noop))
+	if got := configured[:2][1]; got != nil {
+		t.Errorf("expected the configured slice to be left alone, found %s", got.Name())
+	}
+	if len(agent.GetTools()) != 2 {
+		t.Errorf("expected 2 tools, got %d", len(agent.GetTools()))
+	}
+}
+
 func TestBaseAgent_Perceive_NotImplemented(t *testing.T) {
 	a := NewBaseAgent("A")
 	err := a.Perceive(context.Background(), nil)
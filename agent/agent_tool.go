@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/voocel/mas/tools"
+)
+
+// AgentToolConfig customizes the tool built by NewAgentTool, zero fields are derived from the agent
+type AgentToolConfig struct {
+	// Name is the tool name, the agent name restricted to letters, digits, '_' and '-' when empty
+	Name string
+	// Description tells the calling model when to delegate, the agent's description when empty
+	Description string
+	// Schema replaces the default {task, context} parameters. The agent then receives the
+	// decoded parameters as its input.
+	Schema json.RawMessage
+}
+
+// agentToolSchema is the default input of an agent tool
+var agentToolSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"task": {
+			"type": "string",
+			"description": "The task to hand over, stated so that it can be done without seeing this conversation"
+		},
+		"context": {
+			"type": "string",
+			"description": "Facts and earlier results the agent needs for the task"
+		}
+	},
+	"required": ["task"],
+	"additionalProperties": false
+}`)
+
+// AgentTool exposes an agent as a tool, so a manager agent can delegate to it through
+// ordinary tool calling. The delegated run shares the caller's context, and with it the
+// task tags and budgets.
+type AgentTool struct {
+	agent       Agent
+	name        string
+	description string
+	schema      json.RawMessage
+}
+
+// AsTool wraps an agent as a tool with the default name, description and schema
+func AsTool(a Agent) *AgentTool {
+	return NewAgentTool(a, AgentToolConfig{})
+}
+
+// NewAgentTool wraps an agent as a tool
+func NewAgentTool(a Agent, config AgentToolConfig) *AgentTool {
+	name := config.Name
+	if name == "" {
+		name = toolName(a.Name())
+	}
+
+	description := config.Description
+	if description == "" {
+		if describer, ok := a.(interface{ Description() string }); ok {
+			description = describer.Description()
+		}
+	}
+	if description == "" {
+		description = fmt.Sprintf("Delegate a task to the %s agent and receive its answer.", a.Name())
+	}
+
+	return &AgentTool{agent: a, name: name, description: description, schema: config.Schema}
+}
+
+// Agent returns the wrapped agent
+func (t *AgentTool) Agent() Agent {
+	return t.agent
+}
+
+func (t *AgentTool) Name() string {
+	return t.name
+}
+
+func (t *AgentTool) Description() string {
+	return t.description
+}
+
+func (t *AgentTool) Schema() json.RawMessage {
+	if t.schema != nil {
+		return t.schema
+	}
+	return agentToolSchema
+}
+
+// Execute runs the agent on the task and returns its answer
+func (t *AgentTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if t.schema != nil {
+		return t.agent.Process(ctx, params)
+	}
+
+	task, _ := params["task"].(string)
+	if strings.TrimSpace(task) == "" {
+		return nil, fmt.Errorf("%w: task is required", tools.ErrInvalidParameters)
+	}
+	if extra, _ := params["context"].(string); strings.TrimSpace(extra) != "" {
+		task += "\n\nContext:\n" + extra
+	}
+	return t.agent.Process(ctx, task)
+}
+
+// toolName turns an agent name into a name the model APIs accept as a function name
+func toolName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			sb.WriteRune(r)
+		case r == ' ' || r == '.':
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "agent"
+	}
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like the foreman who sends the carpenter to fix the roof instead of climbing up himself, these tests make sure a task can be handed to a specialist, that the specialist hears the whole story, and that the answer comes back to the one who asked.
+ */
+
+func TestAsTool_DescribesAgent(t *testing.T) {
+	specialist := NewLLMAgent(LLMAgentConfig{Name: "Tax expert", Description: "Answers questions about Norwegian tax law."})
+	tool := AsTool(specialist)
+
+	if tool.Name() != "Tax_expert" {
+		t.Errorf("unexpected name: %s", tool.Name())
+	}
+	if tool.Description() != "Answers questions about Norwegian tax law." {
+		t.Errorf("unexpected description: %s", tool.Description())
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(tool.Schema(), &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	if required := schema["required"].([]interface{}); len(required) != 1 || required[0] != "task" {
+		t.Errorf("unexpected required fields: %v", required)
+	}
+
+	if got := AsTool(&mockAgent{name: "mock"}).Description(); !strings.Contains(got, "mock") {
+		t.Errorf("expected a default description naming the agent, got %q", got)
+	}
+}
+
+func TestAsTool_ManagerDelegates(t *testing.T) {
+	specialistProvider := llm.NewSequenceProvider(textReply("The rate is 22%."))
+	specialist := NewLLMAgent(LLMAgentConfig{Name: "tax", Description: "Tax questions.", Provider: specialistProvider})
+
+	delegate := llm.ToolCall{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "tax", Arguments: `{"task":"What is the corporate tax rate?","context":"Norway, 2024"}`}}
+	managerProvider := llm.NewSequenceProvider(toolCallReply(delegate), textReply("Norway taxes companies at 22%."))
+	manager := NewLLMAgent(LLMAgentConfig{Name: "manager", Provider: managerProvider, Tools: []tools.Tool{AsTool(specialist)}})
+
+	result, err := manager.Run(context.Background(), "What do companies pay in tax in Norway?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.Steps[0].ToolResults[0].Output; got != "The rate is 22%." {
+		t.Errorf("expected the specialist's answer as tool output, got %v", got)
+	}
+	prompt := specialistProvider.Requests()[0].Messages[1].Content
+	if !strings.Contains(prompt, "What is the corporate tax rate?") || !strings.Contains(prompt, "Norway, 2024") {
+		t.Errorf("expected the task and context in the specialist prompt, got %q", prompt)
+	}
+
+	advertised := managerProvider.Requests()[0].Tools
+	if len(advertised) != 1 || advertised[0]["function"].(map[string]interface{})["name"] != "tax" {
+		t.Errorf("expected the specialist to be advertised as a tool, got %+v", advertised)
+	}
+}
+
+func TestAgentTool_CustomSchema(t *testing.T) {
+	agent := &mockAgent{name: "mock"}
+	tool := NewAgentTool(agent, AgentToolConfig{Name: "lookup", Schema: json.RawMessage(`{"type":"object"}`)})
+
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{"id": 7.0}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := AsTool(agent).Execute(context.Background(), map[string]interface{}{}); !errors.Is(err, tools.ErrInvalidParameters) {
+		t.Errorf("expected a missing task to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+// ErrToolCallRejected is reported to the model when a call needing approval is turned down
+var ErrToolCallRejected = errors.New("tool call rejected")
+
+// ApprovalRequest describes a tool call waiting for a decision
+type ApprovalRequest struct {
+	ID     string                 `json:"id"`
+	Agent  string                 `json:"agent"`
+	TaskID string                 `json:"task_id,omitempty"`
+	CallID string                 `json:"call_id"`
+	Tool   string                 `json:"tool"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// ApprovalDecision is the answer to an ApprovalRequest
+type ApprovalDecision struct {
+	Approved bool `json:"approved"`
+	// Feedback is passed to the model when the call is rejected
+	Feedback string `json:"feedback,omitempty"`
+}
+
+// Approver decides on tool calls that need approval, see tools.RequireApproval. The run
+// waits in RequestApproval until a decision is made or ctx ends.
+type Approver interface {
+	RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+// ApproverFunc adapts a callback to an Approver
+type ApproverFunc func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+func (f ApproverFunc) RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	return f(ctx, req)
+}
+
+// approveToolCall asks the approver about a call whose tool requires approval. A rejection
+// is returned as an error wrapping ErrToolCallRejected so it reaches the model as the tool result.
+func (a *LLMAgent) approveToolCall(ctx context.Context, call llm.ToolCall, params map[string]interface{}) error {
+	tool := a.findTool(ctx, call.Function.Name)
+	if tool == nil || !tools.NeedsApproval(tool, params) {
+		return nil
+	}
+	if a.approver == nil {
+		return fmt.Errorf("%w: %s requires approval but no approver is configured", ErrToolCallRejected, tool.Name())
+	}
+
+	req := ApprovalRequest{
+		ID:     uuid.New().String(),
+		Agent:  a.Name(),
+		TaskID: llm.RequestTags(ctx)[llm.TagTaskID],
+		CallID: call.ID,
+		Tool:   tool.Name(),
+		Params: params,
+	}
+	logger := a.log(ctx).With(llm.LogKeyTool, tool.Name(), "approval_id", req.ID)
+	logger.InfoContext(ctx, "waiting for approval")
+
+	decision, err := a.approver.RequestApproval(ctx, req)
+	if err != nil {
+		return fmt.Errorf("approval failed: %w", err)
+	}
+	if !decision.Approved {
+		logger.InfoContext(ctx, "tool call rejected")
+		if decision.Feedback == "" {
+			return ErrToolCallRejected
+		}
+		return fmt.Errorf("%w: %s", ErrToolCallRejected, decision.Feedback)
+	}
+
+	logger.InfoContext(ctx, "tool call approved")
+	return nil
+}
+
+// PendingApproval is a request waiting on a ChannelApprover
+type PendingApproval struct {
+	Request  ApprovalRequest
+	decision chan ApprovalDecision
+	once     sync.Once
+}
+
+// Decide answers the request, later answers are ignored
+func (p *PendingApproval) Decide(decision ApprovalDecision) {
+	p.once.Do(func() { p.decision <- decision })
+}
+
+// Approve lets the call run
+func (p *PendingApproval) Approve() {
+	p.Decide(ApprovalDecision{Approved: true})
+}
+
+// Reject turns the call down, feedback is passed to the model
+func (p *PendingApproval) Reject(feedback string) {
+	p.Decide(ApprovalDecision{Feedback: feedback})
+}
+
+// ChannelApprover publishes approval requests on a channel, for a UI or console loop to
+// answer with Approve or Reject
+type ChannelApprover struct {
+	requests chan *PendingApproval
+}
+
+// NewChannelApprover creates an approver whose channel buffers up to buffer requests
+func NewChannelApprover(buffer int) *ChannelApprover {
+	return &ChannelApprover{requests: make(chan *PendingApproval, buffer)}
+}
+
+// Requests returns the channel of requests waiting for a decision
+func (c *ChannelApprover) Requests() <-chan *PendingApproval {
+	return c.requests
+}
+
+func (c *ChannelApprover) RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	pending := &PendingApproval{Request: req, decision: make(chan ApprovalDecision, 1)}
+
+	select {
+	case c.requests <- pending:
+	case <-ctx.Done():
+		return ApprovalDecision{}, ctx.Err()
+	}
+
+	select {
+	case decision := <-pending.decision:
+		return decision, nil
+	case <-ctx.Done():
+		return ApprovalDecision{}, ctx.Err()
+	}
+}
+
+// HTTPApprover posts approval requests as JSON to an endpoint, which answers with an
+// ApprovalDecision once someone has decided. The request stays open while it waits, so the
+// client should not time out before the reviewers do.
+type HTTPApprover struct {
+	url     string
+	client  *http.Client
+	headers map[string]string
+}
+
+// NewHTTPApprover creates an approver for the endpoint at url, http.DefaultClient is used
+// when client is nil. Headers, such as an authorization token, are sent with every request.
+func NewHTTPApprover(url string, client *http.Client, headers map[string]string) *HTTPApprover {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPApprover{url: url, client: client, headers: headers}
+}
+
+func (h *HTTPApprover) RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for key, value := range h.headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ApprovalDecision{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ApprovalDecision{}, fmt.Errorf("approval endpoint returned %s", resp.Status)
+	}
+
+	var decision ApprovalDecision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return ApprovalDecision{}, fmt.Errorf("invalid approval decision: %w", err)
+	}
+	return decision, nil
+}
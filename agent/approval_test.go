@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like the foreman who must sign before the dynamite goes off, these tests make sure the crew waits for the signature, carries on when it is given, and listens to the foreman's reasons when it is not.
+ */
+
+func approvalAgent(provider llm.Provider, approver Approver) *LLMAgent {
+	return NewLLMAgent(LLMAgentConfig{
+		Name:     "ops",
+		Provider: provider,
+		Tools:    []tools.Tool{tools.RequireApproval(&mockTool{}, nil)},
+		Approver: approver,
+	})
+}
+
+func TestApproval_ChannelApproverApproves(t *testing.T) {
+	provider := llm.NewSequenceProvider(toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)), textReply("3"))
+	approver := NewChannelApprover(0)
+	go func() {
+		pending := <-approver.Requests()
+		if pending.Request.Tool != "adder" || pending.Request.CallID != "call_1" || pending.Request.Params["x"] != 1.0 {
+			t.Errorf("unexpected request: %+v", pending.Request)
+		}
+		pending.Approve()
+	}()
+
+	result, err := approvalAgent(provider, approver).Run(context.Background(), "add 1 and 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.Steps[0].ToolResults[0]; got.Error != "" || got.Output != 3.0 {
+		t.Errorf("expected the approved call to run, got %+v", got)
+	}
+}
+
+func TestApproval_RejectionFeedbackReachesModel(t *testing.T) {
+	provider := llm.NewSequenceProvider(toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)), textReply("I will not add."))
+	approver := ApproverFunc(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		return ApprovalDecision{Feedback: "use mental arithmetic"}, nil
+	})
+
+	result, err := approvalAgent(provider, approver).Run(context.Background(), "add 1 and 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	toolResult := result.Steps[0].ToolResults[0]
+	if toolResult.Output != nil || toolResult.Error != "tool call rejected: use mental arithmetic" {
+		t.Errorf("unexpected tool result: %+v", toolResult)
+	}
+	sent := provider.Requests()[1].Messages
+	if last := sent[len(sent)-1]; last.Role != llm.RoleTool || !strings.Contains(last.Content, "use mental arithmetic") {
+		t.Errorf("expected the feedback in the tool message, got %+v", last)
+	}
+}
+
+func TestApproval_NoApproverRejects(t *testing.T) {
+	provider := llm.NewSequenceProvider(toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)))
+	agent := approvalAgent(provider, nil)
+
+	ctx := context.Background()
+	if err := agent.Perceive(ctx, "add"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := agent.Think(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := agent.Act(ctx); !errors.Is(err, ErrToolCallRejected) {
+		t.Errorf("expected a rejection, got %v", err)
+	}
+}
+
+func TestApproval_OnlyMatchingCallsWait(t *testing.T) {
+	tool := tools.RequireApproval(&mockTool{}, func(params map[string]interface{}) bool { return params["x"] == 100.0 })
+	provider := llm.NewSequenceProvider(toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)), textReply("3"))
+	approver := ApproverFunc(func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		t.Errorf("unexpected approval request: %+v", req)
+		return ApprovalDecision{}, nil
+	})
+	agent := NewLLMAgent(LLMAgentConfig{Name: "ops", Provider: provider, Tools: []tools.Tool{tool}, Approver: approver})
+
+	if _, err := agent.Run(context.Background(), "add"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHTTPApprover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req ApprovalRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(ApprovalDecision{Approved: req.Tool == "adder"})
+	}))
+	defer server.Close()
+
+	approver := NewHTTPApprover(server.URL, nil, map[string]string{"Authorization": "Bearer secret"})
+	decision, err := approver.RequestApproval(context.Background(), ApprovalRequest{ID: "a1", Tool: "adder"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decision.Approved {
+		t.Errorf("expected approval")
+	}
+
+	unauthorized := NewHTTPApprover(server.URL, nil, nil)
+	if _, err := unauthorized.RequestApproval(context.Background(), ApprovalRequest{ID: "a2", Tool: "adder"}); err == nil {
+		t.Errorf("expected an error for a failed request")
+	}
+}
+
+func TestChannelApprover_ContextCancelled(t *testing.T) {
+	approver := NewChannelApprover(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := approver.RequestApproval(ctx, ApprovalRequest{ID: "a1"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
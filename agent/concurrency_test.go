@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/memory"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like many boats sharing one harbour, these tests send a fleet of calls through a single agent at once and check that every boat comes home with its own catch. Run them with -race.
+ */
+
+// jobRules scripts a tool round trip per job, keyed on the job's input line and its unique sum
+func jobRules(jobs int) []llm.ScriptRule {
+	rules := make([]llm.ScriptRule, 0, 2*jobs)
+	for i := 0; i < jobs; i++ {
+		sum := fmt.Sprint(2 * i)
+		rules = append(rules,
+			llm.ScriptRule{
+				Match:    llm.MatchLastMessageContains(fmt.Sprintf("Input: job-%d\n", i)),
+				Response: toolCallReply(adderCall(fmt.Sprintf("call_%d", i), fmt.Sprintf(`{"x":%d,"y":%d}`, i, i))),
+			},
+			llm.ScriptRule{
+				Match: func(req llm.ChatCompletionRequest) bool {
+					last := req.Messages[len(req.Messages)-1]
+					return last.Role == llm.RoleTool && last.Content == sum
+				},
+				Response: textReply(fmt.Sprintf("job-%d = %s", i, sum)),
+			},
+		)
+	}
+	return rules
+}
+
+func TestLLMAgent_ConcurrentProcess(t *testing.T) {
+	const jobs = 32
+	agent := NewLLMAgent(LLMAgentConfig{Name: "shared", Provider: llm.NewScriptedProvider(jobRules(jobs)...), Tools: []tools.Tool{&mockTool{}}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			output, err := agent.Process(context.Background(), fmt.Sprintf("job-%d", i))
+			if err != nil {
+				t.Errorf("job %d: unexpected error: %v", i, err)
+				return
+			}
+			if want := fmt.Sprintf("job-%d = %d", i, 2*i); output != want {
+				t.Errorf("job %d: expected %q, got %q", i, want, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLLMAgent_ConcurrentProcessStream(t *testing.T) {
+	const jobs = 16
+	agent := NewLLMAgent(LLMAgentConfig{Name: "shared", Provider: llm.NewScriptedProvider(jobRules(jobs)...), Tools: []tools.Tool{&mockTool{}}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var last StreamEvent
+			for event := range agent.ProcessStream(context.Background(), fmt.Sprintf("job-%d", i)) {
+				last = event
+			}
+			if last.Type != StreamEventDone || last.Result.Output != fmt.Sprintf("job-%d = %d", i, 2*i) {
+				t.Errorf("job %d: unexpected final event %+v", i, last)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// barrierMemory holds back recalls until a number of items have been added, so that
+// concurrent runs build their prompts only after all of them have written their input
+type barrierMemory struct {
+	memory.Memory
+	mu      sync.Mutex
+	pending int
+	ready   chan struct{}
+}
+
+func (m *barrierMemory) Add(ctx context.Context, item memory.MemoryItem) error {
+	err := m.Memory.Add(ctx, item)
+	m.mu.Lock()
+	if m.pending--; m.pending == 0 {
+		close(m.ready)
+	}
+	m.mu.Unlock()
+	return err
+}
+
+func (m *barrierMemory) GetRecent(ctx context.Context, n int) ([]memory.MemoryItem, error) {
+	select {
+	case <-m.ready:
+	case <-time.After(5 * time.Second):
+	}
+	return m.Memory.GetRecent(ctx, n)
+}
+
+func TestLLMAgent_ConcurrentRunsKeepMemoriesApart(t *testing.T) {
+	inputs := []string{"alpha secret", "bravo secret"}
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: textReply("done")})
+	agent := NewLLMAgent(LLMAgentConfig{Name: "shared", Provider: provider})
+	agent.memory = &barrierMemory{Memory: memory.NewInMemory(memory.Config{}), pending: len(inputs), ready: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input string) {
+			defer wg.Done()
+			if _, err := agent.Run(context.Background(), input); err != nil {
+				t.Errorf("%s: unexpected error: %v", input, err)
+			}
+		}(input)
+	}
+	wg.Wait()
+
+	requests := provider.Requests()
+	if len(requests) != len(inputs) {
+		t.Fatalf("expected %d requests, got %d", len(inputs), len(requests))
+	}
+	for _, req := range requests {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		seen := 0
+		for _, input := range inputs {
+			if strings.Contains(prompt, input) {
+				seen++
+			}
+		}
+		if seen != 1 {
+			t.Errorf("expected the prompt to hold only its own input, got %q", prompt)
+		}
+	}
+}
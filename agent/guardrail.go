@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/voocel/mas/llm"
+)
+
+// GuardrailAction is the decision of a guardrail
+type GuardrailAction string
+
+const (
+	// GuardrailAllow lets the content through unchanged
+	GuardrailAllow GuardrailAction = "allow"
+	// GuardrailRewrite replaces the content with GuardrailResult.Content
+	GuardrailRewrite GuardrailAction = "rewrite"
+	// GuardrailBlock stops the call with a GuardrailError
+	GuardrailBlock GuardrailAction = "block"
+)
+
+// GuardrailStage tells whether a guardrail checked the input or the output of an agent
+type GuardrailStage string
+
+const (
+	GuardrailStageInput  GuardrailStage = "input"
+	GuardrailStageOutput GuardrailStage = "output"
+)
+
+// GuardrailResult is what a guardrail decided about a piece of content
+type GuardrailResult struct {
+	Action GuardrailAction `json:"action"`
+	// Content replaces the checked content when Action is GuardrailRewrite
+	Content string `json:"content,omitempty"`
+	// Reason explains a block or rewrite
+	Reason string `json:"reason,omitempty"`
+}
+
+// Guardrail checks the content entering an agent through Perceive or leaving it through Act.
+// Guardrails see content as text; structured inputs are checked in their prompt form and
+// replaced by the rewritten text when a guardrail rewrites them.
+type Guardrail interface {
+	Name() string
+	Check(ctx context.Context, content string) (GuardrailResult, error)
+}
+
+// ErrGuardrailBlocked matches every GuardrailError with errors.Is
+var ErrGuardrailBlocked = errors.New("blocked by guardrail")
+
+// GuardrailError reports content a guardrail blocked
+type GuardrailError struct {
+	Agent     string         `json:"agent"`
+	Guardrail string         `json:"guardrail"`
+	Stage     GuardrailStage `json:"stage"`
+	Reason    string         `json:"reason"`
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("agent %s: %s blocked by guardrail %s: %s", e.Agent, e.Stage, e.Guardrail, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrGuardrailBlocked) hold for every GuardrailError
+func (e *GuardrailError) Is(target error) bool {
+	return target == ErrGuardrailBlocked
+}
+
+// applyGuardrails runs the guardrails in order, each seeing the content the previous one
+// let through. It returns the final content and whether any guardrail rewrote it.
+func (a *LLMAgent) applyGuardrails(ctx context.Context, stage GuardrailStage, guardrails []Guardrail, content string) (string, bool, error) {
+	rewritten := false
+	for _, guardrail := range guardrails {
+		result, err := guardrail.Check(ctx, content)
+		if err != nil {
+			return "", false, fmt.Errorf("guardrail %s failed: %w", guardrail.Name(), err)
+		}
+
+		switch result.Action {
+		case GuardrailBlock:
+			a.log(ctx).WarnContext(ctx, "guardrail blocked content", "guardrail", guardrail.Name(), "stage", stage)
+			return "", false, &GuardrailError{Agent: a.Name(), Guardrail: guardrail.Name(), Stage: stage, Reason: result.Reason}
+		case GuardrailRewrite:
+			a.log(ctx).DebugContext(ctx, "guardrail rewrote content", "guardrail", guardrail.Name(), "stage", stage)
+			content = result.Content
+			rewritten = true
+		}
+	}
+	return content, rewritten, nil
+}
+
+// guardInput checks an input before it is perceived. Rewritten inputs become text, except
+// for an ImageInput whose prompt is rewritten in place.
+func (a *LLMAgent) guardInput(ctx context.Context, input interface{}) (interface{}, error) {
+	if len(a.inputGuardrails) == 0 {
+		return input, nil
+	}
+
+	image, isImage := input.(ImageInput)
+	content := formatInput(input)
+	if isImage {
+		content = image.Prompt
+	}
+
+	content, rewritten, err := a.applyGuardrails(ctx, GuardrailStageInput, a.inputGuardrails, content)
+	if err != nil || !rewritten {
+		return input, err
+	}
+	if isImage {
+		image.Prompt = content
+		return image, nil
+	}
+	return content, nil
+}
+
+// guardOutput checks an output before it is returned. Rewritten outputs become text.
+func (a *LLMAgent) guardOutput(ctx context.Context, output interface{}) (interface{}, error) {
+	if len(a.outputGuardrails) == 0 {
+		return output, nil
+	}
+
+	content, rewritten, err := a.applyGuardrails(ctx, GuardrailStageOutput, a.outputGuardrails, formatToolOutput(output))
+	if err != nil || !rewritten {
+		return output, err
+	}
+	return content, nil
+}
+
+// guardResult checks the final answer of a run, keeping its structured form in step
+func (a *LLMAgent) guardResult(ctx context.Context, result *RunResult) error {
+	if len(a.outputGuardrails) == 0 {
+		return nil
+	}
+
+	content, rewritten, err := a.applyGuardrails(ctx, GuardrailStageOutput, a.outputGuardrails, result.Output)
+	if err != nil || !rewritten {
+		return err
+	}
+	result.Output = content
+	if result.Structured != nil {
+		result.Structured = json.RawMessage(content)
+	}
+	return nil
+}
+
+// GuardrailFunc adapts a function to a Guardrail
+type GuardrailFunc struct {
+	GuardrailName string
+	Fn            func(ctx context.Context, content string) (GuardrailResult, error)
+}
+
+func (g GuardrailFunc) Name() string { return g.GuardrailName }
+
+func (g GuardrailFunc) Check(ctx context.Context, content string) (GuardrailResult, error) {
+	return g.Fn(ctx, content)
+}
+
+// RegexRule redacts or blocks the matches of a pattern
+type RegexRule struct {
+	// Label names the rule in block reasons, such as "email"
+	Label   string
+	Pattern *regexp.Regexp
+	// Replacement is substituted for every match, "[REDACTED <label>]" when empty
+	Replacement string
+	// Block stops the content instead of redacting it
+	Block bool
+}
+
+// RegexGuardrail redacts or blocks content matching its rules
+type RegexGuardrail struct {
+	name  string
+	rules []RegexRule
+}
+
+// NewRegexGuardrail creates a guardrail applying rules in order
+func NewRegexGuardrail(name string, rules ...RegexRule) *RegexGuardrail {
+	return &RegexGuardrail{name: name, rules: rules}
+}
+
+// PIIRules match common personal data: email addresses, credit card and US social security
+// numbers, phone numbers and IPv4 addresses
+var PIIRules = []RegexRule{
+	{Label: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{Label: "card", Pattern: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)},
+	{Label: "ssn", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{Label: "phone", Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?\(?\b\d{3}\)?[ .\-]?\d{3}[ .\-]?\d{4}\b`)},
+	{Label: "ip", Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)},
+}
+
+// NewPIIGuardrail creates a guardrail redacting PIIRules
+func NewPIIGuardrail() *RegexGuardrail {
+	return NewRegexGuardrail("pii", PIIRules...)
+}
+
+func (g *RegexGuardrail) Name() string { return g.name }
+
+func (g *RegexGuardrail) Check(ctx context.Context, content string) (GuardrailResult, error) {
+	redacted := content
+	var labels []string
+	for _, rule := range g.rules {
+		if !rule.Pattern.MatchString(redacted) {
+			continue
+		}
+		if rule.Block {
+			return GuardrailResult{Action: GuardrailBlock, Reason: "content matches " + rule.Label}, nil
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED " + strings.ToUpper(rule.Label) + "]"
+		}
+		redacted = rule.Pattern.ReplaceAllLiteralString(redacted, replacement)
+		labels = append(labels, rule.Label)
+	}
+
+	if len(labels) == 0 {
+		return GuardrailResult{Action: GuardrailAllow}, nil
+	}
+	return GuardrailResult{Action: GuardrailRewrite, Content: redacted, Reason: "redacted " + strings.Join(labels, ", ")}, nil
+}
+
+// MaxLengthGuardrail limits content to a number of characters
+type MaxLengthGuardrail struct {
+	maxChars int
+	truncate bool
+}
+
+// NewMaxLengthGuardrail creates a guardrail blocking content longer than maxChars, or cutting
+// it down to maxChars when truncate is set
+func NewMaxLengthGuardrail(maxChars int, truncate bool) *MaxLengthGuardrail {
+	return &MaxLengthGuardrail{maxChars: maxChars, truncate: truncate}
+}
+
+func (g *MaxLengthGuardrail) Name() string { return "max_length" }
+
+func (g *MaxLengthGuardrail) Check(ctx context.Context, content string) (GuardrailResult, error) {
+	length := utf8.RuneCountInString(content)
+	if length <= g.maxChars {
+		return GuardrailResult{Action: GuardrailAllow}, nil
+	}
+	reason := fmt.Sprintf("content has %d characters, the limit is %d", length, g.maxChars)
+	if !g.truncate {
+		return GuardrailResult{Action: GuardrailBlock, Reason: reason}, nil
+	}
+	return GuardrailResult{Action: GuardrailRewrite, Content: string([]rune(content)[:g.maxChars]), Reason: reason}, nil
+}
+
+// JSONGuardrail requires content to be JSON, optionally matching a schema
+type JSONGuardrail struct {
+	format *llm.ResponseFormat
+}
+
+// NewJSONGuardrail creates a guardrail blocking content that is not a JSON value matching
+// schema, which may be nil. JSON wrapped in code fences or prose is rewritten to the bare value.
+func NewJSONGuardrail(schema json.RawMessage) *JSONGuardrail {
+	return &JSONGuardrail{format: llm.JSONSchemaFormat("guardrail", schema)}
+}
+
+func (g *JSONGuardrail) Name() string { return "json" }
+
+func (g *JSONGuardrail) Check(ctx context.Context, content string) (GuardrailResult, error) {
+	data, err := llm.ParseStructuredOutput(content, g.format)
+	if err != nil {
+		reason := err.Error()
+		var llmErr llm.LLMError
+		if errors.As(err, &llmErr) && llmErr.Details != "" {
+			reason = llmErr.Details
+		}
+		return GuardrailResult{Action: GuardrailBlock, Reason: reason}, nil
+	}
+	if string(data) == strings.TrimSpace(content) {
+		return GuardrailResult{Action: GuardrailAllow}, nil
+	}
+	return GuardrailResult{Action: GuardrailRewrite, Content: string(data), Reason: "extracted the JSON value"}, nil
+}
+
+// LLMJudgeGuardrail asks a model whether content complies with a policy
+type LLMJudgeGuardrail struct {
+	provider llm.Provider
+	model    string
+	policy   string
+}
+
+// judgeVerdict is the structured answer of the judge model
+type judgeVerdict struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// NewLLMJudgeGuardrail creates a guardrail blocking content the model finds in breach of
+// policy. An empty model uses the provider's default model.
+func NewLLMJudgeGuardrail(provider llm.Provider, model, policy string) *LLMJudgeGuardrail {
+	return &LLMJudgeGuardrail{provider: provider, model: model, policy: policy}
+}
+
+func (g *LLMJudgeGuardrail) Name() string { return "llm_judge" }
+
+func (g *LLMJudgeGuardrail) Check(ctx context.Context, content string) (GuardrailResult, error) {
+	req := llm.ChatCompletionRequest{
+		Model: g.model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: "You review content against a policy. Decide whether the content complies and give a short reason.\n\nPolicy:\n" + g.policy},
+			{Role: llm.RoleUser, Content: content},
+		},
+		Temperature: 0,
+	}
+
+	verdict, _, err := llm.CompleteAs[judgeVerdict](ctx, g.provider, req, 0)
+	if err != nil {
+		return GuardrailResult{}, err
+	}
+	if !verdict.Allowed {
+		return GuardrailResult{Action: GuardrailBlock, Reason: verdict.Reason}, nil
+	}
+	return GuardrailResult{Action: GuardrailAllow}, nil
+}
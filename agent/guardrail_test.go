@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+)
+
+/**
+ * Norwegian-style doc: Like the customs officers at the border crossing, these tests make sure nothing forbidden slips in or out, that personal papers are blacked out before they are passed along, and that a refused traveller is told exactly which officer turned them away.
+ */
+
+func TestRegexGuardrail_RedactsPII(t *testing.T) {
+	result, err := NewPIIGuardrail().Check(context.Background(), "Mail kari@example.no or call 555-123-4567 from 10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Action != GuardrailRewrite {
+		t.Fatalf("expected a rewrite, got %s", result.Action)
+	}
+	want := "Mail [REDACTED EMAIL] or call [REDACTED PHONE] from [REDACTED IP]"
+	if result.Content != want {
+		t.Errorf("expected %q, got %q", want, result.Content)
+	}
+
+	result, _ = NewPIIGuardrail().Check(context.Background(), "nothing personal here")
+	if result.Action != GuardrailAllow {
+		t.Errorf("expected clean text to pass, got %s", result.Action)
+	}
+}
+
+func TestRegexGuardrail_Block(t *testing.T) {
+	guardrail := NewRegexGuardrail("secrets", RegexRule{Label: "api key", Pattern: PIIRules[0].Pattern, Block: true})
+	result, _ := guardrail.Check(context.Background(), "key for ola@example.com")
+	if result.Action != GuardrailBlock || result.Reason != "content matches api key" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestMaxLengthGuardrail(t *testing.T) {
+	result, _ := NewMaxLengthGuardrail(4, false).Check(context.Background(), "blåbær")
+	if result.Action != GuardrailBlock {
+		t.Errorf("expected a block, got %s", result.Action)
+	}
+	result, _ = NewMaxLengthGuardrail(4, true).Check(context.Background(), "blåbær")
+	if result.Action != GuardrailRewrite || result.Content != "blåb" {
+		t.Errorf("expected a truncation on characters, got %+v", result)
+	}
+}
+
+func TestJSONGuardrail(t *testing.T) {
+	guardrail := NewJSONGuardrail([]byte(`{"type":"object","properties":{"n":{"type":"integer"}},"required":["n"]}`))
+
+	cases := []struct {
+		content string
+		action  GuardrailAction
+	}{
+		{`{"n":1}`, GuardrailAllow},
+		{"```json\n{\"n\":1}\n```", GuardrailRewrite},
+		{`{"m":1}`, GuardrailBlock},
+		{"no json", GuardrailBlock},
+	}
+	for _, c := range cases {
+		result, err := guardrail.Check(context.Background(), c.content)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Action != c.action {
+			t.Errorf("%q: expected %s, got %+v", c.content, c.action, result)
+		}
+	}
+}
+
+func TestLLMJudgeGuardrail(t *testing.T) {
+	provider := llm.NewScriptedProvider(
+		llm.ScriptRule{Match: llm.MatchLastMessageContains("password"), Response: llm.TextResponse(`{"allowed":false,"reason":"leaks a credential"}`)},
+		llm.ScriptRule{Response: llm.TextResponse(`{"allowed":true,"reason":"fine"}`)},
+	)
+	guardrail := NewLLMJudgeGuardrail(provider, "", "Never reveal credentials.")
+
+	result, err := guardrail.Check(context.Background(), "the password is hunter2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Action != GuardrailBlock || result.Reason != "leaks a credential" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result, _ := guardrail.Check(context.Background(), "the weather is fine"); result.Action != GuardrailAllow {
+		t.Errorf("expected allow, got %+v", result)
+	}
+	if !strings.Contains(provider.Requests()[0].Messages[0].Content, "Never reveal credentials.") {
+		t.Errorf("expected the policy in the system prompt")
+	}
+}
+
+func TestLLMAgent_InputGuardrailRewritesPrompt(t *testing.T) {
+	provider := llm.NewSequenceProvider(textReply("ok"))
+	agent := NewLLMAgent(LLMAgentConfig{Name: "support", Provider: provider, InputGuardrails: []Guardrail{NewPIIGuardrail()}})
+
+	if _, err := agent.Run(context.Background(), "my email is per@example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	prompt := provider.Requests()[0].Messages[1].Content
+	if strings.Contains(prompt, "per@example.com") || !strings.Contains(prompt, "[REDACTED EMAIL]") {
+		t.Errorf("expected the email to be redacted, got %q", prompt)
+	}
+	memories, _ := agent.memory.GetRecent(context.Background(), 10)
+	for _, m := range memories {
+		if strings.Contains(formatInput(m.Content), "per@example.com") {
+			t.Errorf("expected the memory to hold the redacted input")
+		}
+	}
+}
+
+func TestLLMAgent_OutputGuardrailBlocksAnswer(t *testing.T) {
+	provider := llm.NewSequenceProvider(textReply("a very long answer"))
+	agent := NewLLMAgent(LLMAgentConfig{Name: "terse", Provider: provider, OutputGuardrails: []Guardrail{NewMaxLengthGuardrail(5, false)}})
+
+	_, err := agent.Process(context.Background(), "hello")
+	if !errors.Is(err, ErrGuardrailBlocked) {
+		t.Fatalf("expected a guardrail error, got %v", err)
+	}
+	var blocked *GuardrailError
+	if !errors.As(err, &blocked) || blocked.Agent != "terse" || blocked.Stage != GuardrailStageOutput || blocked.Guardrail != "max_length" {
+		t.Errorf("unexpected guardrail error: %+v", blocked)
+	}
+}
+
+func TestLLMAgent_ActOutputGuardrail(t *testing.T) {
+	provider := llm.NewSequenceProvider(textReply("call 555-123-4567"))
+	agent := NewLLMAgent(LLMAgentConfig{Name: "support", Provider: provider, OutputGuardrails: []Guardrail{NewPIIGuardrail()}})
+
+	ctx := context.Background()
+	if err := agent.Perceive(ctx, "how do I reach you?"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := agent.Think(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := agent.Act(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "call [REDACTED PHONE]" {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
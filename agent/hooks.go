@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/voocel/mas/llm"
+)
+
+// Hooks observe an agent's lifecycle, nil fields are skipped. Hooks run synchronously on
+// the goroutine of the call they observe, so they must be quick and, like the agent, safe
+// for concurrent use. The task a call belongs to is available from llm.RequestTags(ctx).
+//
+// The On...Start style hooks returning an error veto the step: a failing OnPerceive or
+// OnLLMRequest aborts the run, a failing OnToolStart skips the tool and reports the error
+// to the model as the tool result.
+type Hooks struct {
+	// OnPerceive is called with every input before it is recorded
+	OnPerceive func(ctx context.Context, agent string, input interface{}) error
+
+	// OnLLMRequest is called before every completion request
+	OnLLMRequest func(ctx context.Context, agent string, req llm.ChatCompletionRequest) error
+
+	// OnLLMResponse is called after every completion, with err set when it failed
+	OnLLMResponse func(ctx context.Context, agent string, req llm.ChatCompletionRequest, resp *llm.ChatCompletionResponse, err error, latency time.Duration)
+
+	// OnToolStart is called before a tool runs, with the decoded arguments
+	OnToolStart func(ctx context.Context, agent string, call llm.ToolCall, params map[string]interface{}) error
+
+	// OnToolEnd is called after a tool ran, with err set when it failed
+	OnToolEnd func(ctx context.Context, agent string, call llm.ToolCall, result interface{}, err error, duration time.Duration)
+
+	// OnActResult is called with the result of Act and with the final answer of a run
+	OnActResult func(ctx context.Context, agent string, result interface{})
+
+	// OnError is called when a perceive, think, act or run fails
+	OnError func(ctx context.Context, agent string, err error)
+}
+
+var (
+	globalHooks   []*Hooks
+	globalHooksMu sync.RWMutex
+)
+
+// RegisterGlobalHooks installs hooks observing every agent, they run before the agent's
+// own hooks. The returned function removes them again.
+func RegisterGlobalHooks(hooks Hooks) (unregister func()) {
+	h := &hooks
+	globalHooksMu.Lock()
+	globalHooks = append(globalHooks, h)
+	globalHooksMu.Unlock()
+
+	return func() {
+		globalHooksMu.Lock()
+		defer globalHooksMu.Unlock()
+		for i, registered := range globalHooks {
+			if registered == h {
+				globalHooks = append(globalHooks[:i:i], globalHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// AddHooks installs hooks observing this agent only
+func (a *LLMAgent) AddHooks(hooks Hooks) {
+	a.hooksMu.Lock()
+	defer a.hooksMu.Unlock()
+	a.agentHooks = append(a.agentHooks, hooks)
+}
+
+// hookSet is the snapshot of global and agent hooks a call fires
+type hookSet struct {
+	agent string
+	hooks []Hooks
+}
+
+// hooks returns the hooks currently installed for the agent, global hooks first
+func (a *LLMAgent) hooks() hookSet {
+	set := hookSet{agent: a.Name()}
+
+	globalHooksMu.RLock()
+	for _, h := range globalHooks {
+		set.hooks = append(set.hooks, *h)
+	}
+	globalHooksMu.RUnlock()
+
+	a.hooksMu.RLock()
+	set.hooks = append(set.hooks, a.agentHooks...)
+	a.hooksMu.RUnlock()
+	return set
+}
+
+func (s hookSet) perceive(ctx context.Context, input interface{}) error {
+	for _, h := range s.hooks {
+		if h.OnPerceive != nil {
+			if err := h.OnPerceive(ctx, s.agent, input); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s hookSet) llmRequest(ctx context.Context, req llm.ChatCompletionRequest) error {
+	for _, h := range s.hooks {
+		if h.OnLLMRequest != nil {
+			if err := h.OnLLMRequest(ctx, s.agent, req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s hookSet) llmResponse(ctx context.Context, req llm.ChatCompletionRequest, resp *llm.ChatCompletionResponse, err error, latency time.Duration) {
+	for _, h := range s.hooks {
+		if h.OnLLMResponse != nil {
+			h.OnLLMResponse(ctx, s.agent, req, resp, err, latency)
+		}
+	}
+}
+
+func (s hookSet) toolStart(ctx context.Context, call llm.ToolCall, params map[string]interface{}) error {
+	for _, h := range s.hooks {
+		if h.OnToolStart != nil {
+			if err := h.OnToolStart(ctx, s.agent, call, params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s hookSet) toolEnd(ctx context.Context, call llm.ToolCall, result interface{}, err error, duration time.Duration) {
+	for _, h := range s.hooks {
+		if h.OnToolEnd != nil {
+			h.OnToolEnd(ctx, s.agent, call, result, err, duration)
+		}
+	}
+}
+
+func (s hookSet) actResult(ctx context.Context, result interface{}) {
+	for _, h := range s.hooks {
+		if h.OnActResult != nil {
+			h.OnActResult(ctx, s.agent, result)
+		}
+	}
+}
+
+// error reports err to the hooks and returns it, so call sites can write return hooks.error(ctx, err)
+func (s hookSet) error(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, h := range s.hooks {
+		if h.OnError != nil {
+			h.OnError(ctx, s.agent, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like the harbour master's logbook, these tests make sure every boat that leaves and returns is written down in order, and that the harbour master may keep a boat at the quay when the weather looks wrong.
+ */
+
+// eventRecorder collects hook events as short strings
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+func (r *eventRecorder) hooks() Hooks {
+	return Hooks{
+		OnPerceive: func(ctx context.Context, agent string, input interface{}) error {
+			r.add("perceive")
+			return nil
+		},
+		OnLLMRequest: func(ctx context.Context, agent string, req llm.ChatCompletionRequest) error {
+			r.add("request")
+			return nil
+		},
+		OnLLMResponse: func(ctx context.Context, agent string, req llm.ChatCompletionRequest, resp *llm.ChatCompletionResponse, err error, latency time.Duration) {
+			r.add("response")
+		},
+		OnToolStart: func(ctx context.Context, agent string, call llm.ToolCall, params map[string]interface{}) error {
+			r.add("tool_start:" + call.Function.Name)
+			return nil
+		},
+		OnToolEnd: func(ctx context.Context, agent string, call llm.ToolCall, result interface{}, err error, duration time.Duration) {
+			r.add("tool_end:" + call.Function.Name)
+		},
+		OnActResult: func(ctx context.Context, agent string, result interface{}) {
+			r.add("result")
+		},
+		OnError: func(ctx context.Context, agent string, err error) {
+			r.add("error")
+		},
+	}
+}
+
+func TestHooks_RunEventsInOrder(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		textReply("3"),
+	)
+	recorder := &eventRecorder{}
+	agent := NewLLMAgent(LLMAgentConfig{Name: "calc", Provider: provider, Tools: []tools.Tool{&mockTool{}}, Hooks: []Hooks{recorder.hooks()}})
+
+	if _, err := agent.Run(context.Background(), "add 1 and 2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "perceive,request,response,tool_start:adder,tool_end:adder,request,response,result"
+	if got := recorder.String(); got != want {
+		t.Errorf("expected events %s, got %s", want, got)
+	}
+}
+
+func TestHooks_GlobalHooksRunFirst(t *testing.T) {
+	recorder := &eventRecorder{}
+	unregister := RegisterGlobalHooks(Hooks{OnActResult: func(ctx context.Context, agent string, result interface{}) {
+		recorder.add("global:" + agent)
+	}})
+
+	agent := NewLLMAgent(LLMAgentConfig{Name: "echo", Provider: llm.NewSequenceProvider(textReply("hi"), textReply("hi"))})
+	agent.AddHooks(Hooks{OnActResult: func(ctx context.Context, agent string, result interface{}) {
+		recorder.add("agent:" + agent)
+	}})
+
+	if _, err := agent.Process(context.Background(), "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := recorder.String(); got != "global:echo,agent:echo" {
+		t.Errorf("unexpected events: %s", got)
+	}
+
+	unregister()
+	if _, err := agent.Process(context.Background(), "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := recorder.String(); got != "global:echo,agent:echo,agent:echo" {
+		t.Errorf("expected the global hooks to be removed, got %s", got)
+	}
+}
+
+func TestHooks_ToolStartVetoReachesModel(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		textReply("I was not allowed to add."),
+	)
+	recorder := &eventRecorder{}
+	agent := NewLLMAgent(LLMAgentConfig{Name: "calc", Provider: provider, Tools: []tools.Tool{&mockTool{}}})
+	agent.AddHooks(Hooks{OnToolStart: func(ctx context.Context, agent string, call llm.ToolCall, params map[string]interface{}) error {
+		return errors.New("adder is disabled")
+	}})
+	agent.AddHooks(recorder.hooks())
+
+	result, err := agent.Run(context.Background(), "add 1 and 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.Steps[0].ToolResults[0].Error; !strings.Contains(got, "adder is disabled") {
+		t.Errorf("expected the veto as tool error, got %q", got)
+	}
+	if strings.Contains(recorder.String(), "tool_") {
+		t.Errorf("expected the tool not to run, got events %s", recorder.String())
+	}
+}
+
+func TestHooks_RequestVetoReportsError(t *testing.T) {
+	provider := llm.NewSequenceProvider(textReply("never sent"))
+	recorder := &eventRecorder{}
+	veto := errors.New("request blocked")
+	agent := NewLLMAgent(LLMAgentConfig{Name: "guarded", Provider: provider, Hooks: []Hooks{
+		{OnLLMRequest: func(ctx context.Context, agent string, req llm.ChatCompletionRequest) error { return veto }},
+		recorder.hooks(),
+	}})
+
+	_, err := agent.Run(context.Background(), "hello")
+	if !errors.Is(err, veto) {
+		t.Fatalf("expected the veto error, got %v", err)
+	}
+	if len(provider.Requests()) != 0 {
+		t.Errorf("expected no request to reach the provider")
+	}
+	if got := recorder.String(); got != "perceive,error" {
+		t.Errorf("unexpected events: %s", got)
+	}
+}
+
+func TestHooks_StepByStepCycle(t *testing.T) {
+	provider := llm.NewSequenceProvider(toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)))
+	recorder := &eventRecorder{}
+	agent := NewLLMAgent(LLMAgentConfig{Name: "calc", Provider: provider, Tools: []tools.Tool{&mockTool{}}, Hooks: []Hooks{recorder.hooks()}})
+
+	ctx := context.Background()
+	if err := agent.Perceive(ctx, "add 1 and 2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := agent.Think(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := agent.Act(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "perceive,request,response,tool_start:adder,tool_end:adder,result"
+	if got := recorder.String(); got != want {
+		t.Errorf("expected events %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/voocel/mas/llm"
+)
+
+// ImageInput is an input for vision agents: a text prompt with images attached. Images
+// may be http(s) URLs, data URLs, local file paths or bare base64 data, use
+// llm.ImageFromBytes for raw bytes.
+type ImageInput struct {
+	Prompt string   `json:"prompt"`
+	Images []string `json:"images"`
+}
+
+// resolve reads local files and base64 into data URLs so every provider receives URLs
+func (in ImageInput) resolve() (ImageInput, error) {
+	resolved := ImageInput{Prompt: in.Prompt, Images: make([]string, 0, len(in.Images))}
+	for i, image := range in.Images {
+		url, err := llm.ResolveImage(image)
+		if err != nil {
+			return in, fmt.Errorf("image %d: %w", i, err)
+		}
+		resolved.Images = append(resolved.Images, url)
+	}
+	return resolved, nil
+}
+
+// memoryContent summarizes the input for memory, images are counted rather than stored
+func (in ImageInput) memoryContent() string {
+	return fmt.Sprintf("%s [%d image(s)]", in.Prompt, len(in.Images))
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"regexp"
+	"log/slog"
 	"strings"
 	"sync"
 	"time"
@@ -20,29 +19,86 @@ import (
 
 // LLMAgentConfig contains configuration parameters for creating an LLM agent
 type LLMAgentConfig struct {
-	ID           string
-	Name         string
-	Description  string
-	MemoryConfig memory.Config
-	Tools        []tools.Tool
-	Provider     llm.Provider
-	SystemPrompt string
-	MaxTokens    int
-	Temperature  float64
-	Knowledge    knowledge.Graph
+	ID            string
+	Name          string
+	Description   string
+	MemoryConfig  memory.Config
+	Tools         []tools.Tool
+	Provider      llm.Provider
+	SystemPrompt  string
+	MaxTokens     int
+	Temperature   float64
+	Knowledge     knowledge.Graph
+	MaxIterations int
+
+	// Model is requested from the provider, empty uses the provider's default model
+	Model string
+	// ContextWindow overrides the model's context window from the llm table when fitting the prompt
+	ContextWindow int
+	// TokenCounter overrides the counter registered for the model
+	TokenCounter llm.TokenCounter
+	// Budget caps the tokens and cost this agent may spend over its lifetime
+	Budget llm.Budget
+	// ResponseFormat makes the final answer JSON matching a schema, see llm.JSONSchemaFormatFor
+	ResponseFormat *llm.ResponseFormat
+	// MaxRepairs is how often an answer failing the schema is sent back for correction,
+	// llm.DefaultMaxRepairs when zero and none when negative
+	MaxRepairs int
+	// Logger receives the agent's diagnostics, slog.Default() when nil. Prompts, replies
+	// and tool arguments are redacted, see llm.RevealContent.
+	Logger *slog.Logger
+	// Hooks observe the agent's lifecycle, more can be added with AddHooks or RegisterGlobalHooks
+	Hooks []Hooks
+	// InputGuardrails check every input before it is perceived
+	InputGuardrails []Guardrail
+	// OutputGuardrails check the result of Act and the final answer of a run
+	OutputGuardrails []Guardrail
+	// Approver decides on calls of tools requiring approval, see tools.RequireApproval.
+	// Without one such calls are rejected.
+	Approver Approver
+	// MemorySummarizer condenses the recalled memories that do not fit the prompt. Without
+	// one they are left out, see NewLLMMemorySummarizer.
+	MemorySummarizer MemorySummarizer
 }
 
 // LLMAgent represents an agent based on a large language model
 type LLMAgent struct {
 	BaseAgent
-	provider       llm.Provider
-	systemPrompt   string
-	maxTokens      int
-	temperature    float64
-	state          map[string]interface{}
-	stateMu        sync.RWMutex
-	currentInput   interface{}
-	currentThought string
+	provider         llm.Provider
+	model            string
+	contextWindow    int
+	tokenCounter     llm.TokenCounter
+	budget           *llm.BudgetTracker
+	responseFormat   *llm.ResponseFormat
+	maxRepairs       int
+	logger           *slog.Logger
+	description      string
+	systemPrompt     string
+	maxTokens        int
+	temperature      float64
+	maxIterations    int
+	state            map[string]interface{}
+	stateMu          sync.RWMutex
+	sessions         map[string]*Session
+	sessionsMu       sync.Mutex
+	agentHooks       []Hooks
+	inputGuardrails  []Guardrail
+	outputGuardrails []Guardrail
+	approver         Approver
+	memorySummarizer MemorySummarizer
+	hooksMu          sync.RWMutex
+
+	// cycle is the state shared by the step-by-step Perceive, Think and Act calls.
+	// Process and Run keep their own runContext and never touch it.
+	cycle   runContext
+	cycleMu sync.Mutex
+}
+
+// runContext holds the data of one perceive-think-act cycle
+type runContext struct {
+	input     interface{}
+	thought   string
+	toolCalls []llm.ToolCall
 }
 
 // NewLLMAgent creates a new LLM agent
@@ -51,113 +107,277 @@ func NewLLMAgent(config LLMAgentConfig) *LLMAgent {
 		config.ID = uuid.New().String()
 	}
 
-	baseAgent := NewBaseAgent(config.Name)
-
 	// Create memory system
 	mem := memory.New(config.MemoryConfig)
 
-	// Set up tools and knowledge graph
-	baseAgent.tools = config.Tools
-	baseAgent.knowledge = config.Knowledge
-	baseAgent.memory = mem
+	maxIterations := DefaultMaxIterations
+	if config.MaxIterations > 0 {
+		maxIterations = config.MaxIterations
+	}
 
 	agent := &LLMAgent{
-		BaseAgent:    *baseAgent,
-		provider:     config.Provider,
-		systemPrompt: config.SystemPrompt,
-		maxTokens:    config.MaxTokens,
-		temperature:  config.Temperature,
-		state:        make(map[string]interface{}),
+		BaseAgent: BaseAgent{
+			name:      config.Name,
+			memory:    mem,
+			knowledge: config.Knowledge,
+			tools:     config.Tools,
+		},
+		provider:      config.Provider,
+		model:         config.Model,
+		contextWindow: config.ContextWindow,
+		tokenCounter:  config.TokenCounter,
+		systemPrompt:  config.SystemPrompt,
+		description:   config.Description,
+		maxTokens:     config.MaxTokens,
+		temperature:   config.Temperature,
+		maxIterations: maxIterations,
+		state:         make(map[string]interface{}),
 	}
+	agent.responseFormat = config.ResponseFormat
+	agent.agentHooks = append([]Hooks(nil), config.Hooks...)
+	agent.inputGuardrails = config.InputGuardrails
+	agent.outputGuardrails = config.OutputGuardrails
+	agent.approver = config.Approver
+	agent.memorySummarizer = config.MemorySummarizer
+	agent.maxRepairs = llm.DefaultMaxRepairs
+	if config.MaxRepairs != 0 {
+		agent.maxRepairs = max(config.MaxRepairs, 0)
+	}
+	if !config.Budget.IsZero() {
+		agent.budget = llm.NewBudgetTracker("agent "+config.Name, config.Budget)
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	agent.logger = logger.With(llm.LogKeyAgent, config.Name, llm.LogKeyModel, agent.GetModelName())
 
 	return agent
 }
 
-// Perceive handles input information in the perception phase
+// Perceive handles input information in the perception phase, starting a new cycle for
+// Think and Act. Calls driving the phases step by step must not overlap, use Process or
+// Run for concurrent work.
 func (a *LLMAgent) Perceive(ctx context.Context, input interface{}) error {
-	// Store current input
-	a.currentInput = input
+	input, err := a.perceive(ctx, input)
+	if err != nil {
+		return a.hooks().error(ctx, err)
+	}
+
+	a.cycleMu.Lock()
+	a.cycle = runContext{input: input}
+	a.cycleMu.Unlock()
+	return nil
+}
+
+// perceive resolves an input and records it in memory, returning the input to prompt with
+func (a *LLMAgent) perceive(ctx context.Context, input interface{}) (interface{}, error) {
+	if image, ok := input.(*ImageInput); ok && image != nil {
+		input = *image
+	}
+	if err := a.hooks().perceive(ctx, input); err != nil {
+		return nil, err
+	}
+	input, err := a.guardInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Images are resolved once here so that the memory and every request agree
+	content := input
+	if image, ok := input.(ImageInput); ok {
+		resolved, err := image.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("invalid image input: %w", err)
+		}
+		input = resolved
+		content = resolved.memoryContent()
+	}
 
 	// Add input to memory
 	if a.memory != nil {
 		err := a.memory.Add(ctx, memory.MemoryItem{
 			ID:        uuid.New().String(),
-			Content:   input,
+			Content:   content,
 			Type:      memory.TypeObservation,
 			CreatedAt: time.Now(),
-			Metadata:  map[string]interface{}{"source": "input"},
+			Metadata:  runMetadata(ctx, map[string]interface{}{"source": "input"}),
 		})
 		if err != nil {
-			return fmt.Errorf("failed to add input to memory: %w", err)
+			return nil, fmt.Errorf("failed to add input to memory: %w", err)
 		}
 	}
 
-	return nil
+	return input, nil
+}
+
+// currentCycle returns a copy of the step-by-step cycle state
+func (a *LLMAgent) currentCycle() runContext {
+	a.cycleMu.Lock()
+	defer a.cycleMu.Unlock()
+	return a.cycle
 }
 
 // Think processes information in the thinking phase
 func (a *LLMAgent) Think(ctx context.Context) error {
-	// Prepare prompt
-	prompt := a.preparePrompt()
+	a.log(ctx).DebugContext(ctx, "thinking")
 
-	log.Printf("Agent[%s] starting thinking phase", a.Name())
+	cycle := a.currentCycle()
+	messages, err := a.initialMessages(ctx, cycle.input)
+	if err != nil {
+		return a.hooks().error(ctx, err)
+	}
+	resp, err := a.complete(ctx, messages, a.responseFormat)
+	if err != nil {
+		return a.hooks().error(ctx, err)
+	}
 
-	// Call LLM for thinking
-	log.Printf("Agent[%s] sending request to %s: model=%s", a.Name(), a.provider.ID(), a.GetModelName())
-	log.Printf("Sending request...")
+	// Extract thinking result and any structured tool calls
+	cycle.toolCalls = nil
+	if len(resp.Choices) > 0 {
+		cycle.thought = resp.Choices[0].Message.Content
+		cycle.toolCalls = resp.Choices[0].Message.ToolCalls
+		a.log(ctx).LogAttrs(ctx, slog.LevelDebug, "thought", llm.Redact("reply", cycle.thought), slog.Int("tool_calls", len(cycle.toolCalls)))
+	} else {
+		a.log(ctx).WarnContext(ctx, "response has no choices")
+	}
 
-	resp, err := a.provider.ChatCompletion(ctx, llm.ChatCompletionRequest{
-		Messages: []llm.Message{
-			{Role: "system", Content: a.systemPrompt},
-			{Role: "user", Content: prompt},
-		},
+	a.cycleMu.Lock()
+	a.cycle = cycle
+	a.cycleMu.Unlock()
+
+	// Add thinking result to memory
+	return a.hooks().error(ctx, a.rememberThought(ctx, cycle.thought))
+}
+
+// initialMessages builds the opening system and user turns for an input
+func (a *LLMAgent) initialMessages(ctx context.Context, input interface{}) ([]llm.Message, error) {
+	prompt, err := a.preparePrompt(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	user := llm.Message{Role: llm.RoleUser, Content: prompt}
+	if image, ok := input.(ImageInput); ok {
+		user.Images = image.Images
+	}
+	return []llm.Message{
+		{Role: llm.RoleSystem, Content: a.systemPrompt},
+		user,
+	}, nil
+}
+
+// complete sends the conversation so far to the provider, advertising the agent's tools
+func (a *LLMAgent) complete(ctx context.Context, messages []llm.Message, format *llm.ResponseFormat) (*llm.ChatCompletionResponse, error) {
+	a.log(ctx).DebugContext(ctx, "sending llm request", llm.LogKeyProvider, a.provider.ID(), "messages", len(messages))
+
+	ctx, err := a.checkBudget(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := a.hooks()
+	req := a.buildRequest(ctx, messages, format)
+	if err := hooks.llmRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := a.provider.ChatCompletion(ctx, req)
+	hooks.llmResponse(ctx, req, resp, err, time.Since(start))
+	if err != nil {
+		a.log(ctx).ErrorContext(ctx, "llm request failed", "error", err)
+		return nil, fmt.Errorf("LLM call failed: %w", err)
+	}
+	llm.ChargeBudgets(ctx, resp)
+
+	return resp, nil
+}
+
+// checkBudget adds the agent's own budget to those of the task in ctx and fails with
+// llm.ErrBudgetExceeded when any of them cannot afford the prompt
+func (a *LLMAgent) checkBudget(ctx context.Context, messages []llm.Message) (context.Context, error) {
+	ctx = llm.WithBudgets(ctx, a.budget)
+	if err := llm.CheckBudgets(ctx, llm.CountMessageTokens(a.counter(), messages)); err != nil {
+		a.log(ctx).WarnContext(ctx, "budget exhausted", "error", err)
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// BudgetSpent returns the tokens and cost charged to the agent's budget, it is empty
+// when the agent has no budget
+func (a *LLMAgent) BudgetSpent() llm.UsageTotals {
+	if a.budget == nil {
+		return llm.UsageTotals{}
+	}
+	return a.budget.Spent()
+}
+
+// counter returns the configured token counter or the one registered for the model
+func (a *LLMAgent) counter() llm.TokenCounter {
+	if a.tokenCounter != nil {
+		return a.tokenCounter
+	}
+	return llm.TokenCounterFor(a.GetModelName())
+}
+
+// buildRequest wraps a conversation into a completion request with the agent's settings and tools
+func (a *LLMAgent) buildRequest(ctx context.Context, messages []llm.Message, format *llm.ResponseFormat) llm.ChatCompletionRequest {
+	req := llm.ChatCompletionRequest{
+		Model:       a.model,
+		Messages:    messages,
 		Temperature: a.temperature,
 		MaxTokens:   a.maxTokens,
 		Extra: map[string]interface{}{
-			"agent_name": a.Name(),
+			llm.TagAgent: a.Name(),
 		},
-	})
-	if err != nil {
-		log.Printf("Agent[%s] request failed: %v", a.Name(), err)
-		return fmt.Errorf("LLM call failed: %w", err)
 	}
-
-	log.Printf("Response received: status code=%d", 200) // Assuming status code is 200, may need to get from return value
-	log.Printf("Response data received")
-
-	// Extract thinking result
-	if len(resp.Choices) > 0 {
-		a.currentThought = resp.Choices[0].Message.Content
-		log.Printf("Agent[%s] successfully parsed response: %s", a.Name(), truncateString(a.currentThought, 100))
-	} else {
-		log.Printf("Agent[%s] response has no choice results", a.Name())
+	if agentTools := a.runTools(ctx); len(agentTools) > 0 {
+		req.Tools = tools.ConvertToolsToFunctions(agentTools)
 	}
+	return llm.ApplyResponseFormat(a.provider, req, format)
+}
 
-	// Add thinking result to memory
-	if a.memory != nil {
-		err := a.memory.Add(ctx, memory.MemoryItem{
-			ID:        uuid.New().String(),
-			Content:   a.currentThought,
-			Type:      memory.TypeThought,
-			CreatedAt: time.Now(),
-			Metadata:  map[string]interface{}{"source": "llm"},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add thought to memory: %w", err)
-		}
+// rememberThought stores a model response in memory
+func (a *LLMAgent) rememberThought(ctx context.Context, thought string) error {
+	if a.memory == nil {
+		return nil
 	}
 
+	err := a.memory.Add(ctx, memory.MemoryItem{
+		ID:        uuid.New().String(),
+		Content:   thought,
+		Type:      memory.TypeThought,
+		CreatedAt: time.Now(),
+		Metadata:  runMetadata(ctx, map[string]interface{}{"source": "llm"}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add thought to memory: %w", err)
+	}
 	return nil
 }
 
+// Description returns what the agent does, as configured
+func (a *LLMAgent) Description() string {
+	return a.description
+}
+
 // GetModelName returns the current model name being used
 func (a *LLMAgent) GetModelName() string {
+	if a.model != "" {
+		return a.model
+	}
 	// Here we need to get the model name from the Provider, since the interface might not provide it, returning a mock value
 	// Ideally, this should be obtained from the Provider
 	return "gpt-4o"
 }
 
-// Function to truncate string, used for truncating long content in log output
+// log returns the agent's logger with the task tags carried by ctx
+func (a *LLMAgent) log(ctx context.Context) *slog.Logger {
+	return llm.ContextLogger(ctx, a.logger)
+}
+
+// truncateString shortens s to maxLen bytes for error messages
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -167,196 +387,231 @@ func truncateString(s string, maxLen int) string {
 
 // Act executes decisions and returns results in the action phase
 func (a *LLMAgent) Act(ctx context.Context) (interface{}, error) {
-	// Check if thinking result contains tool call
-	fmt.Println("========11111=========")
-	fmt.Println(a.currentThought)
-	fmt.Println("========11111=========")
-	if isToolCall(a.currentThought) {
-		log.Printf("Agent[%s] detected tool call intent, parsing tool call", a.Name())
-
-		// Parse tool call
-		toolName, params, err := parseToolCall(a.currentThought)
-		if err != nil {
-			log.Printf("Agent[%s] failed to parse tool call: %v", a.Name(), err)
-			return nil, fmt.Errorf("failed to parse tool call: %w", err)
-		}
-
-		log.Printf("Agent[%s] successfully parsed tool call: tool=%s, params=%+v", a.Name(), toolName, params)
+	hooks := a.hooks()
 
-		// Call tool
-		result, err := a.callTool(ctx, toolName, params)
-		if err != nil {
-			return nil, fmt.Errorf("tool call failed: %w", err)
-		}
+	// Check if thinking result contains tool call
+	cycle := a.currentCycle()
+	if len(cycle.toolCalls) > 0 {
+		a.log(ctx).DebugContext(ctx, "acting on tool calls", "tool_calls", len(cycle.toolCalls))
 
-		// Add tool call result to memory
-		if a.memory != nil {
-			err := a.memory.Add(ctx, memory.MemoryItem{
-				ID:        uuid.New().String(),
-				Content:   result,
-				Type:      memory.TypeAction,
-				CreatedAt: time.Now(),
-				Metadata: map[string]interface{}{
-					"tool":   toolName,
-					"params": params,
-				},
-			})
+		results := make([]interface{}, 0, len(cycle.toolCalls))
+		for _, call := range cycle.toolCalls {
+			result, err := a.runToolCall(ctx, call)
 			if err != nil {
-				return nil, fmt.Errorf("failed to add tool call result to memory: %w", err)
+				return nil, hooks.error(ctx, err)
 			}
+			results = append(results, result)
 		}
 
-		return result, nil
+		// A single call keeps the historical return shape of the raw tool result
+		if len(results) == 1 {
+			return a.actResult(ctx, hooks, results[0])
+		}
+		return a.actResult(ctx, hooks, results)
 	}
 
 	// If no tool call, return thinking result directly
-	log.Printf("Agent[%s] did not detect tool call, returning thinking result directly", a.Name())
-	return a.currentThought, nil
+	a.log(ctx).DebugContext(ctx, "no tool calls, returning the thought")
+	return a.actResult(ctx, hooks, cycle.thought)
 }
 
-// Process executes the full perceive-think-act cycle
-func (a *LLMAgent) Process(ctx context.Context, input interface{}) (interface{}, error) {
-	if err := a.Perceive(ctx, input); err != nil {
-		return nil, err
+// actResult passes the result of Act through the output guardrails and reports it
+func (a *LLMAgent) actResult(ctx context.Context, hooks hookSet, result interface{}) (interface{}, error) {
+	result, err := a.guardOutput(ctx, result)
+	if err != nil {
+		return nil, hooks.error(ctx, err)
 	}
+	hooks.actResult(ctx, result)
+	return result, nil
+}
 
-	if err := a.Think(ctx); err != nil {
+// Process runs the multi-step tool loop and returns the model's final answer.
+// Use Run to inspect every intermediate step.
+func (a *LLMAgent) Process(ctx context.Context, input interface{}) (interface{}, error) {
+	result, err := a.Run(ctx, input)
+	if err != nil {
 		return nil, err
 	}
-
-	return a.Act(ctx)
+	return result.Output, nil
 }
 
-// preparePrompt prepares the prompt
-func (a *LLMAgent) preparePrompt() string {
-	var prompt string
-
-	// Add system prompt
-	prompt += a.systemPrompt + "\n\n"
-
-	// Add current input
-	if a.currentInput != nil {
-		switch input := a.currentInput.(type) {
-		case string:
-			prompt += "Input: " + input + "\n\n"
-		case map[string]interface{}:
-			inputJSON, _ := json.MarshalIndent(input, "", "  ")
-			prompt += "Input: " + string(inputJSON) + "\n\n"
-		default:
-			inputJSON, _ := json.MarshalIndent(input, "", "  ")
-			prompt += "Input: " + string(inputJSON) + "\n\n"
+// preparePrompt prepares the prompt for an input. The input is never dropped: it is
+// truncated when it does not fit, and ErrContextLengthExceeded is returned when not even
+// a truncated input fits.
+func (a *LLMAgent) preparePrompt(ctx context.Context, input interface{}) (string, error) {
+	counter := a.counter()
+	budget := &promptBudget{counter: counter, remaining: a.promptTokenLimit(ctx, counter)}
+
+	// The system prompt and the instructions are always sent, the rest shares what is left
+	system := a.systemPrompt + "\n\n"
+	instruction := "Please analyze the above information and provide your analysis and decisions. If you need a tool, call it directly instead of describing the call in text.\n"
+	budget.remaining -= counter.CountTokens(system) + counter.CountTokens(instruction)
+
+	prompt := system
+
+	// Add current input, it takes precedence over tools and memories
+	if input != nil {
+		// The framing around the input is counted apart, it may merge differently with the text
+		budget.remaining -= counter.CountTokens("Input: ") + counter.CountTokens("\n\n")
+		full := formatInput(input)
+		text := budget.fit(full, budget.remaining)
+		if text == "" && full != "" {
+			return "", fmt.Errorf("agent %s: %w", a.Name(), llm.ErrContextLengthExceeded.WithDetails("the input does not fit in the prompt budget"))
+		}
+		if text != full {
+			a.log(ctx).WarnContext(ctx, "input truncated to fit the prompt budget", "input_tokens", counter.CountTokens(full), "kept_tokens", counter.CountTokens(text))
+		}
+		if text != "" {
+			prompt += "Input: " + text + "\n\n"
 		}
 	}
 
 	// Add available tools information
-	if len(a.tools) > 0 {
-		prompt += "Available tools:\n"
-		for _, tool := range a.tools {
-			prompt += fmt.Sprintf("- %s: %s\n", tool.Name(), tool.Description())
-		}
-		prompt += "\n"
+	if agentTools := a.runTools(ctx); len(agentTools) > 0 {
+		prompt += budgetToolList(budget, agentTools)
 	}
 
-	// Add recent memories
-	if a.memory != nil {
-		ctx := context.Background() // Create a new context
-		recentMemories, err := a.memory.GetRecent(ctx, 5)
-		if err == nil && len(recentMemories) > 0 {
-			prompt += "Recent memories:\n"
-			for _, mem := range recentMemories {
-				prompt += fmt.Sprintf("- [%s] %v\n", mem.Type, mem.Content)
-			}
-			prompt += "\n"
-		}
+	// Add recent memories, newest first until the budget runs out
+	if recentMemories := a.recallMemories(ctx); len(recentMemories) > 0 {
+		prompt += budgetMemories(budget, recentMemories, a.summarizeMemories(ctx))
 	}
 
 	// Add thinking instructions
-	prompt += "Please analyze the above information and provide your analysis and decisions. If you need to use a tool, use the following format:\n"
-	prompt += "Tool: <tool name>\n"
-	prompt += "Parameters: <JSON formatted parameters>\n"
+	prompt += instruction
 
-	return prompt
+	return prompt, nil
 }
 
-// isToolCall checks if text contains a tool call
-func isToolCall(text string) bool {
-	return strings.Contains(text, "Tool:") || strings.Contains(text, "tool:")
-}
+// recallMemories returns the recent memories of the current scope: those of the run in
+// ctx, or outside a Run those of the step-by-step cycle. Concurrent runs share the memory
+// and must not see each other's inputs and results.
+func (a *LLMAgent) recallMemories(ctx context.Context) []memory.MemoryItem {
+	if a.memory == nil {
+		return nil
+	}
+	items, err := a.memory.GetRecent(ctx, recallWindow)
+	if err != nil {
+		a.log(ctx).WarnContext(ctx, "failed to recall memories", "error", err)
+		return nil
+	}
 
-// parseToolCall parses a tool call
-func parseToolCall(text string) (string, map[string]interface{}, error) {
-	// Simple parsing logic, more complex parsing may be needed in practice
-	var toolName string
-	var paramsStr string
-
-	// Find tool name
-	toolRegex := regexp.MustCompile(`(?i)Tool:\s*(\w+)|tool:\s*(\w+)`)
-	toolMatches := toolRegex.FindStringSubmatch(text)
-	if len(toolMatches) > 1 {
-		if toolMatches[1] != "" {
-			toolName = toolMatches[1]
-		} else if len(toolMatches) > 2 {
-			toolName = toolMatches[2]
+	scope := runID(ctx)
+	var recalled []memory.MemoryItem
+	for _, item := range items {
+		if id, _ := item.Metadata[memoryKeyRun].(string); id == scope {
+			recalled = append(recalled, item)
 		}
 	}
+	// Memories beyond the listed ones are only worth recalling when they can be summarized
+	if len(recalled) > recallLimit && a.memorySummarizer == nil {
+		recalled = recalled[len(recalled)-recallLimit:]
+	}
+	return recalled
+}
 
-	// Find parameters
-	paramsRegex := regexp.MustCompile(`(?i)Parameters:\s*(\{.*\})|params:\s*(\{.*\})`)
-	paramsMatches := paramsRegex.FindStringSubmatch(text)
-	if len(paramsMatches) > 1 {
-		if paramsMatches[1] != "" {
-			paramsStr = paramsMatches[1]
-		} else if len(paramsMatches) > 2 {
-			paramsStr = paramsMatches[2]
-		}
+// runToolCall executes a structured tool call and records the result in memory
+func (a *LLMAgent) runToolCall(ctx context.Context, call llm.ToolCall) (interface{}, error) {
+	params, result, err := a.executeToolCall(ctx, call)
+	if err != nil {
+		return nil, err
 	}
 
-	if toolName == "" {
-		return "", nil, fmt.Errorf("tool name not found")
+	if err := a.rememberToolResult(ctx, call, params, result); err != nil {
+		return nil, err
 	}
 
-	// Parse parameters JSON
-	var params map[string]interface{}
-	if paramsStr != "" {
-		log.Printf("Parsing tool parameter JSON: %s", paramsStr)
-		if err := json.Unmarshal([]byte(paramsStr), &params); err != nil {
-			return toolName, nil, fmt.Errorf("failed to parse parameters: %w", err)
-		}
-	} else {
-		params = make(map[string]interface{})
-		log.Printf("No tool parameters provided, using empty parameters")
+	return result, nil
+}
+
+// executeToolCall decodes the call arguments and runs the matching tool
+func (a *LLMAgent) executeToolCall(ctx context.Context, call llm.ToolCall) (map[string]interface{}, interface{}, error) {
+	params, err := parseToolArguments(call.Function.Arguments)
+	if err != nil {
+		a.log(ctx).ErrorContext(ctx, "invalid tool arguments", llm.LogKeyTool, call.Function.Name, "tool_call_id", call.ID)
+		return nil, nil, fmt.Errorf("failed to parse arguments for tool call %s (%s): %w", call.ID, call.Function.Name, err)
+	}
+
+	hooks := a.hooks()
+	if err := hooks.toolStart(ctx, call, params); err != nil {
+		return params, nil, fmt.Errorf("tool call rejected: %w", err)
+	}
+	if err := a.approveToolCall(ctx, call, params); err != nil {
+		return params, nil, err
 	}
 
-	return toolName, params, nil
+	start := time.Now()
+	result, err := a.callTool(ctx, call.Function.Name, params)
+	hooks.toolEnd(ctx, call, result, err, time.Since(start))
+	if err != nil {
+		return params, nil, fmt.Errorf("tool call failed: %w", err)
+	}
+
+	return params, result, nil
 }
 
-// callTool calls a tool
-func (a *LLMAgent) callTool(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
-	// Find tool
-	var selectedTool tools.Tool
-	for _, tool := range a.tools {
-		if tool.Name() == toolName {
-			selectedTool = tool
-			break
-		}
+// rememberToolResult adds a tool call result to memory
+func (a *LLMAgent) rememberToolResult(ctx context.Context, call llm.ToolCall, params map[string]interface{}, result interface{}) error {
+	if a.memory == nil {
+		return nil
+	}
+
+	err := a.memory.Add(ctx, memory.MemoryItem{
+		ID:        uuid.New().String(),
+		Content:   result,
+		Type:      memory.TypeAction,
+		CreatedAt: time.Now(),
+		Metadata: runMetadata(ctx, map[string]interface{}{
+			"tool":         call.Function.Name,
+			"tool_call_id": call.ID,
+			"params":       params,
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add tool call result to memory: %w", err)
 	}
+	return nil
+}
 
+// parseToolArguments decodes the JSON arguments of a tool call, an empty string means no arguments
+func parseToolArguments(arguments string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if strings.TrimSpace(arguments) == "" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(arguments), &params); err != nil {
+		return nil, fmt.Errorf("invalid tool arguments %q: %w", truncateString(arguments, 200), err)
+	}
+	return params, nil
+}
+
+// callTool calls a tool
+func (a *LLMAgent) callTool(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
+	selectedTool := a.findTool(ctx, toolName)
 	if selectedTool == nil {
 		return nil, fmt.Errorf("tool not found: %s", toolName)
 	}
 
-	// Add tool call log
-	log.Printf("Agent[%s] calling tool: %s, params: %+v", a.Name(), toolName, params)
+	logger := a.log(ctx).With(llm.LogKeyTool, toolName)
+	logger.LogAttrs(ctx, slog.LevelInfo, "calling tool", llm.Redact("params", params))
 
 	// Execute tool directly with parameter map
 	result, err := selectedTool.Execute(ctx, params)
 	if err != nil {
-		log.Printf("Agent[%s] failed to call tool[%s]: %v", a.Name(), toolName, err)
+		logger.ErrorContext(ctx, "tool failed", "error", err)
 		return nil, fmt.Errorf("tool execution failed: %w", err)
 	}
 
-	// Add tool call result log
-	log.Printf("Agent[%s] called tool[%s] successfully: %v", a.Name(), toolName, result)
+	logger.LogAttrs(ctx, slog.LevelDebug, "tool succeeded", llm.Redact("result", result))
 
 	return result, nil
 }
+
+// findTool returns the tool of the run in ctx with the given name, nil when there is none
+func (a *LLMAgent) findTool(ctx context.Context, name string) tools.Tool {
+	for _, tool := range a.runTools(ctx) {
+		if tool.Name() == name {
+			return tool
+		}
+	}
+	return nil
+}
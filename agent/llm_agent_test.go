@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"github.com/voocel/mas/llm"
 	"github.com/voocel/mas/memory"
@@ -37,26 +38,20 @@ func TestLLMAgent_Act_ToolNotFound(t *testing.T) {
 	}
 }
 
-func TestLLMAgent_ParseToolCall(t *testing.T) {
-	name, params, err := parseToolCall("Tool:sum\nParameters:{\"a\":1,\"b\":2}")
-	if err != nil || name != "sum" || params["a"] != float64(1) {
-		t.Errorf("expected to parse tool call, got name=%s, params=%v, err=%v", name, params, err)
+func TestLLMAgent_ParseToolArguments(t *testing.T) {
+	params, err := parseToolArguments("{\"a\":1,\"text\":\"line one\\n{not a brace}\"}")
+	if err != nil || params["a"] != float64(1) || params["text"] != "line one\n{not a brace}" {
+		t.Errorf("expected to parse tool arguments, got params=%v, err=%v", params, err)
 	}
 }
 
-func TestLLMAgent_ParseToolCall_MissingName(t *testing.T) {
-	_, _, err := parseToolCall("Parameters:{}")
-	if err == nil {
-		t.Error("expected error for missing tool name")
+func TestLLMAgent_ParseToolArguments_EmptyAndInvalid(t *testing.T) {
+	params, err := parseToolArguments("")
+	if err != nil || len(params) != 0 {
+		t.Errorf("expected empty params for empty arguments, got %v (err: %v)", params, err)
 	}
-}
-
-func TestLLMAgent_IsToolCall(t *testing.T) {
-	if !isToolCall("Tool:sum") {
-		t.Error("expected true for tool call string")
-	}
-	if isToolCall("no tool here") {
-		t.Error("expected false for non-tool string")
+	if _, err := parseToolArguments("{broken"); err == nil {
+		t.Error("expected error for invalid arguments")
 	}
 }
 
@@ -73,7 +68,7 @@ func (m *mockProvider) ChatCompletion(ctx context.Context, req llm.ChatCompletio
 	if m.fail { return nil, errors.New("provider error") }
 	if m.resp != nil { return m.resp, nil }
 	return &llm.ChatCompletionResponse{
-		Choices: []llm.Choice{{Message: llm.Message{Content: "Thought: use a tool\nTool:adder\nParameters:{\"x\":1,\"y\":2}"}}},
+		Choices: []llm.Choice{{Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{adderCall("call_1", `{"x":1,"y":2}`)}}}},
 	}, nil
 }
 func (m *mockProvider) GetModels(ctx context.Context) ([]string, error) { return nil, nil }
@@ -90,6 +85,10 @@ func (m *mockTool) Execute(ctx context.Context, params map[string]interface{}) (
 	return params["x"].(float64) + params["y"].(float64), nil
 }
 
+func adderCall(id, arguments string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: "adder", Arguments: arguments}}
+}
+
 func TestLLMAgent_Think_ProviderError(t *testing.T) {
 	agent := NewLLMAgent(LLMAgentConfig{Name: "llm"})
 	agent.provider = &mockProvider{fail: true}
@@ -102,7 +101,7 @@ func TestLLMAgent_Think_ProviderError(t *testing.T) {
 func TestLLMAgent_Act_ToolSuccess(t *testing.T) {
 	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}})
 	agent.provider = &mockProvider{}
-	agent.currentThought = "Tool:adder\nParameters:{\"x\":1,\"y\":2}"
+	agent.cycle.toolCalls = []llm.ToolCall{adderCall("call_1", `{"x":1,"y":2}`)}
 	result, err := agent.Act(context.Background())
 	if err != nil || result != float64(3) {
 		t.Errorf("expected sum result 3, got %v, err=%v", result, err)
@@ -112,30 +111,81 @@ func TestLLMAgent_Act_ToolSuccess(t *testing.T) {
 func TestLLMAgent_Act_ToolError(t *testing.T) {
 	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{fail: true}}})
 	agent.provider = &mockProvider{}
-	agent.currentThought = "Tool:adder\nParameters:{\"x\":1,\"y\":2}"
+	agent.cycle.toolCalls = []llm.ToolCall{adderCall("call_1", `{"x":1,"y":2}`)}
 	_, err := agent.Act(context.Background())
 	if err == nil || err.Error() == "" {
 		t.Error("expected error from tool execution failure")
 	}
 }
 
+func TestLLMAgent_Act_MultipleToolCalls(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}})
+	agent.cycle.toolCalls = []llm.ToolCall{
+		adderCall("call_1", `{"x":1,"y":2}`),
+		adderCall("call_2", `{"x":3,"y":4}`),
+	}
+	result, err := agent.Act(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, ok := result.([]interface{})
+	if !ok || len(results) != 2 || results[0] != float64(3) || results[1] != float64(7) {
+		t.Errorf("expected results [3 7], got %v", result)
+	}
+}
+
+func TestLLMAgent_Act_NoToolCallReturnsThought(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}})
+	agent.cycle.thought = "Tool:adder\nParameters:{\"x\":1,\"y\":2}"
+	result, err := agent.Act(context.Background())
+	if err != nil || result != agent.cycle.thought {
+		t.Errorf("expected plain text to be returned untouched, got %v (err: %v)", result, err)
+	}
+}
+
+type recordingProvider struct {
+	mockProvider
+	lastReq llm.ChatCompletionRequest
+}
+
+func (r *recordingProvider) ChatCompletion(ctx context.Context, req llm.ChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	r.lastReq = req
+	return r.mockProvider.ChatCompletion(ctx, req)
+}
+
+func TestLLMAgent_Think_SendsToolDefinitions(t *testing.T) {
+	provider := &recordingProvider{}
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}, Provider: provider})
+	if err := agent.Think(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provider.lastReq.Tools) != 1 {
+		t.Fatalf("expected 1 tool definition, got %d", len(provider.lastReq.Tools))
+	}
+	if len(agent.cycle.toolCalls) != 1 || agent.cycle.toolCalls[0].Function.Name != "adder" {
+		t.Errorf("expected structured tool call to be captured, got %+v", agent.cycle.toolCalls)
+	}
+}
+
 func TestLLMAgent_Process_EndToEnd(t *testing.T) {
 	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}})
-	agent.provider = &mockProvider{}
+	agent.provider = llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		textReply("The sum is 3"),
+	)
 	result, err := agent.Process(context.Background(), "input")
 	if err != nil {
 		t.Errorf("unexpected error in end-to-end process: %v", err)
 	}
-	if result == nil {
-		t.Error("expected non-nil result from process")
+	if result != "The sum is 3" {
+		t.Errorf("expected final answer from process, got %v", result)
 	}
 }
 
 func TestLLMAgent_preparePrompt(t *testing.T) {
 	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Tools: []tools.Tool{&mockTool{}}})
-	agent.currentInput = map[string]interface{}{ "foo": "bar" }
-	prompt := agent.preparePrompt()
-	if prompt == "" || prompt == "\n\n" {
+	prompt, err := agent.preparePrompt(context.Background(), map[string]interface{}{ "foo": "bar" })
+	if err != nil || prompt == "" || prompt == "\n\n" {
 		t.Error("expected non-empty prompt")
 	}
 }
@@ -151,3 +201,29 @@ func TestLLMAgent_MemoryError(t *testing.T) {
 		t.Error("expected error from memory add failure")
 	}
 }
+
+func TestLLMAgent_Perceive_ImageInput(t *testing.T) {
+	provider := llm.NewSequenceProvider(llm.TextResponse("a fjord at dawn"))
+	agent := NewLLMAgent(LLMAgentConfig{Name: "vision", Provider: provider})
+
+	image := llm.ImageFromBytes([]byte("\x89PNG\r\n\x1a\n"), "image/png")
+	result, err := agent.Process(context.Background(), ImageInput{Prompt: "what is this?", Images: []string{image}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "a fjord at dawn" {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	user := provider.Requests()[0].Messages[1]
+	if len(user.Images) != 1 || user.Images[0] != image {
+		t.Errorf("expected the image on the user message, got %v", user.Images)
+	}
+	if !strings.Contains(user.Content, "what is this?") || strings.Contains(user.Content, "base64") {
+		t.Errorf("expected the prompt without image data, got %q", user.Content)
+	}
+
+	if err := agent.Perceive(context.Background(), &ImageInput{Images: []string{"not an image"}}); err == nil {
+		t.Error("expected an error for an unreadable image")
+	}
+}
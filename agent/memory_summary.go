@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/memory"
+)
+
+const (
+	// maxSummaryTokens caps the summary of the memories that do not fit the prompt
+	maxSummaryTokens = 256
+	// summaryHeader introduces the summary of older memories in the prompt
+	summaryHeader = "Summary of older memories: "
+)
+
+// MemorySummarizer condenses the recalled memories that do not fit the prompt, so long
+// sessions keep the gist of their older context instead of losing it
+type MemorySummarizer interface {
+	// Summarize condenses memories, oldest first, into at most maxTokens tokens
+	Summarize(ctx context.Context, memories []memory.MemoryItem, maxTokens int) (string, error)
+}
+
+// LLMMemorySummarizer asks a model to summarize memories
+type LLMMemorySummarizer struct {
+	provider llm.Provider
+	model    string
+}
+
+// NewLLMMemorySummarizer creates a summarizer using model on provider, an empty model
+// uses the provider's default model. A cheaper model than the agent's is usually enough.
+func NewLLMMemorySummarizer(provider llm.Provider, model string) *LLMMemorySummarizer {
+	return &LLMMemorySummarizer{provider: provider, model: model}
+}
+
+func (s *LLMMemorySummarizer) Summarize(ctx context.Context, memories []memory.MemoryItem, maxTokens int) (string, error) {
+	var sb strings.Builder
+	for _, mem := range memories {
+		fmt.Fprintf(&sb, "- [%s] %v\n", mem.Type, mem.Content)
+	}
+
+	resp, err := s.provider.ChatCompletion(ctx, llm.ChatCompletionRequest{
+		Model: s.model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: "Condense these notes of an agent's earlier work into a short summary. Keep names, facts, decisions and open tasks. Answer with the summary only."},
+			{Role: llm.RoleUser, Content: sb.String()},
+		},
+		MaxTokens: maxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", llm.ErrResponseInvalid.WithDetails("summary response has no choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// summarizeMemories returns the summarize step of budgetMemories, nil without a summarizer.
+// A failed summary is logged and the memories are only counted as omitted.
+func (a *LLMAgent) summarizeMemories(ctx context.Context) func([]memory.MemoryItem, int) string {
+	if a.memorySummarizer == nil {
+		return nil
+	}
+	return func(omitted []memory.MemoryItem, maxTokens int) string {
+		summary, err := a.memorySummarizer.Summarize(ctx, omitted, maxTokens)
+		if err != nil {
+			a.log(ctx).WarnContext(ctx, "failed to summarize memories", "memories", len(omitted), "error", err)
+			return ""
+		}
+		a.log(ctx).DebugContext(ctx, "summarized memories", "memories", len(omitted))
+		return summary
+	}
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/memory"
+	"github.com/voocel/mas/tools"
+)
+
+const (
+	// defaultReplyTokens is reserved for the reply when MaxTokens is not set
+	defaultReplyTokens = 1024
+	// minMemoryTokens is the smallest slice of budget worth spending on a truncated memory
+	minMemoryTokens = 32
+	// truncationMarker is appended to text cut to fit the prompt budget
+	truncationMarker = " ...[truncated]"
+)
+
+// promptBudget hands out the tokens left for the prompt
+type promptBudget struct {
+	counter   llm.TokenCounter
+	remaining int
+}
+
+// take reserves the tokens of text if they fit
+func (b *promptBudget) take(text string) bool {
+	n := b.counter.CountTokens(text)
+	if n > b.remaining {
+		return false
+	}
+	b.remaining -= n
+	return true
+}
+
+// fit returns text, truncated if needed, so that it fits in at most limit tokens of the
+// remaining budget, and reserves those tokens
+func (b *promptBudget) fit(text string, limit int) string {
+	if limit > b.remaining {
+		limit = b.remaining
+	}
+	if n := b.counter.CountTokens(text); n <= limit {
+		b.remaining -= n
+		return text
+	}
+
+	limit -= b.counter.CountTokens(truncationMarker)
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if b.counter.CountTokens(string(runes[:mid])) <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return ""
+	}
+
+	cut := string(runes[:lo]) + truncationMarker
+	b.remaining -= b.counter.CountTokens(cut)
+	return cut
+}
+
+// promptTokenLimit is what is left of the model's context window for the user prompt once
+// the system message, the tool schemas and the reply are accounted for
+func (a *LLMAgent) promptTokenLimit(ctx context.Context, counter llm.TokenCounter) int {
+	window := a.contextWindow
+	if window <= 0 {
+		window, _ = llm.ContextWindow(a.GetModelName())
+	}
+
+	reply := a.maxTokens
+	if reply <= 0 {
+		reply = defaultReplyTokens
+	}
+
+	limit := window - reply - llm.CountMessageTokens(counter, []llm.Message{{Role: llm.RoleSystem, Content: a.systemPrompt}})
+	if agentTools := a.runTools(ctx); len(agentTools) > 0 {
+		schemas, _ := json.Marshal(tools.ConvertToolsToFunctions(agentTools))
+		limit -= counter.CountTokens(string(schemas))
+	}
+	return limit
+}
+
+// formatInput renders the current input for the prompt
+func formatInput(input interface{}) string {
+	switch in := input.(type) {
+	case string:
+		return in
+	case ImageInput:
+		return in.Prompt
+	}
+	inputJSON, _ := json.MarshalIndent(input, "", "  ")
+	return string(inputJSON)
+}
+
+// budgetToolList lists the tools in full, falls back to first sentences and then to bare
+// names when the descriptions do not fit
+func budgetToolList(budget *promptBudget, toolList []tools.Tool) string {
+	render := func(describe func(tools.Tool) string) string {
+		var sb strings.Builder
+		sb.WriteString("Available tools:\n")
+		for _, tool := range toolList {
+			if desc := describe(tool); desc != "" {
+				fmt.Fprintf(&sb, "- %s: %s\n", tool.Name(), desc)
+			} else {
+				fmt.Fprintf(&sb, "- %s\n", tool.Name())
+			}
+		}
+		sb.WriteString("\n")
+		return sb.String()
+	}
+
+	for _, describe := range []func(tools.Tool) string{
+		func(t tools.Tool) string { return t.Description() },
+		func(t tools.Tool) string { return firstSentence(t.Description()) },
+		func(t tools.Tool) string { return "" },
+	} {
+		if text := render(describe); budget.take(text) {
+			return text
+		}
+	}
+	return ""
+}
+
+// budgetMemories lists up to recallLimit of the newest memories that fit, truncating the
+// oldest one listed if needed. The older memories left out are condensed by summarize when
+// it is set and the summary fits, otherwise a note says how many were omitted.
+func budgetMemories(budget *promptBudget, memories []memory.MemoryItem, summarize func([]memory.MemoryItem, int) string) string {
+	header := "Recent memories:\n"
+	if len(memories) == 0 || !budget.take(header) {
+		return ""
+	}
+
+	// Reserve room for the omission note, or the summary, before spending the rest on memories
+	note := fmt.Sprintf("(%d older memories omitted)\n", len(memories))
+	reserved := budget.counter.CountTokens(note)
+	if summarize != nil {
+		reserved = max(reserved, min(maxSummaryTokens, budget.remaining/4))
+	}
+	budget.remaining -= reserved
+
+	lines := make([]string, 0, recallLimit)
+	for i := len(memories) - 1; i >= 0 && len(lines) < recallLimit; i-- {
+		mem := memories[i]
+		line := fmt.Sprintf("- [%s] %v\n", mem.Type, mem.Content)
+		if budget.take(line) {
+			lines = append(lines, line)
+			continue
+		}
+		if budget.remaining >= minMemoryTokens {
+			if cut := budget.fit(strings.TrimSuffix(line, "\n"), budget.remaining); cut != "" {
+				lines = append(lines, cut+"\n")
+			}
+		}
+		break
+	}
+
+	budget.remaining += reserved
+	if len(lines) == 0 {
+		budget.remaining += budget.counter.CountTokens(header)
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header)
+	if omitted := len(memories) - len(lines); omitted > 0 {
+		if summary := budgetSummary(budget, memories[:omitted], reserved, summarize); summary != "" {
+			sb.WriteString(summary)
+		} else {
+			note = fmt.Sprintf("(%d older memories omitted)\n", omitted)
+			budget.take(note)
+			sb.WriteString(note)
+		}
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		sb.WriteString(lines[i])
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// budgetSummary summarizes the omitted memories within limit tokens, empty when there is
+// no summarizer, it fails or the summary does not fit
+func budgetSummary(budget *promptBudget, omitted []memory.MemoryItem, limit int, summarize func([]memory.MemoryItem, int) string) string {
+	framing := budget.counter.CountTokens(summaryHeader) + budget.counter.CountTokens("\n")
+	if summarize == nil || limit <= framing || budget.remaining < limit {
+		return ""
+	}
+
+	summary := summarize(omitted, limit-framing)
+	if summary == "" {
+		return ""
+	}
+	budget.remaining -= framing
+	text := budget.fit(summary, limit-framing)
+	if text == "" {
+		budget.remaining += framing
+		return ""
+	}
+	return summaryHeader + text + "\n"
+}
+
+// firstSentence shortens a description to its first sentence
+func firstSentence(s string) string {
+	if idx := strings.IndexAny(s, ".\n"); idx >= 0 {
+		return strings.TrimSpace(s[:idx+1])
+	}
+	return s
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/memory"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: A rucksack only holds so much on the mountain path, so the map and the water go in first and yesterday's letters are left at the cabin—these tests check that the prompt is packed to fit the model's context window.
+ */
+
+// longTool has a description long enough to be worth shortening
+type longTool struct{ mockTool }
+
+func (l *longTool) Name() string { return "researcher" }
+func (l *longTool) Description() string {
+	return "Looks things up. " + strings.Repeat("It has many detailed options. ", 50)
+}
+
+func addMemories(t *testing.T, a *LLMAgent, contents ...string) {
+	t.Helper()
+	for i, content := range contents {
+		err := a.memory.Add(context.Background(), memory.MemoryItem{
+			ID:        string(rune('a' + i)),
+			Content:   content,
+			Type:      memory.TypeObservation,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("failed to add memory: %v", err)
+		}
+	}
+}
+
+func TestLLMAgent_preparePrompt_FitsBudget(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{
+		Name:          "writer",
+		SystemPrompt:  "You write.",
+		MaxTokens:     100,
+		ContextWindow: 700,
+		Tools:         []tools.Tool{&longTool{}},
+	})
+	addMemories(t, agent,
+		"oldest "+strings.Repeat("draft ", 400),
+		"older "+strings.Repeat("notes ", 400),
+		"newest short memory",
+	)
+	prompt, err := agent.preparePrompt(context.Background(), "write the next chapter")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	counter := agent.counter()
+	limit := agent.promptTokenLimit(context.Background(), counter)
+	if got := counter.CountTokens(prompt); got > limit {
+		t.Errorf("prompt uses %d tokens, budget is %d", got, limit)
+	}
+	if !strings.Contains(prompt, "write the next chapter") {
+		t.Error("expected the input to be kept in full")
+	}
+	if !strings.Contains(prompt, "newest short memory") {
+		t.Error("expected the newest memory to be kept")
+	}
+	if strings.Contains(prompt, "oldest") {
+		t.Error("expected the oldest memory to be dropped")
+	}
+	if !strings.Contains(prompt, "older memories omitted") {
+		t.Error("expected a note about omitted memories")
+	}
+	if !strings.Contains(prompt, "- researcher: Looks things up.\n") {
+		t.Errorf("expected the tool description to be shortened, got:\n%s", prompt)
+	}
+}
+
+func TestLLMAgent_preparePrompt_TruncatesHugeInput(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "writer", ContextWindow: 400, MaxTokens: 100})
+	prompt, err := agent.preparePrompt(context.Background(), strings.Repeat("chapter ", 2000))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, truncationMarker) {
+		t.Error("expected the input to be truncated")
+	}
+	if !strings.HasSuffix(prompt, "describing the call in text.\n") {
+		t.Error("expected the instructions to survive truncation")
+	}
+}
+
+func TestLLMAgent_preparePrompt_KeepsInputBeforeTools(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "writer", ContextWindow: 800, MaxTokens: 100, Tools: []tools.Tool{&longTool{}}})
+	addMemories(t, agent, strings.Repeat("memory ", 400))
+
+	prompt, err := agent.preparePrompt(context.Background(), strings.Repeat("chapter ", 2000))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, "Input: chapter") {
+		t.Errorf("expected the input to take precedence over tools and memories, got:\n%s", prompt)
+	}
+}
+
+func TestLLMAgent_preparePrompt_InputDoesNotFit(t *testing.T) {
+	provider := llm.NewSequenceProvider(textReply("unused"))
+	agent := NewLLMAgent(LLMAgentConfig{Name: "writer", ContextWindow: 120, MaxTokens: 100, SystemPrompt: "You write.", Provider: provider})
+
+	if _, err := agent.preparePrompt(context.Background(), "write the next chapter"); !errors.Is(err, llm.ErrContextLengthExceeded) {
+		t.Errorf("expected ErrContextLengthExceeded, got %v", err)
+	}
+	if _, err := agent.Run(context.Background(), "write the next chapter"); !errors.Is(err, llm.ErrContextLengthExceeded) {
+		t.Errorf("expected the run to fail before calling the model, got %v", err)
+	}
+	if len(provider.Requests()) != 0 {
+		t.Error("expected no request without the input")
+	}
+}
+
+func TestLLMAgent_preparePrompt_UsesModelWindow(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "writer", Model: "gpt-4"})
+	if got := agent.promptTokenLimit(context.Background(), llm.ApproxTokenCounter{}); got >= 8192 || got < 7000 {
+		t.Errorf("expected a limit derived from the gpt-4 window, got %d", got)
+	}
+}
+
+func TestLLMAgent_preparePrompt_SummarizesOmittedMemories(t *testing.T) {
+	summaries := llm.NewScriptedProvider(llm.ScriptRule{
+		Match:    llm.MatchLastMessageContains("chapter one"),
+		Response: textReply("The hero left the village in chapter one."),
+	})
+	agent := NewLLMAgent(LLMAgentConfig{
+		Name:             "writer",
+		MaxTokens:        100,
+		ContextWindow:    1200,
+		MemorySummarizer: NewLLMMemorySummarizer(summaries, "small-model"),
+	})
+	addMemories(t, agent, "chapter one "+strings.Repeat("draft ", 400))
+	for i := 0; i < recallLimit; i++ {
+		addMemories(t, agent, "short note")
+	}
+
+	prompt, err := agent.preparePrompt(context.Background(), "write the next chapter")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, limit := agent.counter().CountTokens(prompt), agent.promptTokenLimit(context.Background(), agent.counter()); got > limit {
+		t.Errorf("prompt uses %d tokens, budget is %d", got, limit)
+	}
+	if !strings.Contains(prompt, summaryHeader+"The hero left the village in chapter one.\n") {
+		t.Errorf("expected the omitted memory to be summarized, got:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "older memories omitted") || strings.Contains(prompt, "draft draft") {
+		t.Errorf("expected the summary instead of the omitted memory, got:\n%s", prompt)
+	}
+	if req := summaries.Requests()[0]; req.Model != "small-model" || req.MaxTokens <= 0 || req.MaxTokens > maxSummaryTokens {
+		t.Errorf("unexpected summary request: model %q, max tokens %d", req.Model, req.MaxTokens)
+	}
+}
+
+func TestLLMAgent_preparePrompt_SummaryFailureNotesOmission(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{
+		Name:             "writer",
+		MaxTokens:        100,
+		ContextWindow:    1200,
+		MemorySummarizer: NewLLMMemorySummarizer(llm.NewScriptedProvider(llm.ScriptRule{Err: llm.ErrServerError}), ""),
+	})
+	addMemories(t, agent, "chapter one "+strings.Repeat("draft ", 400), "short note")
+	for i := 0; i < recallLimit; i++ {
+		addMemories(t, agent, "short note")
+	}
+
+	prompt, err := agent.preparePrompt(context.Background(), "write the next chapter")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, "(2 older memories omitted)") {
+		t.Errorf("expected a note when the summary fails, got:\n%s", prompt)
+	}
+}
@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+// DefaultMaxIterations is the number of model round trips a Run may take when
+// LLMAgentConfig.MaxIterations is not set
+const DefaultMaxIterations = 10
+
+// ErrMaxIterationsExceeded is returned when the model keeps calling tools past the iteration limit
+var ErrMaxIterationsExceeded = errors.New("maximum iterations exceeded before the model produced a final answer")
+
+const (
+	// memoryKeyRun is the memory metadata key holding the ID of the run that wrote an item
+	memoryKeyRun = "run_id"
+	// recallWindow is how many recent memories are searched for the current run's
+	recallWindow = 50
+	// recallLimit is how many memories are listed in a prompt, older ones are summarized
+	// when the agent has a MemorySummarizer
+	recallLimit = 5
+)
+
+// runIDKey carries the ID of the current run in a context
+type runIDKey struct{}
+
+// withRunID starts a new run scope for the memories written and recalled under ctx
+func withRunID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, runIDKey{}, uuid.New().String())
+}
+
+// runID returns the ID of the run in ctx, empty outside a Run
+func runID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// toolsKey carries the tools a run started with in a context
+type toolsKey struct{}
+
+// withTools fixes the tools of the run in ctx, so tools added while it is in progress
+// neither reach its requests nor its tool calls
+func withTools(ctx context.Context, runTools []tools.Tool) context.Context {
+	return context.WithValue(ctx, toolsKey{}, runTools)
+}
+
+// runTools returns the tools of the run in ctx, the agent's current tools outside a run
+func (a *LLMAgent) runTools(ctx context.Context) []tools.Tool {
+	if runTools, ok := ctx.Value(toolsKey{}).([]tools.Tool); ok {
+		return runTools
+	}
+	return a.GetTools()
+}
+
+// runMetadata tags memory metadata with the run in ctx
+func runMetadata(ctx context.Context, metadata map[string]interface{}) map[string]interface{} {
+	if id := runID(ctx); id != "" {
+		metadata[memoryKeyRun] = id
+	}
+	return metadata
+}
+
+// ToolResult records a single tool invocation made during a run
+type ToolResult struct {
+	CallID string                 `json:"call_id"`
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Output interface{}            `json:"output,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// RunStep records one model round trip and the tools it triggered
+type RunStep struct {
+	Iteration   int            `json:"iteration"`
+	Thought     string         `json:"thought,omitempty"`
+	ToolCalls   []llm.ToolCall `json:"tool_calls,omitempty"`
+	ToolResults []ToolResult   `json:"tool_results,omitempty"`
+	Usage       llm.Usage      `json:"usage"`
+}
+
+// RunResult is the structured outcome of a multi-step Run
+type RunResult struct {
+	// Output is the model's final answer
+	Output string `json:"output"`
+
+	// Steps lists every model round trip in order
+	Steps []RunStep `json:"steps"`
+
+	// Messages is the full conversation sent to and received from the model
+	Messages []llm.Message `json:"messages"`
+
+	// Usage is the token usage summed over all steps
+	Usage llm.Usage `json:"usage"`
+
+	// Structured is the validated JSON answer when a response format was requested
+	Structured json.RawMessage `json:"structured,omitempty"`
+}
+
+// Run executes the perceive-think-act loop: tool results are fed back to the model
+// as tool messages until it answers without calling a tool or MaxIterations is reached.
+// When the limit is hit the partial result is returned together with ErrMaxIterationsExceeded.
+func (a *LLMAgent) Run(ctx context.Context, input interface{}) (*RunResult, error) {
+	return a.run(ctx, input, runOptions{format: a.responseFormat})
+}
+
+// RunAs runs the agent and decodes its final answer into a T. The agent's ResponseFormat
+// is used when configured, otherwise the schema is derived from T.
+func RunAs[T any](ctx context.Context, a *LLMAgent, input interface{}) (T, *RunResult, error) {
+	var out T
+	format := a.responseFormat
+	if format == nil {
+		derived, err := llm.JSONSchemaFormatFor("response", out)
+		if err != nil {
+			return out, nil, err
+		}
+		format = derived
+	}
+
+	result, err := a.run(ctx, input, runOptions{format: format})
+	if err != nil {
+		return out, result, err
+	}
+	if err := json.Unmarshal(result.Structured, &out); err != nil {
+		return out, result, fmt.Errorf("agent %s: %w", a.Name(), llm.ErrInvalidStructuredOutput.WithDetails(err.Error()))
+	}
+	return out, result, nil
+}
+
+// runOptions tune a single pass through the tool loop
+type runOptions struct {
+	// emit streams completions where the provider supports it and reports progress as it happens
+	emit func(StreamEvent)
+	// format makes the final answer structured, invalid answers are sent back for repair
+	format *llm.ResponseFormat
+	// stateless keeps thoughts and tool results out of the agent memory, sessions keep
+	// their own history instead
+	stateless bool
+}
+
+// run perceives the input and drives the tool loop from the agent's opening prompt. All
+// per-call state lives in the loop, and memories are scoped to the run, so concurrent runs
+// on one agent do not interfere.
+func (a *LLMAgent) run(ctx context.Context, input interface{}, opts runOptions) (*RunResult, error) {
+	ctx = withTools(withRunID(ctx), a.GetTools())
+	hooks := a.hooks()
+	input, err := a.perceive(ctx, input)
+	if err != nil {
+		return nil, hooks.error(ctx, err)
+	}
+	messages, err := a.initialMessages(ctx, input)
+	if err != nil {
+		return nil, hooks.error(ctx, err)
+	}
+	result, err := a.loop(ctx, messages, opts)
+	if err == nil {
+		err = a.guardResult(ctx, result)
+	}
+	if err != nil {
+		return result, hooks.error(ctx, err)
+	}
+	hooks.actResult(ctx, result.Output)
+	return result, nil
+}
+
+// loop sends messages to the model and feeds tool results back until it gives a final answer
+func (a *LLMAgent) loop(ctx context.Context, messages []llm.Message, opts runOptions) (*RunResult, error) {
+	emit, format := opts.emit, opts.format
+	result := &RunResult{Messages: messages}
+	repairs := 0
+
+	for iteration := 1; iteration <= a.maxIterations; iteration++ {
+		var resp *llm.ChatCompletionResponse
+		var err error
+		if emit != nil {
+			resp, err = a.completeStream(ctx, result.Messages, format, iteration, emit)
+		} else {
+			resp, err = a.complete(ctx, result.Messages, format)
+		}
+		if err != nil {
+			return result, err
+		}
+		if len(resp.Choices) == 0 {
+			return result, fmt.Errorf("LLM response for agent %s has no choices at iteration %d", a.Name(), iteration)
+		}
+
+		reply := resp.Choices[0].Message
+		if reply.Role == "" {
+			reply.Role = llm.RoleAssistant
+		}
+		result.Messages = append(result.Messages, reply)
+		addUsage(&result.Usage, resp.Usage)
+
+		step := RunStep{
+			Iteration: iteration,
+			Thought:   reply.Content,
+			ToolCalls: reply.ToolCalls,
+			Usage:     resp.Usage,
+		}
+
+		if !opts.stateless {
+			if err := a.rememberThought(ctx, reply.Content); err != nil {
+				return result, err
+			}
+		}
+
+		// No tool calls means the model has reached its final answer
+		if len(reply.ToolCalls) == 0 {
+			result.Steps = append(result.Steps, step)
+			result.Output = reply.Content
+			if format == nil {
+				return result, nil
+			}
+
+			data, err := llm.ParseStructuredOutput(reply.Content, format)
+			if err == nil {
+				result.Structured = data
+				result.Output = string(data)
+				return result, nil
+			}
+			if repairs >= a.maxRepairs {
+				details := err.Error()
+				var llmErr llm.LLMError
+				if errors.As(err, &llmErr) && llmErr.Details != "" {
+					details = llmErr.Details
+				}
+				return result, fmt.Errorf("agent %s: %w", a.Name(), llm.ErrInvalidStructuredOutput.WithDetails(details))
+			}
+			repairs++
+			a.log(ctx).WarnContext(ctx, "answer does not match the response format, asking for a repair", "repair", repairs, "max_repairs", a.maxRepairs)
+			result.Messages = append(result.Messages, llm.RepairMessage(err))
+			continue
+		}
+
+		for _, call := range reply.ToolCalls {
+			toolResult, err := a.observeToolCall(ctx, call, !opts.stateless)
+			if err != nil {
+				return result, err
+			}
+			step.ToolResults = append(step.ToolResults, toolResult)
+			result.Messages = append(result.Messages, toolMessage(toolResult))
+			if emit != nil {
+				emit(StreamEvent{Type: StreamEventToolResult, Iteration: iteration, ToolResult: &toolResult})
+			}
+		}
+		result.Steps = append(result.Steps, step)
+	}
+
+	a.log(ctx).WarnContext(ctx, "stopped without a final answer", "iterations", a.maxIterations)
+	return result, fmt.Errorf("agent %s: %w (limit %d)", a.Name(), ErrMaxIterationsExceeded, a.maxIterations)
+}
+
+// observeToolCall runs a tool call for the loop. Tool failures are captured in the
+// result so the model can react to them; only memory failures abort the run.
+func (a *LLMAgent) observeToolCall(ctx context.Context, call llm.ToolCall, remember bool) (ToolResult, error) {
+	toolResult := ToolResult{CallID: call.ID, Name: call.Function.Name}
+
+	params, output, err := a.executeToolCall(ctx, call)
+	toolResult.Params = params
+	if err != nil {
+		toolResult.Error = err.Error()
+		return toolResult, nil
+	}
+	toolResult.Output = output
+
+	if !remember {
+		return toolResult, nil
+	}
+	if err := a.rememberToolResult(ctx, call, params, output); err != nil {
+		return toolResult, err
+	}
+	return toolResult, nil
+}
+
+// toolMessage converts a tool result into the message fed back to the model
+func toolMessage(result ToolResult) llm.Message {
+	content := "Error: " + result.Error
+	if result.Error == "" {
+		content = formatToolOutput(result.Output)
+	}
+	return llm.Message{
+		Role:       llm.RoleTool,
+		Content:    content,
+		ToolCallID: result.CallID,
+		IsError:    result.Error != "",
+	}
+}
+
+// formatToolOutput renders a tool output as text, preferring JSON for structured values
+func formatToolOutput(output interface{}) string {
+	switch v := output.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Sprintf("%v", output)
+	}
+	return string(data)
+}
+
+// addUsage accumulates token usage
+func addUsage(total *llm.Usage, usage llm.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like a hiker checking the map at every cairn, these tests walk the agent loop step by step—each tool result is carried forward, every step is written in the logbook, and no trail runs on forever.
+ */
+
+var testUsage = llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+
+func textReply(content string) *llm.ChatCompletionResponse {
+	resp := llm.TextResponse(content)
+	resp.Usage = testUsage
+	return resp
+}
+
+func toolCallReply(calls ...llm.ToolCall) *llm.ChatCompletionResponse {
+	resp := llm.ToolCallResponse(calls...)
+	resp.Usage = testUsage
+	return resp
+}
+
+func TestLLMAgent_Run_FeedsToolResultsBack(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		toolCallReply(adderCall("call_2", `{"x":3,"y":4}`)),
+		textReply("1+2=3 and 3+4=7"),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{&mockTool{}}})
+
+	result, err := agent.Run(context.Background(), "add things")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "1+2=3 and 3+4=7" {
+		t.Errorf("unexpected output: %q", result.Output)
+	}
+	if len(result.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(result.Steps))
+	}
+	if got := result.Steps[0].ToolResults[0].Output; got != float64(3) {
+		t.Errorf("expected first tool result 3, got %v", got)
+	}
+	if result.Usage.TotalTokens != 45 {
+		t.Errorf("expected summed usage of 45 tokens, got %d", result.Usage.TotalTokens)
+	}
+
+	// The second request must carry the assistant tool call and its tool result
+	second := provider.Requests()[1].Messages
+	last := second[len(second)-1]
+	if last.Role != llm.RoleTool || last.ToolCallID != "call_1" || last.Content != "3" {
+		t.Errorf("expected tool result message for call_1, got %+v", last)
+	}
+	if prev := second[len(second)-2]; prev.Role != llm.RoleAssistant || len(prev.ToolCalls) != 1 {
+		t.Errorf("expected assistant tool call message, got %+v", prev)
+	}
+}
+
+func TestLLMAgent_Run_ToolErrorIsObserved(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		textReply("the adder is broken"),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{&mockTool{fail: true}}})
+
+	result, err := agent.Run(context.Background(), "add things")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Steps[0].ToolResults[0].Error == "" {
+		t.Error("expected tool error to be recorded in the step")
+	}
+	msgs := provider.Requests()[1].Messages
+	if content := msgs[len(msgs)-1].Content; content == "" || content[:6] != "Error:" {
+		t.Errorf("expected error to be fed back to the model, got %q", content)
+	}
+	if !msgs[len(msgs)-1].IsError {
+		t.Error("expected the tool result to be flagged as an error")
+	}
+}
+
+func TestLLMAgent_Run_KeepsToolsItStartedWith(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(llm.ToolCall{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "installer", Arguments: `{}`}}),
+		toolCallReply(llm.ToolCall{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "late", Arguments: `{}`}}),
+		textReply("done"),
+	)
+	var agent *LLMAgent
+	late := tools.NewTool("late", "added during the run", nil, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "late result", nil
+	})
+	installer := tools.NewTool("installer", "adds a tool", nil, func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		agent.AddTools(late)
+		return "installed", nil
+	})
+	agent = NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{installer}})
+
+	result, err := agent.Run(context.Background(), "install a tool")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := result.Steps[1].ToolResults[0].Error; !strings.Contains(got, "tool not found") {
+		t.Errorf("expected the tool added during the run to be unknown to it, got error %q", got)
+	}
+	for i, req := range provider.Requests() {
+		if len(req.Tools) != 1 {
+			t.Errorf("request %d: expected the tools the run started with, got %d tools", i, len(req.Tools))
+		}
+	}
+	if len(agent.GetTools()) != 2 {
+		t.Errorf("expected the next run to see 2 tools, got %d", len(agent.GetTools()))
+	}
+}
+
+func TestLLMAgent_Run_MaxIterations(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		toolCallReply(adderCall("call_2", `{"x":1,"y":2}`)),
+		toolCallReply(adderCall("call_3", `{"x":1,"y":2}`)),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{&mockTool{}}, MaxIterations: 2})
+
+	result, err := agent.Run(context.Background(), "loop forever")
+	if !errors.Is(err, ErrMaxIterationsExceeded) {
+		t.Fatalf("expected ErrMaxIterationsExceeded, got %v", err)
+	}
+	if result == nil || len(result.Steps) != 2 {
+		t.Errorf("expected partial result with 2 steps, got %+v", result)
+	}
+	if len(provider.Requests()) != 2 {
+		t.Errorf("expected 2 provider calls, got %d", len(provider.Requests()))
+	}
+}
+
+func TestLLMAgent_Run_BudgetExceeded(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: toolCallReply(adderCall("call_1", `{"x":1,"y":2}`))})
+	agent := NewLLMAgent(LLMAgentConfig{
+		Name:          "spender",
+		Provider:      provider,
+		Tools:         []tools.Tool{&mockTool{}},
+		MaxIterations: 10,
+		Budget:        llm.Budget{MaxTokens: 40},
+		TokenCounter:  llm.TokenCounterFunc(func(string) int { return 0 }),
+	})
+
+	_, err := agent.Run(context.Background(), "loop forever")
+	if !errors.Is(err, llm.ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if calls := len(provider.Requests()); calls != 2 {
+		t.Errorf("expected the budget to allow 2 calls, got %d", calls)
+	}
+	if spent := agent.BudgetSpent(); spent.TotalTokens != 30 {
+		t.Errorf("expected 30 tokens spent, got %+v", spent)
+	}
+
+	// The budget covers the agent's lifetime, a later run only gets what is left
+	if _, err := agent.Run(context.Background(), "again"); !errors.Is(err, llm.ErrBudgetExceeded) {
+		t.Errorf("expected the remaining budget to stop the next run, got %v", err)
+	}
+	if spent := agent.BudgetSpent(); spent.TotalTokens != 45 {
+		t.Errorf("expected one more call on the remaining budget, got %+v", spent)
+	}
+}
+
+type runVerdict struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason"`
+}
+
+func TestRunAs_RepairsInvalidAnswer(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		textReply("Looks good to me."),
+		textReply(`{"approved": true}`),
+		textReply(`{"approved": true, "reason": "tests pass"}`),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "reviewer", Provider: provider})
+
+	verdict, result, err := RunAs[runVerdict](context.Background(), agent, "review this")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !verdict.Approved || verdict.Reason != "tests pass" {
+		t.Errorf("unexpected verdict: %+v", verdict)
+	}
+	if len(result.Steps) != 3 || string(result.Structured) != result.Output {
+		t.Errorf("expected 3 steps and the structured answer as output, got %d steps and %q", len(result.Steps), result.Output)
+	}
+
+	// Without native support the schema is part of the system message
+	if system := provider.Requests()[0].Messages[0].Content; !strings.Contains(system, `"approved"`) {
+		t.Errorf("expected the schema in the system message, got %q", system)
+	}
+}
+
+func TestLLMAgent_Run_ResponseFormatRepairsExhausted(t *testing.T) {
+	format, err := llm.JSONSchemaFormatFor("verdict", runVerdict{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: textReply("no idea")})
+	agent := NewLLMAgent(LLMAgentConfig{Name: "reviewer", Provider: provider, ResponseFormat: format, MaxRepairs: -1})
+
+	if _, err := agent.Run(context.Background(), "review this"); !errors.Is(err, llm.ErrInvalidStructuredOutput) {
+		t.Fatalf("expected ErrInvalidStructuredOutput, got %v", err)
+	}
+	if calls := len(provider.Requests()); calls != 1 {
+		t.Errorf("expected no repair attempts, got %d calls", calls)
+	}
+}
+
+func TestLLMAgent_Run_LogsWithoutContent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1234,"y":5678}`)),
+		textReply("the secret sum is 6912"),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{&mockTool{}}, Logger: logger})
+
+	ctx := llm.WithRequestTags(context.Background(), map[string]string{llm.TagTaskID: "task-7"})
+	if _, err := agent.Run(ctx, "add 1234 and 5678"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"agent=llm", "model=gpt-4o", "task_id=task-7", "tool=adder"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the log, got %q", want, out)
+		}
+	}
+	for _, secret := range []string{"1234", "6912"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaked content %q: %q", secret, out)
+		}
+	}
+}
+
+func TestFormatToolOutput(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, ""},
+		{"plain", "plain"},
+		{float64(3), "3"},
+		{map[string]int{"a": 1}, `{"a":1}`},
+	}
+	for _, c := range cases {
+		if got := formatToolOutput(c.in); got != c.want {
+			t.Errorf("formatToolOutput(%v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
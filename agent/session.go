@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/voocel/mas/llm"
+)
+
+// Session is a multi-turn conversation with an LLMAgent. Its history is sent to the model
+// as real chat turns, trimmed from the oldest turn when it outgrows the context window.
+// Turns within a session run one at a time, separate sessions may share an agent and run
+// concurrently. Sessions keep their own history and do not write to the agent memory.
+type Session struct {
+	id      string
+	agent   *LLMAgent
+	history []llm.Message
+	mu      sync.Mutex
+}
+
+// Session returns the session with the given ID, creating it on first use. An empty ID
+// starts a new session under a generated ID.
+func (a *LLMAgent) Session(id string) *Session {
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+
+	if a.sessions == nil {
+		a.sessions = make(map[string]*Session)
+	}
+	session, ok := a.sessions[id]
+	if !ok {
+		session = &Session{id: id, agent: a}
+		a.sessions[id] = session
+	}
+	return session
+}
+
+// SessionIDs lists the open sessions in sorted order
+func (a *LLMAgent) SessionIDs() []string {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+
+	ids := make([]string, 0, len(a.sessions))
+	for id := range a.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// EndSession forgets a session and its history
+func (a *LLMAgent) EndSession(id string) {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	delete(a.sessions, id)
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Send adds a user turn and runs the tool loop on the conversation so far. The turn and
+// the model's replies, including tool calls and results, are added to the history only
+// when the run succeeds, so a failed turn can simply be sent again.
+func (s *Session) Send(ctx context.Context, input interface{}) (*RunResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.agent
+	hooks := a.hooks()
+	if image, ok := input.(*ImageInput); ok && image != nil {
+		input = *image
+	}
+	if err := hooks.perceive(ctx, input); err != nil {
+		return nil, hooks.error(ctx, err)
+	}
+	input, err := a.guardInput(ctx, input)
+	if err != nil {
+		return nil, hooks.error(ctx, err)
+	}
+	user, err := userMessage(input)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withTools(ctx, a.GetTools())
+	messages := a.sessionMessages(ctx, s.history, user)
+	result, err := a.loop(ctx, messages, runOptions{format: a.responseFormat, stateless: true})
+	if err == nil {
+		err = a.guardResult(ctx, result)
+	}
+	if err != nil {
+		return result, hooks.error(ctx, err)
+	}
+	hooks.actResult(ctx, result.Output)
+
+	// The model saw a trimmed history, but the session keeps the original turns
+	s.history = append(s.history, user)
+	s.history = append(s.history, result.Messages[len(messages):]...)
+	return result, nil
+}
+
+// Messages returns a copy of the conversation history, without the system message
+func (s *Session) Messages() []llm.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.Message(nil), s.history...)
+}
+
+// Reset clears the conversation history
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = nil
+}
+
+// userMessage turns a session input into a user turn, attaching the images of an ImageInput
+func userMessage(input interface{}) (llm.Message, error) {
+	if image, ok := input.(*ImageInput); ok && image != nil {
+		input = *image
+	}
+	if image, ok := input.(ImageInput); ok {
+		resolved, err := image.resolve()
+		if err != nil {
+			return llm.Message{}, fmt.Errorf("invalid image input: %w", err)
+		}
+		return llm.Message{Role: llm.RoleUser, Content: resolved.Prompt, Images: resolved.Images}, nil
+	}
+	return llm.Message{Role: llm.RoleUser, Content: formatInput(input)}, nil
+}
+
+// sessionMessages builds the request for a session turn: the system prompt, as much of the
+// history as fits in the context window and the new user turn
+func (a *LLMAgent) sessionMessages(ctx context.Context, history []llm.Message, user llm.Message) []llm.Message {
+	counter := a.counter()
+	budget := &promptBudget{counter: counter, remaining: a.promptTokenLimit(ctx, counter)}
+
+	// The new turn always goes out, cut down if it cannot fit on its own
+	overhead := llm.CountMessageTokens(counter, []llm.Message{{Role: user.Role}})
+	budget.remaining -= overhead
+	user.Content = budget.fit(user.Content, budget.remaining)
+
+	messages := []llm.Message{}
+	if a.systemPrompt != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: a.systemPrompt})
+	}
+	messages = append(messages, fitHistory(budget, history)...)
+	return append(messages, user)
+}
+
+// fitHistory keeps the newest whole turns that fit in the budget. A turn starts at a user
+// message, so an assistant tool call is never separated from its tool results.
+func fitHistory(budget *promptBudget, history []llm.Message) []llm.Message {
+	start := len(history)
+	end := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role != llm.RoleUser {
+			continue
+		}
+		cost := llm.CountMessageTokens(budget.counter, history[i:end])
+		if cost > budget.remaining {
+			break
+		}
+		budget.remaining -= cost
+		start, end = i, i
+	}
+	return history[start:]
+}
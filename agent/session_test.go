@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like a long conversation by the fireplace, these tests make sure the agent remembers what was said earlier in the evening, forgets the oldest stories when the night runs long, and never mixes up who said what at the other table.
+ */
+
+func TestSession_SendsHistoryAsChatTurns(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		textReply("Nice to meet you, Ingrid."),
+		toolCallReply(adderCall("call_1", `{"x":2,"y":3}`)),
+		textReply("Your name is Ingrid and 2+3=5."),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "chat", Provider: provider, SystemPrompt: "Be brief.", Tools: []tools.Tool{&mockTool{}}})
+	session := agent.Session("s1")
+
+	if _, err := session.Send(context.Background(), "My name is Ingrid."); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := session.Send(context.Background(), "What is my name, and what is 2+3?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "Your name is Ingrid and 2+3=5." {
+		t.Errorf("unexpected output: %q", result.Output)
+	}
+
+	second := provider.Requests()[1].Messages
+	roles := make([]string, len(second))
+	for i, msg := range second {
+		roles[i] = msg.Role
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Fatalf("expected the first exchange as chat turns, got %s", got)
+	}
+	if second[0].Content != "Be brief." || second[1].Content != "My name is Ingrid." || second[2].Content != "Nice to meet you, Ingrid." {
+		t.Errorf("unexpected turns: %+v", second)
+	}
+
+	// The history keeps the tool round trip of the second turn
+	history := session.Messages()
+	if len(history) != 6 || history[3].Role != llm.RoleAssistant || history[4].Role != llm.RoleTool {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	// Sessions keep their own history, the agent memory stays untouched
+	if memories, _ := agent.memory.GetRecent(context.Background(), 10); len(memories) != 0 {
+		t.Errorf("expected no memories, got %d", len(memories))
+	}
+}
+
+func TestSession_FailedTurnIsNotRecorded(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Err: llm.ErrServerError, Once: true}, llm.ScriptRule{Response: textReply("ok")})
+	session := NewLLMAgent(LLMAgentConfig{Name: "chat", Provider: provider}).Session("")
+
+	if _, err := session.Send(context.Background(), "hello"); err == nil {
+		t.Fatal("expected the provider error")
+	}
+	if len(session.Messages()) != 0 {
+		t.Errorf("expected the failed turn to be left out of the history")
+	}
+	if _, err := session.Send(context.Background(), "hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(session.Messages()) != 2 {
+		t.Errorf("expected one exchange, got %+v", session.Messages())
+	}
+}
+
+func TestSession_TrimsOldestTurns(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: textReply("noted")})
+	agent := NewLLMAgent(LLMAgentConfig{
+		Name:          "chat",
+		Provider:      provider,
+		ContextWindow: 1100,
+		MaxTokens:     1000,
+		TokenCounter:  llm.TokenCounterFunc(func(s string) int { return len(s) }),
+	})
+	session := agent.Session("long")
+
+	for i := 0; i < 10; i++ {
+		if _, err := session.Send(context.Background(), fmt.Sprintf("fact number %d", i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	requests := provider.Requests()
+	last := requests[len(requests)-1].Messages
+	if len(last) >= 20 {
+		t.Fatalf("expected old turns to be trimmed, got %d messages", len(last))
+	}
+	if last[0].Role != llm.RoleUser {
+		t.Errorf("expected the trimmed history to start with a whole turn, got %s", last[0].Role)
+	}
+	if last[len(last)-1].Content != "fact number 9" {
+		t.Errorf("expected the new turn last, got %q", last[len(last)-1].Content)
+	}
+	if len(session.Messages()) != 20 {
+		t.Errorf("expected the session to keep its full history, got %d messages", len(session.Messages()))
+	}
+}
+
+func TestSession_ConcurrentSessionsShareAgent(t *testing.T) {
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: textReply("ok")})
+	agent := NewLLMAgent(LLMAgentConfig{Name: "chat", Provider: provider})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			session := agent.Session(id)
+			for turn := 0; turn < 3; turn++ {
+				if _, err := session.Send(context.Background(), id+" turn"); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}(fmt.Sprintf("user-%d", i))
+	}
+	wg.Wait()
+
+	if got := len(agent.SessionIDs()); got != 8 {
+		t.Fatalf("expected 8 sessions, got %d", got)
+	}
+	for _, id := range agent.SessionIDs() {
+		for _, msg := range agent.Session(id).Messages() {
+			if msg.Role == llm.RoleUser && msg.Content != id+" turn" {
+				t.Errorf("session %s holds a turn of another session: %q", id, msg.Content)
+			}
+		}
+	}
+
+	agent.EndSession("user-0")
+	if got := len(agent.SessionIDs()); got != 7 {
+		t.Errorf("expected 7 sessions after ending one, got %d", got)
+	}
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/voocel/mas/llm"
+)
+
+// StreamEventType identifies the kind of progress reported by ProcessStream
+type StreamEventType string
+
+const (
+	// StreamEventDelta carries a fragment of model text as it is generated
+	StreamEventDelta StreamEventType = "delta"
+	// StreamEventToolCall announces a tool call the model decided to make
+	StreamEventToolCall StreamEventType = "tool_call"
+	// StreamEventToolResult carries the outcome of a tool call
+	StreamEventToolResult StreamEventType = "tool_result"
+	// StreamEventDone is the last event of a successful run and carries the full result
+	StreamEventDone StreamEventType = "done"
+	// StreamEventError is the last event of a failed run
+	StreamEventError StreamEventType = "error"
+)
+
+// StreamEvent is a single progress update of a streaming run
+type StreamEvent struct {
+	Type       StreamEventType
+	Iteration  int
+	Delta      string
+	ToolCall   *llm.ToolCall
+	ToolResult *ToolResult
+	Usage      *llm.Usage
+	Result     *RunResult
+	Err        error
+}
+
+// ProcessStream runs the same tool loop as Run but reports tokens, tool calls and
+// tool results as they happen. The channel ends with exactly one StreamEventDone or
+// StreamEventError and is then closed. Providers that do not implement
+// llm.StreamingProvider are used through ChatCompletion, yielding one delta per step.
+func (a *LLMAgent) ProcessStream(ctx context.Context, input interface{}) <-chan StreamEvent {
+	events := make(chan StreamEvent)
+
+	go func() {
+		defer close(events)
+
+		emit := func(event StreamEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+
+		result, err := a.run(ctx, input, runOptions{emit: emit, format: a.responseFormat})
+		if err != nil {
+			emit(StreamEvent{Type: StreamEventError, Result: result, Err: err})
+			return
+		}
+		emit(StreamEvent{Type: StreamEventDone, Result: result, Usage: &result.Usage})
+	}()
+
+	return events
+}
+
+// completeStream performs one completion, forwarding text deltas and finished tool calls through emit
+func (a *LLMAgent) completeStream(ctx context.Context, messages []llm.Message, format *llm.ResponseFormat, iteration int, emit func(StreamEvent)) (*llm.ChatCompletionResponse, error) {
+	streamer, ok := a.provider.(llm.StreamingProvider)
+	if !ok {
+		resp, err := a.complete(ctx, messages, format)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) > 0 {
+			a.emitMessage(resp.Choices[0].Message, iteration, emit)
+		}
+		return resp, nil
+	}
+
+	ctx, err := a.checkBudget(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := a.hooks()
+	req := a.buildRequest(ctx, messages, format)
+	if err := hooks.llmRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	stream, err := streamer.ChatCompletionStream(ctx, req)
+	if err != nil {
+		hooks.llmResponse(ctx, req, nil, err, time.Since(start))
+		return nil, fmt.Errorf("LLM stream failed: %w", err)
+	}
+
+	acc := llm.NewStreamAccumulator()
+	for chunk := range stream {
+		if chunk.Err != nil {
+			hooks.llmResponse(ctx, req, nil, chunk.Err, time.Since(start))
+			return nil, fmt.Errorf("LLM stream failed: %w", chunk.Err)
+		}
+		acc.Add(chunk)
+		if chunk.Content != "" {
+			emit(StreamEvent{Type: StreamEventDelta, Iteration: iteration, Delta: chunk.Content})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		hooks.llmResponse(ctx, req, nil, err, time.Since(start))
+		return nil, err
+	}
+
+	resp := acc.Response()
+	hooks.llmResponse(ctx, req, resp, nil, time.Since(start))
+	llm.ChargeBudgets(ctx, resp)
+	for i := range resp.Choices[0].Message.ToolCalls {
+		emit(StreamEvent{Type: StreamEventToolCall, Iteration: iteration, ToolCall: &resp.Choices[0].Message.ToolCalls[i]})
+	}
+	return resp, nil
+}
+
+// emitMessage reports a complete, non-streamed message as stream events
+func (a *LLMAgent) emitMessage(msg llm.Message, iteration int, emit func(StreamEvent)) {
+	if msg.Content != "" {
+		emit(StreamEvent{Type: StreamEventDelta, Iteration: iteration, Delta: msg.Content})
+	}
+	for i := range msg.ToolCalls {
+		emit(StreamEvent{Type: StreamEventToolCall, Iteration: iteration, ToolCall: &msg.ToolCalls[i]})
+	}
+}
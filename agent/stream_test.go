@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/voocel/mas/llm"
+	"github.com/voocel/mas/tools"
+)
+
+/**
+ * Norwegian-style doc: Like watching a river from the bridge, these tests check that every ripple of a streaming run passes by in order—words, tool calls and results—before the current reaches the sea.
+ */
+
+func collectEvents(events <-chan StreamEvent) map[StreamEventType][]StreamEvent {
+	byType := make(map[StreamEventType][]StreamEvent)
+	for event := range events {
+		byType[event.Type] = append(byType[event.Type], event)
+	}
+	return byType
+}
+
+func TestLLMAgent_ProcessStream(t *testing.T) {
+	provider := llm.NewSequenceProvider(
+		toolCallReply(adderCall("call_1", `{"x":1,"y":2}`)),
+		textReply("the sum is 3"),
+	)
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider, Tools: []tools.Tool{&mockTool{}}})
+
+	events := collectEvents(agent.ProcessStream(context.Background(), "add"))
+
+	if len(events[StreamEventDelta]) != 4 {
+		t.Errorf("expected 4 word deltas, got %d", len(events[StreamEventDelta]))
+	}
+	if len(events[StreamEventToolCall]) != 1 || len(events[StreamEventToolResult]) != 1 {
+		t.Errorf("expected one tool call and one tool result event, got %v", events)
+	}
+	done := events[StreamEventDone]
+	if len(done) != 1 || done[0].Result.Output != "the sum is 3" {
+		t.Fatalf("expected a done event with the final answer, got %+v", done)
+	}
+	if done[0].Usage.TotalTokens != 30 {
+		t.Errorf("expected usage of 30 tokens, got %d", done[0].Usage.TotalTokens)
+	}
+}
+
+func TestLLMAgent_ProcessStream_NonStreamingFallback(t *testing.T) {
+	provider := &mockProvider{resp: textReply("plain answer")}
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: provider})
+
+	events := collectEvents(agent.ProcessStream(context.Background(), "hi"))
+
+	if len(events[StreamEventDelta]) != 1 || events[StreamEventDelta][0].Delta != "plain answer" {
+		t.Errorf("expected a single delta with the whole answer, got %+v", events[StreamEventDelta])
+	}
+	if len(events[StreamEventDone]) != 1 {
+		t.Errorf("expected a done event, got %v", events)
+	}
+}
+
+func TestLLMAgent_ProcessStream_Error(t *testing.T) {
+	agent := NewLLMAgent(LLMAgentConfig{Name: "llm", Provider: llm.NewSequenceProvider()})
+
+	events := collectEvents(agent.ProcessStream(context.Background(), "hi"))
+
+	if len(events[StreamEventError]) != 1 || events[StreamEventError][0].Err == nil {
+		t.Errorf("expected a single error event, got %v", events)
+	}
+	if len(events[StreamEventDone]) != 0 {
+		t.Error("expected no done event after an error")
+	}
+}
@@ -35,7 +35,7 @@ func main() {
 	}
 	apiKey := os.Getenv("LLM_API_KEY")
 	baseURL := os.Getenv("LLM_BASE_URL")
-	if baseURL == "" {
+	if baseURL == "" && providerType == "openai" {
 		baseURL = "https://api.openai.com/v1"
 	}
 	model := os.Getenv("LLM_MODEL")
@@ -7,4 +7,10 @@ require (
 	github.com/pkg/errors v0.9.1
 )
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	github.com/pkoukk/tiktoken-go v0.1.7
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+)
+
+require github.com/dlclark/regexp2 v1.10.0 // indirect
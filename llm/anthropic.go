@@ -0,0 +1,423 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// anthropicVersion is the Messages API version this provider speaks
+const anthropicVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens is used when a request does not set MaxTokens, the Messages API requires it
+const anthropicDefaultMaxTokens = 4096
+
+// AnthropicProvider implements Provider on top of the Anthropic Messages API
+type AnthropicProvider struct {
+	id           string
+	apiKey       string
+	baseURL      string
+	defaultModel string
+	httpClient   *http.Client
+}
+
+// NewAnthropicProvider creates an Anthropic provider from the shared LLM config
+func NewAnthropicProvider(config Config) (Provider, error) {
+	if config.APIKey == "" {
+		return nil, ErrAPIKeyNotSet
+	}
+
+	baseURL := "https://api.anthropic.com/v1"
+	if config.BaseURL != "" {
+		baseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+
+	defaultModel := "claude-3-5-sonnet-latest"
+	if config.DefaultModel != "" {
+		defaultModel = config.DefaultModel
+	}
+
+	timeout := 30
+	if config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+
+	return &AnthropicProvider{
+		id:           "anthropic",
+		apiKey:       config.APIKey,
+		baseURL:      baseURL,
+		defaultModel: defaultModel,
+		httpClient: &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+		},
+	}, nil
+}
+
+// ID returns the provider identifier
+func (p *AnthropicProvider) ID() string {
+	return p.id
+}
+
+// anthropicRequest is the Messages API request body
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]string  `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock covers the text, tool_use and tool_result block types
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+// anthropicImageSource is an image given inline as base64 data or by URL
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Type       string                  `json:"type"`
+	Role       string                  `json:"role"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// ChatCompletion sends a chat completion through the Messages API
+func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	body, err := p.buildRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/messages", p.baseURL), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+	p.setHeaders(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, ErrConnectionFailed.WithDetails(err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, classifyHTTPError(resp, respBody)
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	return result.toChatCompletion(), nil
+}
+
+// GetModels lists the models available to the API key
+func (p *AnthropicProvider) GetModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/models", p.baseURL), nil)
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+	p.setHeaders(httpReq)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, ErrConnectionFailed.WithDetails(err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, classifyHTTPError(resp, body)
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, model := range result.Data {
+		models = append(models, model.ID)
+	}
+
+	return models, nil
+}
+
+// Close releases provider resources
+func (p *AnthropicProvider) Close() error {
+	return nil
+}
+
+func (p *AnthropicProvider) setHeaders(req *http.Request) {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+}
+
+// buildRequest maps a chat completion request onto the Messages API: system turns move
+// to the top-level system field, tool results become user tool_result blocks and
+// consecutive turns of the same role are merged because the API requires alternation.
+func (p *AnthropicProvider) buildRequest(req ChatCompletionRequest) (anthropicRequest, error) {
+	out := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		StopSequences: req.Stop,
+	}
+	if out.Model == "" {
+		out.Model = p.defaultModel
+	}
+	if out.MaxTokens <= 0 {
+		out.MaxTokens = anthropicDefaultMaxTokens
+	}
+	if req.Temperature != 0 {
+		temperature := req.Temperature
+		out.Temperature = &temperature
+	}
+	if req.TopP != 0 {
+		topP := req.TopP
+		out.TopP = &topP
+	}
+
+	var system []string
+	for i, msg := range req.Messages {
+		var role string
+		var blocks []anthropicContentBlock
+
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, msg.Content)
+			continue
+		case RoleTool:
+			role = RoleUser
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content, IsError: msg.IsError})
+		case RoleAssistant:
+			role = RoleAssistant
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					input = json.RawMessage("{}")
+				}
+				if !json.Valid(input) {
+					return out, ErrRequestFailed.WithDetails(fmt.Sprintf("tool call %s has invalid JSON arguments", call.ID))
+				}
+				blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		default:
+			role = RoleUser
+			for _, image := range msg.Images {
+				block, err := toAnthropicImage(image)
+				if err != nil {
+					return out, ErrRequestFailed.WithDetails(fmt.Sprintf("message %d: %v", i, err))
+				}
+				blocks = append(blocks, block)
+			}
+			// The API rejects text blocks without text
+			if msg.Content != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		converted, err := toAnthropicTool(tool)
+		if err != nil {
+			return out, err
+		}
+		out.Tools = append(out.Tools, converted)
+	}
+	out.ToolChoice = toAnthropicToolChoice(req.ToolChoice)
+
+	return out, nil
+}
+
+// toAnthropicImage converts an entry of Message.Images into an image block, see ResolveImage
+func toAnthropicImage(image string) (anthropicContentBlock, error) {
+	url, err := ResolveImage(image)
+	if err != nil {
+		return anthropicContentBlock{}, err
+	}
+	if !strings.HasPrefix(url, "data:") {
+		return anthropicContentBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: url}}, nil
+	}
+
+	mediaType, data, err := parseDataURL(url)
+	if err != nil {
+		return anthropicContentBlock{}, err
+	}
+	return anthropicContentBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}}, nil
+}
+
+// toAnthropicTool converts an OpenAI style function description into an Anthropic tool
+func toAnthropicTool(tool map[string]interface{}) (anthropicTool, error) {
+	function, ok := tool["function"].(map[string]interface{})
+	if !ok {
+		return anthropicTool{}, ErrRequestFailed.WithDetails("tool definition is missing its function description")
+	}
+
+	name, _ := function["name"].(string)
+	description, _ := function["description"].(string)
+
+	schema := json.RawMessage(`{"type":"object"}`)
+	if params, ok := function["parameters"]; ok && params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return anthropicTool{}, ErrRequestFailed.WithDetails(fmt.Sprintf("tool %s has an invalid schema: %v", name, err))
+		}
+		schema = data
+	}
+
+	return anthropicTool{Name: name, Description: description, InputSchema: schema}, nil
+}
+
+// toAnthropicToolChoice maps OpenAI tool_choice values onto the Messages API equivalents
+func toAnthropicToolChoice(choice interface{}) map[string]string {
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "auto":
+			return map[string]string{"type": "auto"}
+		case "required":
+			return map[string]string{"type": "any"}
+		case "none":
+			return map[string]string{"type": "none"}
+		}
+	case map[string]interface{}:
+		if function, ok := c["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok {
+				return map[string]string{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
+
+// toChatCompletion maps a Messages API response back to the common response shape
+func (r anthropicResponse) toChatCompletion() *ChatCompletionResponse {
+	msg := Message{Role: RoleAssistant}
+	var text []string
+	for _, block := range r.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "")
+
+	return &ChatCompletionResponse{
+		ID:      r.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   r.Model,
+		Choices: []Choice{{Index: 0, Message: msg, FinishReason: anthropicFinishReason(r.StopReason)}},
+		Usage: Usage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			TotalTokens:      r.Usage.InputTokens + r.Usage.OutputTokens,
+		},
+	}
+}
+
+// anthropicFinishReason maps stop_reason values onto OpenAI style finish reasons
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return FinishReasonStop
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolCalls
+	case "refusal":
+		return FinishReasonContentFilter
+	default:
+		return stopReason
+	}
+}
+
+func init() {
+	DefaultFactory.Register("anthropic", func(config Config) (Provider, error) {
+		return NewAnthropicProvider(config)
+	})
+}
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like an interpreter at a border crossing, these tests make sure every message, tool call and stop signal survives the translation between our common tongue and the Messages API.
+ */
+
+func TestAnthropicProvider_RegisteredInDefaultFactory(t *testing.T) {
+	provider, err := DefaultFactory.Create(Config{ProviderType: "anthropic", APIKey: "key"})
+	if err != nil {
+		t.Fatalf("expected anthropic provider to be registered, got %v", err)
+	}
+	if provider.ID() != "anthropic" {
+		t.Errorf("expected ID 'anthropic', got %s", provider.ID())
+	}
+}
+
+func TestAnthropicProvider_ChatCompletion(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected request: %s %v", r.URL.Path, r.Header)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{
+			"id": "msg_1",
+			"model": "claude-test",
+			"role": "assistant",
+			"content": [
+				{"type": "text", "text": "Let me search."},
+				{"type": "tool_use", "id": "toolu_2", "name": "search", "input": {"query": "fjords"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 12, "output_tokens": 8}
+		}`))
+	}))
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider(Config{APIKey: "key", BaseURL: server.URL})
+	resp, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{
+			{Role: RoleSystem, Content: "be brief"},
+			{Role: RoleUser, Content: "find fjords"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "toolu_0", Function: FunctionCall{Name: "search", Arguments: `{"query":"a"}`}},
+				{ID: "toolu_1", Function: FunctionCall{Name: "search", Arguments: `{"query":"b"}`}},
+			}},
+			{Role: RoleTool, ToolCallID: "toolu_0", Content: "nothing"},
+			{Role: RoleTool, ToolCallID: "toolu_1", Content: "Error: search is down", IsError: true},
+		},
+		Tools: []map[string]interface{}{{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        "search",
+				"description": "search the web",
+				"parameters":  map[string]interface{}{"type": "object"},
+			},
+		}},
+		ToolChoice: "required",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if received.System != "be brief" {
+		t.Errorf("expected system prompt as a separate field, got %q", received.System)
+	}
+	if received.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("expected default max_tokens, got %d", received.MaxTokens)
+	}
+	if len(received.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %+v", received.Messages)
+	}
+	if blocks := received.Messages[1].Content; len(blocks) != 2 || blocks[0].Type != "tool_use" || string(blocks[0].Input) != `{"query":"a"}` {
+		t.Errorf("expected assistant tool_use blocks, got %+v", blocks)
+	}
+	if blocks := received.Messages[2].Content; len(blocks) != 2 || blocks[1].Type != "tool_result" || blocks[1].ToolUseID != "toolu_1" {
+		t.Errorf("expected merged tool_result blocks, got %+v", blocks)
+	} else if blocks[0].IsError || !blocks[1].IsError {
+		t.Errorf("expected only the failed tool call flagged as an error, got %+v", blocks)
+	}
+	if len(received.Tools) != 1 || received.Tools[0].Name != "search" || received.ToolChoice["type"] != "any" {
+		t.Errorf("expected converted tools and tool choice, got %+v / %v", received.Tools, received.ToolChoice)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != FinishReasonToolCalls || choice.Message.Content != "Let me search." {
+		t.Errorf("unexpected choice: %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"query": "fjords"}` {
+		t.Errorf("expected tool_use mapped to a tool call, got %+v", choice.Message.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 8 || resp.Usage.TotalTokens != 20 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicProvider_PromptTooLong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`))
+	}))
+	defer server.Close()
+
+	provider, _ := NewAnthropicProvider(Config{APIKey: "key", BaseURL: server.URL})
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Content: "a very long prompt"}},
+	})
+	if !errors.Is(err, ErrContextLengthExceeded) {
+		t.Errorf("expected ErrContextLengthExceeded, got %v", err)
+	}
+}
+
+func TestAnthropicFinishReason(t *testing.T) {
+	cases := map[string]string{
+		"end_turn":      FinishReasonStop,
+		"stop_sequence": FinishReasonStop,
+		"max_tokens":    FinishReasonLength,
+		"tool_use":      FinishReasonToolCalls,
+	}
+	for in, want := range cases {
+		if got := anthropicFinishReason(in); got != want {
+			t.Errorf("anthropicFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnthropicBuildRequest_ImagesAndEmptyText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pixel.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &AnthropicProvider{defaultModel: "claude-test"}
+	out, err := provider.buildRequest(ChatCompletionRequest{Messages: []Message{
+		{Role: RoleUser, Content: "", Images: []string{path, "https://example.com/cat.jpg"}},
+		{Role: RoleUser, Content: "what is this?"},
+		{Role: RoleUser},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := json.Marshal(out)
+	if strings.Contains(string(data), `{"type":"text"}`) {
+		t.Errorf("expected empty text blocks to be skipped, got %s", data)
+	}
+	if len(out.Messages) != 1 {
+		t.Fatalf("expected one merged user turn, got %+v", out.Messages)
+	}
+	blocks := out.Messages[0].Content
+	if len(blocks) != 3 || blocks[2].Type != "text" || blocks[2].Text != "what is this?" {
+		t.Fatalf("expected two images and the question, got %+v", blocks)
+	}
+	if source := blocks[0].Source; blocks[0].Type != "image" || source.Type != "base64" || source.MediaType != "image/png" || source.Data == "" {
+		t.Errorf("expected the file as a base64 image, got %+v", blocks[0])
+	}
+	if source := blocks[1].Source; source == nil || source.Type != "url" || source.URL != "https://example.com/cat.jpg" {
+		t.Errorf("expected a url image, got %+v", blocks[1])
+	}
+
+	if _, err := provider.buildRequest(ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Images: []string{"not an image"}}}}); !errors.Is(err, ErrRequestFailed) {
+		t.Errorf("expected an invalid image to fail the request, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned instead of calling the provider once a token or cost budget is spent
+var ErrBudgetExceeded = LLMError{Code: "budget_exceeded", Message: "Token or cost budget exceeded"}
+
+// Budget limits the tokens and cost spent on LLM calls, zero fields are unlimited
+type Budget struct {
+	MaxTokens int     `json:"max_tokens,omitempty"`
+	MaxCost   float64 `json:"max_cost_usd,omitempty"`
+}
+
+// IsZero reports whether the budget is unlimited
+func (b Budget) IsZero() bool {
+	return b.MaxTokens <= 0 && b.MaxCost <= 0
+}
+
+// BudgetTracker charges completions against a budget, it is safe for concurrent use
+type BudgetTracker struct {
+	name   string
+	budget Budget
+	spent  UsageTotals
+	mu     sync.Mutex
+}
+
+// NewBudgetTracker creates a tracker, name says whose budget it is in errors, e.g. "task 42"
+func NewBudgetTracker(name string, budget Budget) *BudgetTracker {
+	return &BudgetTracker{name: name, budget: budget}
+}
+
+// Check fails with ErrBudgetExceeded when the budget is spent or when a prompt of
+// promptTokens would not fit in what is left of it
+func (t *BudgetTracker) Check(promptTokens int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.budget.MaxTokens > 0 && t.spent.TotalTokens+promptTokens >= t.budget.MaxTokens {
+		if t.spent.TotalTokens >= t.budget.MaxTokens {
+			return ErrBudgetExceeded.WithDetails(fmt.Sprintf("%s spent %d of %d tokens", t.name, t.spent.TotalTokens, t.budget.MaxTokens))
+		}
+		return ErrBudgetExceeded.WithDetails(fmt.Sprintf("%s has %d of %d tokens left, the prompt needs about %d", t.name, t.budget.MaxTokens-t.spent.TotalTokens, t.budget.MaxTokens, promptTokens))
+	}
+	if t.budget.MaxCost > 0 && t.spent.Cost >= t.budget.MaxCost {
+		return ErrBudgetExceeded.WithDetails(fmt.Sprintf("%s spent $%.4f of $%.4f", t.name, t.spent.Cost, t.budget.MaxCost))
+	}
+	return nil
+}
+
+// Charge records the usage of a completion, priced from the model price table
+func (t *BudgetTracker) Charge(resp *ChatCompletionResponse) {
+	if resp == nil {
+		return
+	}
+	entry := UsageEntry{
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+	if entry.TotalTokens == 0 {
+		entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+	}
+	if price, ok := PriceFor(resp.Model); ok {
+		entry.Cost = price.Cost(resp.Usage)
+	}
+
+	t.mu.Lock()
+	t.spent.add(entry)
+	t.mu.Unlock()
+}
+
+// Spent returns what has been charged so far
+func (t *BudgetTracker) Spent() UsageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spent
+}
+
+// Budget returns the limits being enforced
+func (t *BudgetTracker) Budget() Budget {
+	return t.budget
+}
+
+type budgetsKey struct{}
+
+// WithBudgets returns a context whose LLM calls are also charged against the given trackers
+func WithBudgets(ctx context.Context, trackers ...*BudgetTracker) context.Context {
+	existing := Budgets(ctx)
+	merged := make([]*BudgetTracker, 0, len(existing)+len(trackers))
+	merged = append(merged, existing...)
+	for _, tracker := range trackers {
+		if tracker != nil {
+			merged = append(merged, tracker)
+		}
+	}
+	return context.WithValue(ctx, budgetsKey{}, merged)
+}
+
+// Budgets returns the trackers carried by ctx, outermost first
+func Budgets(ctx context.Context) []*BudgetTracker {
+	trackers, _ := ctx.Value(budgetsKey{}).([]*BudgetTracker)
+	return trackers
+}
+
+// CheckBudgets checks every tracker carried by ctx
+func CheckBudgets(ctx context.Context, promptTokens int) error {
+	for _, tracker := range Budgets(ctx) {
+		if err := tracker.Check(promptTokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChargeBudgets charges a completion to every tracker carried by ctx
+func ChargeBudgets(ctx context.Context, resp *ChatCompletionResponse) {
+	for _, tracker := range Budgets(ctx) {
+		tracker.Charge(resp)
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: The cabin stove burns only the wood that was stacked for the winter, and when the stack is gone the fire is not fed from the walls—these tests check that budgets are charged and enforced before another call is made.
+ */
+
+func TestBudgetTracker_Tokens(t *testing.T) {
+	tracker := NewBudgetTracker("agent writer", Budget{MaxTokens: 100})
+	if err := tracker.Check(10); err != nil {
+		t.Fatalf("unexpected error on fresh budget: %v", err)
+	}
+
+	tracker.Charge(&ChatCompletionResponse{Usage: Usage{PromptTokens: 60, CompletionTokens: 20}})
+	if spent := tracker.Spent(); spent.TotalTokens != 80 || spent.Requests != 1 {
+		t.Errorf("unexpected spend %+v", spent)
+	}
+
+	err := tracker.Check(50)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected a prompt larger than the remainder to be refused, got %v", err)
+	}
+	if !strings.Contains(err.(LLMError).Details, "agent writer has 20 of 100 tokens left") {
+		t.Errorf("unexpected details %q", err.(LLMError).Details)
+	}
+
+	tracker.Charge(&ChatCompletionResponse{Usage: Usage{TotalTokens: 30}})
+	if err := tracker.Check(0); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("expected a spent budget to be refused, got %v", err)
+	}
+}
+
+func TestBudgetTracker_Cost(t *testing.T) {
+	tracker := NewBudgetTracker("task 1", Budget{MaxCost: 1})
+	tracker.Charge(&ChatCompletionResponse{Model: "gpt-4o", Usage: Usage{PromptTokens: 200000}})
+	if err := tracker.Check(0); err != nil {
+		t.Fatalf("expected $0.50 of $1 to be affordable, got %v", err)
+	}
+	tracker.Charge(&ChatCompletionResponse{Model: "gpt-4o", Usage: Usage{PromptTokens: 200000}})
+	if err := tracker.Check(0); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("expected the cost budget to be exhausted, got %v", err)
+	}
+}
+
+func TestBudgets_Context(t *testing.T) {
+	task := NewBudgetTracker("task", Budget{MaxTokens: 1000})
+	agent := NewBudgetTracker("agent", Budget{MaxTokens: 10})
+	ctx := WithBudgets(WithBudgets(context.Background(), task), agent, nil)
+
+	if got := len(Budgets(ctx)); got != 2 {
+		t.Fatalf("expected 2 trackers, got %d", got)
+	}
+
+	ChargeBudgets(ctx, &ChatCompletionResponse{Usage: Usage{TotalTokens: 10}})
+	if task.Spent().TotalTokens != 10 || agent.Spent().TotalTokens != 10 {
+		t.Error("expected every tracker to be charged")
+	}
+	if err := CheckBudgets(ctx, 0); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("expected the agent budget to stop the call, got %v", err)
+	}
+	if err := CheckBudgets(context.Background(), 0); err != nil {
+		t.Errorf("expected no budget to mean no limit, got %v", err)
+	}
+}
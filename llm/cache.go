@@ -0,0 +1,298 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ExtraCacheHit is set to true in resp.Extra when a response was served from the cache
+const ExtraCacheHit = "cache_hit"
+
+// ExtraCacheBypass set to true in req.Extra skips the cache lookup for that request, see WithCacheBypass
+const ExtraCacheBypass = "cache_bypass"
+
+// CacheStore keeps responses by request key. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the response stored under key unless it is missing or expired
+	Get(key string) (*ChatCompletionResponse, bool)
+
+	// Set stores a response, ttl <= 0 keeps it until it is evicted
+	Set(key string, resp *ChatCompletionResponse, ttl time.Duration) error
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose requests skip the cache lookup. The fresh
+// responses are still stored, so bypassing also refreshes the cache.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context, req ChatCompletionRequest) bool {
+	if bypass, _ := ctx.Value(cacheBypassKey{}).(bool); bypass {
+		return true
+	}
+	bypass, _ := req.Extra[ExtraCacheBypass].(bool)
+	return bypass
+}
+
+// IsCacheHit reports whether resp was served from the cache
+func IsCacheHit(resp *ChatCompletionResponse) bool {
+	if resp == nil {
+		return false
+	}
+	hit, _ := resp.Extra[ExtraCacheHit].(bool)
+	return hit
+}
+
+// Cache answers repeated identical requests from store. Requests are keyed by RequestKey,
+// which covers the model, messages, sampling parameters, tools and response format but not
+// Extra, so agent names and other tags do not split the cache. Cached responses report zero
+// usage because nothing was spent on them, which keeps ledgers and budgets honest.
+//
+// Only deterministic workloads benefit: with a temperature above zero a cache hit returns
+// one sample where the provider would have returned another.
+func Cache(store CacheStore, ttl time.Duration) Middleware {
+	return func(next Provider) Provider {
+		stream := nextStream(next)
+
+		lookup := func(ctx context.Context, req ChatCompletionRequest) (string, *ChatCompletionResponse) {
+			key, _, err := RequestKey(req)
+			if err != nil {
+				return "", nil
+			}
+			if cacheBypassed(ctx, req) {
+				return key, nil
+			}
+			if resp, ok := store.Get(key); ok {
+				return key, cachedResponse(resp)
+			}
+			return key, nil
+		}
+		save := func(key string, resp *ChatCompletionResponse) {
+			if key != "" && resp != nil && len(resp.Choices) > 0 {
+				// A failing store only costs a future cache miss
+				_ = store.Set(key, resp, ttl)
+			}
+		}
+
+		return &middlewareProvider{
+			next: next,
+			chat: func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+				key, cached := lookup(ctx, req)
+				if cached != nil {
+					return cached, nil
+				}
+				resp, err := next.ChatCompletion(ctx, req)
+				if err == nil {
+					save(key, resp)
+				}
+				return resp, err
+			},
+			stream: func(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+				key, cached := lookup(ctx, req)
+				if cached != nil {
+					return streamResponse(cached), nil
+				}
+				chunks, err := stream(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+
+				acc := NewStreamAccumulator()
+				failed := false
+				return forwardStream(ctx, chunks, func(chunk StreamChunk) {
+					if chunk.Err != nil {
+						failed = true
+						return
+					}
+					acc.Add(chunk)
+				}, func() {
+					if !failed && ctx.Err() == nil {
+						save(key, acc.Response())
+					}
+				}), nil
+			},
+		}
+	}
+}
+
+// cachedResponse marks a stored response as a cache hit that cost nothing
+func cachedResponse(resp *ChatCompletionResponse) *ChatCompletionResponse {
+	resp = cloneResponse(resp)
+	resp.Usage = Usage{}
+	extra := make(map[string]interface{}, len(resp.Extra)+1)
+	for k, v := range resp.Extra {
+		extra[k] = v
+	}
+	extra[ExtraCacheHit] = true
+	resp.Extra = extra
+	return resp
+}
+
+// DefaultCacheCapacity is the number of responses a MemoryCache created with zero capacity holds
+const DefaultCacheCapacity = 1000
+
+// MemoryCache is an in-memory CacheStore evicting the least recently used response
+type MemoryCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+type memoryCacheEntry struct {
+	key       string
+	resp      *ChatCompletionResponse
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an LRU cache, DefaultCacheCapacity when capacity <= 0
+func NewMemoryCache(capacity int) *MemoryCache {
+	if capacity <= 0 {
+		capacity = DefaultCacheCapacity
+	}
+	return &MemoryCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns a copy of the stored response and marks it as recently used
+func (c *MemoryCache) Get(key string) (*ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return cloneResponse(entry.resp), true
+}
+
+// Set stores a copy of resp, evicting the least recently used response when full
+func (c *MemoryCache) Set(key string, resp *ChatCompletionResponse, ttl time.Duration) error {
+	entry := &memoryCacheEntry{key: key, resp: cloneResponse(resp)}
+	if ttl > 0 {
+		entry.expiresAt = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of stored responses, including expired ones not yet evicted
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// DiskCache is a CacheStore keeping one JSON file per response in a directory, so cached
+// completions survive restarts and can be shared between runs
+type DiskCache struct {
+	dir string
+	now func() time.Time
+}
+
+type diskCacheEntry struct {
+	ExpiresAt time.Time               `json:"expires_at,omitempty"`
+	Response  *ChatCompletionResponse `json:"response"`
+}
+
+// NewDiskCache creates a disk cache in dir, creating the directory if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	return &DiskCache{dir: dir, now: time.Now}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get reads a stored response, removing it when it has expired
+func (c *DiskCache) Get(key string) (*ChatCompletionResponse, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry diskCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Response == nil {
+		return nil, false
+	}
+	if !entry.ExpiresAt.IsZero() && !c.now().Before(entry.ExpiresAt) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+// Set writes a response atomically, so concurrent readers never see a partial file
+func (c *DiskCache) Set(key string, resp *ChatCompletionResponse, ttl time.Duration) error {
+	entry := diskCacheEntry{Response: resp}
+	if ttl > 0 {
+		entry.ExpiresAt = c.now().Add(ttl)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// Clear removes every cached response
+func (c *DiskCache) Clear() error {
+	matches, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
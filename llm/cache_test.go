@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/**
+ * Norwegian-style doc: Like a larder stocked in autumn, these tests make sure an answer fetched once is kept, handed out again without another trip to the market, and thrown out once it has gone stale.
+ */
+
+func cacheRequest(content string) ChatCompletionRequest {
+	return ChatCompletionRequest{Model: "gpt-4o", Messages: []Message{{Role: RoleUser, Content: content}}}
+}
+
+func TestCache_ServesRepeatedRequests(t *testing.T) {
+	inner := NewScriptedProvider(ScriptRule{Response: &ChatCompletionResponse{
+		Choices: []Choice{{Message: Message{Role: RoleAssistant, Content: "42"}}},
+		Usage:   Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+	}})
+	provider := Wrap(inner, Cache(NewMemoryCache(0), 0))
+
+	first, err := provider.ChatCompletion(context.Background(), cacheRequest("answer?"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if IsCacheHit(first) || first.Usage.TotalTokens != 12 {
+		t.Errorf("expected a fresh response with usage, got %+v", first)
+	}
+
+	// Extra carries tags such as the agent name and must not split the cache
+	req := cacheRequest("answer?")
+	req.Extra = map[string]interface{}{TagAgent: "other"}
+	second, err := provider.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsCacheHit(second) || second.Choices[0].Message.Content != "42" || second.Usage.TotalTokens != 0 {
+		t.Errorf("expected a free cache hit, got %+v", second)
+	}
+
+	if _, err := provider.ChatCompletion(context.Background(), cacheRequest("different")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := len(inner.Requests()); calls != 2 {
+		t.Errorf("expected 2 provider calls, got %d", calls)
+	}
+}
+
+func TestCache_Bypass(t *testing.T) {
+	inner := NewSequenceProvider(TextResponse("old"), TextResponse("new"))
+	provider := Wrap(inner, Cache(NewMemoryCache(0), 0))
+	ctx := context.Background()
+
+	provider.ChatCompletion(ctx, cacheRequest("q"))
+	resp, err := provider.ChatCompletion(WithCacheBypass(ctx), cacheRequest("q"))
+	if err != nil || resp.Choices[0].Message.Content != "new" {
+		t.Fatalf("expected the bypass to reach the provider, got %v %v", resp, err)
+	}
+
+	// The bypassed response refreshed the cache
+	resp, _ = provider.ChatCompletion(ctx, cacheRequest("q"))
+	if !IsCacheHit(resp) || resp.Choices[0].Message.Content != "new" {
+		t.Errorf("expected the refreshed response from the cache, got %+v", resp)
+	}
+
+	req := cacheRequest("q")
+	req.Extra = map[string]interface{}{ExtraCacheBypass: true}
+	if _, err := provider.ChatCompletion(ctx, req); err == nil {
+		t.Errorf("expected the request flag to bypass the cache and exhaust the script")
+	}
+}
+
+func TestCache_Stream(t *testing.T) {
+	inner := NewSequenceProvider(TextResponse("streamed once"))
+	provider := Wrap(inner, Cache(NewMemoryCache(0), 0)).(StreamingProvider)
+
+	for i := 0; i < 2; i++ {
+		stream, err := provider.ChatCompletionStream(context.Background(), cacheRequest("q"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp, err := CollectStream(stream)
+		if err != nil || resp.Choices[0].Message.Content != "streamed once" {
+			t.Fatalf("unexpected stream result %d: %+v %v", i, resp, err)
+		}
+	}
+	if calls := len(inner.Requests()); calls != 1 {
+		t.Errorf("expected the second stream to be served from the cache, got %d calls", calls)
+	}
+}
+
+func TestMemoryCache_LRUAndTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(2)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", TextResponse("a"), 0)
+	cache.Set("b", TextResponse("b"), time.Minute)
+	cache.Get("a")
+	cache.Set("c", TextResponse("c"), 0)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Errorf("expected the recently used entry to survive")
+	}
+
+	cache.Set("d", TextResponse("d"), time.Minute)
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("d"); ok {
+		t.Errorf("expected the entry to expire after its TTL")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected the expired entry to be removed, %d left", cache.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	if err := cache.Set("key", TextResponse("persisted"), time.Hour); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// A new cache on the same directory sees the stored response
+	reopened, _ := NewDiskCache(dir)
+	reopened.now = cache.now
+	resp, ok := reopened.Get("key")
+	if !ok || resp.Choices[0].Message.Content != "persisted" {
+		t.Fatalf("expected the stored response, got %+v", resp)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := reopened.Get("key"); ok {
+		t.Errorf("expected the response to expire")
+	}
+
+	cache.Set("other", TextResponse("x"), 0)
+	if err := cache.Clear(); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	if _, ok := cache.Get("other"); ok {
+		t.Errorf("expected Clear to remove every response")
+	}
+}
@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNoRecordedResponse is returned by a ReplayProvider when a request was never recorded
+var ErrNoRecordedResponse = LLMError{Code: "no_recorded_response", Message: "No recorded response matches the request"}
+
+// Cassette is the on-disk record of provider exchanges
+type Cassette struct {
+	Provider     string        `json:"provider"`
+	Models       []string      `json:"models,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and its response or error
+type Interaction struct {
+	Key      string          `json:"key"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    *LLMError       `json:"error,omitempty"`
+}
+
+// RequestKey returns a stable hash of a request, used to match replays against recordings
+func RequestKey(req ChatCompletionRequest) (string, []byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", nil, ErrRequestFailed.WithDetails(fmt.Sprintf("cannot encode request: %v", err))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), data, nil
+}
+
+// LoadCassette reads a cassette from disk
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to disk, creating parent directories as needed
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", path, err)
+	}
+	return nil
+}
+
+// RecordingProvider wraps a real provider and records every exchange into a cassette
+type RecordingProvider struct {
+	inner    Provider
+	path     string
+	cassette Cassette
+	mu       sync.Mutex
+}
+
+// NewRecordingProvider records the exchanges of inner, call Save or Close to write them to path
+func NewRecordingProvider(inner Provider, path string) *RecordingProvider {
+	return &RecordingProvider{
+		inner:    inner,
+		path:     path,
+		cassette: Cassette{Provider: inner.ID(), Interactions: make([]Interaction, 0)},
+	}
+}
+
+// ID returns the wrapped provider's identifier
+func (p *RecordingProvider) ID() string {
+	return p.inner.ID()
+}
+
+// ChatCompletion forwards the request and records the exchange
+func (p *RecordingProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	key, reqData, err := RequestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, callErr := p.inner.ChatCompletion(ctx, req)
+
+	interaction := Interaction{Key: key, Request: reqData}
+	if callErr != nil {
+		recorded := ErrRequestFailed.WithDetails(callErr.Error())
+		var llmErr LLMError
+		if errors.As(callErr, &llmErr) {
+			recorded = llmErr
+		}
+		interaction.Error = &recorded
+	} else {
+		respData, err := json.Marshal(resp)
+		if err != nil {
+			return nil, ErrResponseInvalid.WithDetails(fmt.Sprintf("cannot record response: %v", err))
+		}
+		interaction.Response = respData
+	}
+
+	p.mu.Lock()
+	p.cassette.Interactions = append(p.cassette.Interactions, interaction)
+	p.mu.Unlock()
+
+	return resp, callErr
+}
+
+// GetModels forwards to the wrapped provider and records the model list
+func (p *RecordingProvider) GetModels(ctx context.Context) ([]string, error) {
+	models, err := p.inner.GetModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cassette.Models = append([]string(nil), models...)
+	p.mu.Unlock()
+
+	return models, nil
+}
+
+// Save writes the recorded exchanges to the cassette file
+func (p *RecordingProvider) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cassette.Save(p.path)
+}
+
+// Close saves the cassette and closes the wrapped provider
+func (p *RecordingProvider) Close() error {
+	if err := p.Save(); err != nil {
+		return err
+	}
+	return p.inner.Close()
+}
+
+// ReplayProvider answers requests from a recorded cassette without any network access.
+// Identical requests are answered in the order they were recorded.
+type ReplayProvider struct {
+	cassette *Cassette
+	cursor   map[string]int
+	mu       sync.Mutex
+}
+
+// NewReplayProvider loads a cassette written by a RecordingProvider
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayProviderFromCassette(cassette), nil
+}
+
+// NewReplayProviderFromCassette replays an in-memory cassette
+func NewReplayProviderFromCassette(cassette *Cassette) *ReplayProvider {
+	return &ReplayProvider{
+		cassette: cassette,
+		cursor:   make(map[string]int),
+	}
+}
+
+// ID returns the identifier of the provider that was recorded
+func (p *ReplayProvider) ID() string {
+	return p.cassette.Provider
+}
+
+// ChatCompletion returns the recorded response for an identical request
+func (p *ReplayProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key, _, err := RequestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := 0
+	for _, interaction := range p.cassette.Interactions {
+		if interaction.Key != key {
+			continue
+		}
+		if seen < p.cursor[key] {
+			seen++
+			continue
+		}
+		p.cursor[key]++
+
+		if interaction.Error != nil {
+			return nil, *interaction.Error
+		}
+		var resp ChatCompletionResponse
+		if err := json.Unmarshal(interaction.Response, &resp); err != nil {
+			return nil, ErrResponseInvalid.WithDetails(fmt.Sprintf("recorded response for %s is corrupt: %v", key, err))
+		}
+		return &resp, nil
+	}
+
+	return nil, ErrNoRecordedResponse.WithDetails("request key " + key)
+}
+
+// GetModels returns the recorded model list
+func (p *ReplayProvider) GetModels(ctx context.Context) ([]string, error) {
+	return append([]string(nil), p.cassette.Models...), nil
+}
+
+// Close releases provider resources
+func (p *ReplayProvider) Close() error {
+	return nil
+}
+
+func init() {
+	DefaultFactory.Register("replay", func(config Config) (Provider, error) {
+		path, _ := config.Extra["cassette"].(string)
+		if path == "" {
+			return nil, ErrProviderNotSupported.WithDetails(`replay provider requires Extra["cassette"] with the cassette path`)
+		}
+		return NewReplayProvider(path)
+	})
+}
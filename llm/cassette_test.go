@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a ship's log read back at the next voyage, a cassette lets a test sail the same waters without ever leaving the harbour. These tests check that what was written down is replayed exactly.
+ */
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "flow.json")
+	first := ChatCompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "hello"}}}
+	second := ChatCompletionRequest{Model: "m", Messages: []Message{{Role: RoleUser, Content: "again"}}}
+
+	live := NewScriptedProvider(
+		ScriptRule{Match: MatchLastMessageContains("hello"), Response: TextResponse("hi there"), Once: true},
+		ScriptRule{Match: MatchLastMessageContains("hello"), Response: TextResponse("hi again")},
+		ScriptRule{Err: ErrRequestFailed.WithDetails("status code: 500")},
+	)
+	recorder := NewRecordingProvider(live, path)
+	ctx := context.Background()
+
+	recorded1, _ := recorder.ChatCompletion(ctx, first)
+	recorded2, _ := recorder.ChatCompletion(ctx, first)
+	if _, err := recorder.ChatCompletion(ctx, second); err == nil {
+		t.Fatal("expected scripted error while recording")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("failed to save cassette: %v", err)
+	}
+
+	replay, err := DefaultFactory.Create(Config{ProviderType: "replay", Extra: map[string]interface{}{"cassette": path}})
+	if err != nil {
+		t.Fatalf("failed to create replay provider: %v", err)
+	}
+	if replay.ID() != "scripted" {
+		t.Errorf("expected recorded provider ID, got %s", replay.ID())
+	}
+
+	for _, want := range []*ChatCompletionResponse{recorded1, recorded2} {
+		got, err := replay.ChatCompletion(ctx, first)
+		if err != nil {
+			t.Fatalf("unexpected replay error: %v", err)
+		}
+		wantJSON, _ := json.Marshal(want)
+		gotJSON, _ := json.Marshal(got)
+		if string(wantJSON) != string(gotJSON) {
+			t.Errorf("replay differs from recording:\nwant %s\ngot  %s", wantJSON, gotJSON)
+		}
+	}
+
+	var llmErr LLMError
+	if _, err := replay.ChatCompletion(ctx, second); !errors.As(err, &llmErr) || llmErr.Details != "status code: 500" {
+		t.Errorf("expected recorded error to be replayed, got %v", err)
+	}
+	if _, err := replay.ChatCompletion(ctx, first); !errors.As(err, &llmErr) || llmErr.Code != ErrNoRecordedResponse.Code {
+		t.Errorf("expected ErrNoRecordedResponse once recordings are exhausted, got %v", err)
+	}
+}
+
+func TestReplayProvider_RequiresCassettePath(t *testing.T) {
+	if _, err := DefaultFactory.Create(Config{ProviderType: "replay"}); err == nil {
+		t.Error("expected error without a cassette path")
+	}
+}
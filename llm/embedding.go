@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into vectors for similarity search
+type Embedder interface {
+	// Embed returns one vector per text, in the order of texts
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// Embed calls f
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(ctx, texts)
+}
+
+// CosineSimilarity compares two vectors, returning 0 when either is empty or their
+// lengths differ
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+const (
+	// DefaultEmbeddingModel is used by NewOpenAIEmbedder when Config.DefaultModel is empty
+	DefaultEmbeddingModel = "text-embedding-3-small"
+	// maxEmbeddingBatch is the most inputs sent in a single /embeddings request
+	maxEmbeddingBatch = 512
+)
+
+// OpenAIEmbedder calls the OpenAI /embeddings endpoint, sharing the chat provider's
+// authentication, retries and error classification
+type OpenAIEmbedder struct {
+	provider   *OpenAIProvider
+	model      string
+	dimensions int
+}
+
+// NewOpenAIEmbedder creates an embedder. Config.DefaultModel selects the embedding model
+// and Config.Extra["dimensions"] optionally shortens the vectors of models that support it.
+func NewOpenAIEmbedder(config Config) (*OpenAIEmbedder, error) {
+	model := DefaultEmbeddingModel
+	if config.DefaultModel != "" {
+		model = config.DefaultModel
+	}
+
+	provider, err := NewOpenAIProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dimensions, err := extraCount(config.Extra, "dimensions")
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIEmbedder{provider: provider.(*OpenAIProvider), model: model, dimensions: dimensions}, nil
+}
+
+// extraCount reads a non-negative whole number from Config.Extra, 0 when it is not set.
+// Numbers decoded from JSON or YAML arrive as float64 or int64 rather than int.
+func extraCount(extra map[string]interface{}, key string) (int, error) {
+	var n float64
+	switch v := extra[key].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		n = float64(v)
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, ErrInvalidConfig.WithDetails(fmt.Sprintf("%s must be a number, got %q", key, v))
+		}
+		n = f
+	default:
+		return 0, ErrInvalidConfig.WithDetails(fmt.Sprintf("%s must be a number, got %T", key, v))
+	}
+	if n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+		return 0, ErrInvalidConfig.WithDetails(fmt.Sprintf("%s must be a non-negative whole number, got %v", key, n))
+	}
+	return int(n), nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+}
+
+// Embed embeds texts in batches of at most maxEmbeddingBatch inputs
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbeddingBatch {
+		end := min(start+maxEmbeddingBatch, len(texts))
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(openAIEmbeddingRequest{Model: e.model, Input: texts, Dimensions: e.dimensions})
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+
+	p := e.provider
+	resp, err := p.post(ctx, p.httpClient, fmt.Sprintf("%s/embeddings", p.baseURL), reqBody, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	var result openAIEmbeddingResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, ErrResponseInvalid.WithDetails(err.Error())
+	}
+	if len(result.Data) != len(texts) {
+		return nil, ErrResponseInvalid.WithDetails(fmt.Sprintf("expected %d embeddings, got %d", len(texts), len(result.Data)))
+	}
+
+	// The API documents data in input order, but index is authoritative
+	sort.Slice(result.Data, func(i, j int) bool { return result.Data[i].Index < result.Data[j].Index })
+	vectors := make([][]float32, len(result.Data))
+	for i, item := range result.Data {
+		vectors[i] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// Model returns the embedding model in use
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// DefaultHashDimensions is the vector size of a HashEmbedder created with zero dimensions
+const DefaultHashDimensions = 256
+
+// HashEmbedder is a deterministic, offline Embedder for tests and local development. It
+// hashes words and their character trigrams into a fixed-size vector, so texts sharing
+// vocabulary are similar, but it captures no meaning beyond that.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder creates a hashing embedder, DefaultHashDimensions when dimensions <= 0
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = DefaultHashDimensions
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Dimensions returns the length of the produced vectors
+func (e *HashEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+// Embed returns an L2-normalized vector per text, the zero vector for texts without words
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		e.add(vector, word, 1)
+		padded := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			e.add(vector, string(padded[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector
+}
+
+// add hashes a feature into a bucket, a second hash bit picks the sign so that
+// collisions tend to cancel out
+func (e *HashEmbedder) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[sum%uint64(e.dimensions)] += weight
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/**
+ * Norwegian-style doc: Like a cartographer placing every village on the same map, these tests check that texts become vectors in a stable order and scale, so that neighbours on the map are neighbours in meaning.
+ */
+
+func newTestOpenAIEmbedder(t *testing.T, handler http.HandlerFunc) *OpenAIEmbedder {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	embedder, err := NewOpenAIEmbedder(Config{APIKey: "test-key", BaseURL: server.URL, Extra: map[string]interface{}{"dimensions": 3}})
+	if err != nil {
+		t.Fatalf("failed to create embedder: %v", err)
+	}
+	embedder.provider.retry.baseDelay = time.Millisecond
+	return embedder
+}
+
+func TestOpenAIEmbedder_Embed(t *testing.T) {
+	var received openAIEmbeddingRequest
+	embedder := newTestOpenAIEmbedder(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		// Out of order on purpose, index decides the position
+		w.Write([]byte(`{"data":[
+			{"index":1,"embedding":[0,1,0]},
+			{"index":0,"embedding":[1,0,0]}
+		],"model":"text-embedding-3-small"}`))
+	})
+
+	vectors, err := embedder.Embed(context.Background(), []string{"fjord", "glacier"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.Model != DefaultEmbeddingModel || received.Dimensions != 3 || len(received.Input) != 2 {
+		t.Errorf("unexpected request: %+v", received)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("unexpected vectors: %v", vectors)
+	}
+}
+
+func TestNewOpenAIEmbedder_Dimensions(t *testing.T) {
+	embedder, err := NewOpenAIEmbedder(Config{APIKey: "test-key"})
+	if err != nil || embedder.dimensions != 0 {
+		t.Errorf("expected the model's own dimensions when not set, got %v / %v", embedder, err)
+	}
+
+	for name, value := range map[string]interface{}{
+		"int":         256,
+		"int64":       int64(256),
+		"float64":     float64(256),
+		"json number": json.Number("256"),
+	} {
+		embedder, err := NewOpenAIEmbedder(Config{APIKey: "test-key", Extra: map[string]interface{}{"dimensions": value}})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if embedder.dimensions != 256 {
+			t.Errorf("%s: expected 256 dimensions, got %d", name, embedder.dimensions)
+		}
+	}
+
+	for name, value := range map[string]interface{}{
+		"string":     "256",
+		"fraction":   256.5,
+		"negative":   -1,
+		"bad number": json.Number("many"),
+	} {
+		_, err := NewOpenAIEmbedder(Config{APIKey: "test-key", Extra: map[string]interface{}{"dimensions": value}})
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestOpenAIEmbedder_Errors(t *testing.T) {
+	embedder := newTestOpenAIEmbedder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"bad key"}}`))
+	})
+	if _, err := embedder.Embed(context.Background(), []string{"fjord"}); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("expected ErrAuthentication, got %v", err)
+	}
+
+	short := newTestOpenAIEmbedder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0,0]}]}`))
+	})
+	if _, err := short.Embed(context.Background(), []string{"fjord", "glacier"}); !errors.Is(err, ErrResponseInvalid) {
+		t.Errorf("expected ErrResponseInvalid for a missing embedding, got %v", err)
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	embedder := NewHashEmbedder(0)
+	vectors, err := embedder.Embed(context.Background(), []string{
+		"The ferry leaves Bergen at noon",
+		"the ferry LEAVES bergen at noon!",
+		"Quarterly revenue grew by nine percent",
+		"",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vectors[0]) != DefaultHashDimensions {
+		t.Fatalf("expected %d dimensions, got %d", DefaultHashDimensions, len(vectors[0]))
+	}
+
+	if sim := CosineSimilarity(vectors[0], vectors[1]); math.Abs(sim-1) > 1e-6 {
+		t.Errorf("expected case and punctuation to be ignored, similarity %f", sim)
+	}
+	if related, unrelated := CosineSimilarity(vectors[0], vectors[1]), CosineSimilarity(vectors[0], vectors[2]); unrelated >= related {
+		t.Errorf("expected unrelated texts to be less similar: %f >= %f", unrelated, related)
+	}
+	if sim := CosineSimilarity(vectors[0], vectors[3]); sim != 0 {
+		t.Errorf("expected the empty text to embed as the zero vector, similarity %f", sim)
+	}
+
+	again, _ := embedder.Embed(context.Background(), []string{"The ferry leaves Bergen at noon"})
+	for i := range again[0] {
+		if again[0][i] != vectors[0][i] {
+			t.Fatalf("expected deterministic vectors")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageFromBytes encodes image data as a base64 data URL. An empty mimeType is
+// detected from the data.
+func ImageFromBytes(data []byte, mimeType string) string {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}
+
+// ImageFromFile reads a local image and encodes it as a base64 data URL
+func ImageFromFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", path, err)
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("file %s is not an image (%s)", path, mimeType)
+	}
+	return ImageFromBytes(data, mimeType), nil
+}
+
+// maxImageBytes caps the size of an image downloaded by ImageFromURL
+const maxImageBytes = 20 << 20
+
+// ImageFromURL downloads an image and encodes it as a base64 data URL, for providers that
+// cannot fetch images themselves. http.DefaultClient is used when client is nil.
+func ImageFromURL(ctx context.Context, client *http.Client, url string) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid image URL %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download image %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download image %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to download image %s: %w", url, err)
+	}
+	if len(data) > maxImageBytes {
+		return "", fmt.Errorf("image %s is larger than %d bytes", url, maxImageBytes)
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("%s is not an image (%s)", url, mimeType)
+	}
+	return ImageFromBytes(data, mimeType), nil
+}
+
+// ResolveImage normalizes an entry of Message.Images into something a provider can send:
+// http(s) and data URLs are kept, local files are read into data URLs and anything else
+// is taken to be bare base64 image data.
+func ResolveImage(image string) (string, error) {
+	switch {
+	case strings.HasPrefix(image, "http://"), strings.HasPrefix(image, "https://"), strings.HasPrefix(image, "data:"):
+		return image, nil
+	case strings.HasPrefix(image, "file://"):
+		return ImageFromFile(strings.TrimPrefix(image, "file://"))
+	}
+
+	if info, err := os.Stat(image); err == nil && !info.IsDir() {
+		return ImageFromFile(image)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return "", fmt.Errorf("image is neither a URL, a readable file nor base64 data")
+	}
+	return ImageFromBytes(data, ""), nil
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload
+func parseDataURL(url string) (mediaType, data string, err error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !strings.HasPrefix(url, "data:") || !ok || !isBase64 {
+		return "", "", fmt.Errorf("image is not a base64 data URL")
+	}
+	return mediaType, data, nil
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: A postcard of the fjord is worth little if the envelope is addressed wrongly—these tests check that pictures from the web, from disk or from memory all reach the model in a form it can open.
+ */
+
+// pngHeader is enough of a PNG file for content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestResolveImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fjord.png")
+	if err := os.WriteFile(path, pngHeader, 0o644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(pngHeader)
+
+	cases := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{"url", "https://example.com/fjord.jpg", "https://example.com/fjord.jpg"},
+		{"data url", "data:image/gif;base64,R0lG", "data:image/gif;base64,R0lG"},
+		{"file", path, "data:image/png;base64," + encoded},
+		{"file url", "file://" + path, "data:image/png;base64," + encoded},
+		{"bare base64", encoded, "data:image/png;base64," + encoded},
+	}
+	for _, tc := range cases {
+		got, err := ResolveImage(tc.image)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := ResolveImage("/no/such/image.png"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestOpenAIProvider_ImageContentParts(t *testing.T) {
+	var received struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"a fjord"}}]}`))
+	})
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{
+			{Role: RoleSystem, Content: "describe images"},
+			{Role: RoleUser, Content: "what is this?", Images: []string{"https://example.com/a.jpg", ImageFromBytes(pngHeader, "")}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(received.Messages[0].Content) != `"describe images"` {
+		t.Errorf("expected plain string content without images, got %s", received.Messages[0].Content)
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(received.Messages[1].Content, &parts); err != nil {
+		t.Fatalf("expected content parts, got %s", received.Messages[1].Content)
+	}
+	if len(parts) != 3 || parts[0].Type != "text" || parts[0].Text != "what is this?" {
+		t.Fatalf("unexpected parts %+v", parts)
+	}
+	if parts[1].ImageURL.URL != "https://example.com/a.jpg" || !strings.HasPrefix(parts[2].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("unexpected image parts %+v %+v", parts[1].ImageURL, parts[2].ImageURL)
+	}
+}
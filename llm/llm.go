@@ -2,14 +2,42 @@ package llm
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"time"
 )
 
+// Message roles understood by chat completion providers
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a chat turn. IsError flags a tool result that reports a failed tool call.
 type Message struct {
-	Role    string                 `json:"role"`
-	Content string                 `json:"content"`
-	Name    string                 `json:"name,omitempty"`
-	Images  []string               `json:"images,omitempty"`
-	Extra   map[string]interface{} `json:"extra,omitempty"`
+	Role       string                 `json:"role"`
+	Content    string                 `json:"content"`
+	Name       string                 `json:"name,omitempty"`
+	Images     []string               `json:"images,omitempty"`
+	ToolCalls  []ToolCall             `json:"tool_calls,omitempty"`
+	ToolCallID string                 `json:"tool_call_id,omitempty"`
+	IsError    bool                   `json:"is_error,omitempty"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+}
+
+// ToolCall is a structured request from the model to invoke a tool
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall carries the tool name and its JSON encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 type ChatCompletionResponse struct {
@@ -22,6 +50,14 @@ type ChatCompletionResponse struct {
 	Extra   map[string]interface{} `json:"extra,omitempty"`
 }
 
+// Finish reasons reported in Choice.FinishReason, providers map their own values onto these
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonContentFilter = "content_filter"
+)
+
 type Choice struct {
 	Index        int     `json:"index"`
 	Message      Message `json:"message"`
@@ -35,13 +71,18 @@ type Usage struct {
 }
 
 type ChatCompletionRequest struct {
-	Model       string                 `json:"model"`
-	Messages    []Message              `json:"messages"`
-	Temperature float64                `json:"temperature,omitempty"`
-	MaxTokens   int                    `json:"max_tokens,omitempty"`
-	TopP        float64                `json:"top_p,omitempty"`
-	Stop        []string               `json:"stop,omitempty"`
-	Extra       map[string]interface{} `json:"-"`
+	Model       string                   `json:"model"`
+	Messages    []Message                `json:"messages"`
+	Temperature float64                  `json:"temperature,omitempty"`
+	MaxTokens   int                      `json:"max_tokens,omitempty"`
+	TopP        float64                  `json:"top_p,omitempty"`
+	Stop        []string                 `json:"stop,omitempty"`
+	Tools       []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice  interface{}              `json:"tool_choice,omitempty"`
+	Extra       map[string]interface{}   `json:"-"`
+
+	// ResponseFormat requests JSON output, see ApplyResponseFormat for providers without native support
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
 }
 
 type Provider interface {
@@ -54,6 +95,30 @@ type Provider interface {
 	Close() error
 }
 
+// ModelCapabilities describes optional features supported by a model
+type ModelCapabilities struct {
+	Tools  bool `json:"tools"`
+	Vision bool `json:"vision"`
+}
+
+// CapabilityProvider is implemented by providers that can report what a model supports
+type CapabilityProvider interface {
+	ModelCapabilities(ctx context.Context, model string) (ModelCapabilities, error)
+}
+
+// ErrCapabilitiesUnknown is returned by Capabilities for providers that cannot report them
+var ErrCapabilitiesUnknown = LLMError{Code: "capabilities_unknown", Message: "Provider does not report model capabilities"}
+
+// Capabilities reports what model supports on provider, or ErrCapabilitiesUnknown when the
+// provider is not a CapabilityProvider
+func Capabilities(ctx context.Context, provider Provider, model string) (ModelCapabilities, error) {
+	p, ok := provider.(CapabilityProvider)
+	if !ok {
+		return ModelCapabilities{}, ErrCapabilitiesUnknown.WithDetails(provider.ID())
+	}
+	return p.ModelCapabilities(ctx, model)
+}
+
 type Config struct {
 	ProviderType string
 	APIKey       string
@@ -62,6 +127,13 @@ type Config struct {
 	Timeout      int
 	RetryCount   int
 	Extra        map[string]interface{}
+
+	// Middleware is applied by Factory.Create around the created provider, outermost first
+	Middleware []Middleware
+
+	// Logger receives the provider's diagnostics, slog.Default() when nil. Message
+	// content is never logged.
+	Logger *slog.Logger
 }
 
 type Factory struct {
@@ -77,7 +149,6 @@ func NewFactory() *Factory {
 // DefaultFactory is the global provider registry for LLM providers.
 var DefaultFactory = NewFactory()
 
-
 func (f *Factory) Register(
 	providerType string,
 	creator func(Config) (Provider, error),
@@ -90,7 +161,11 @@ func (f *Factory) Create(config Config) (Provider, error) {
 	if !ok {
 		return nil, ErrProviderNotSupported
 	}
-	return creator(config)
+	provider, err := creator(config)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(provider, config.Middleware...), nil
 }
 
 var (
@@ -98,12 +173,27 @@ var (
 	ErrAPIKeyNotSet         = LLMError{Code: "api_key_not_set", Message: "API key not set"}
 	ErrRequestFailed        = LLMError{Code: "request_failed", Message: "Request to LLM provider failed"}
 	ErrResponseInvalid      = LLMError{Code: "response_invalid", Message: "Invalid response from LLM provider"}
+
+	// ErrRateLimited means the provider throttled the request, it is retryable
+	ErrRateLimited = LLMError{Code: "rate_limited", Message: "LLM provider rate limit exceeded"}
+	// ErrAuthentication means the API key was rejected, retrying will not help
+	ErrAuthentication = LLMError{Code: "authentication_failed", Message: "LLM provider rejected the credentials"}
+	// ErrContextLengthExceeded means the prompt does not fit the model's context window
+	ErrContextLengthExceeded = LLMError{Code: "context_length_exceeded", Message: "Prompt exceeds the model context length"}
+	// ErrServerError means the provider failed internally (5xx), it is retryable
+	ErrServerError = LLMError{Code: "server_error", Message: "LLM provider server error"}
+	// ErrConnectionFailed means the provider could not be reached, it is retryable
+	ErrConnectionFailed = LLMError{Code: "connection_failed", Message: "Could not reach LLM provider"}
+	// ErrInvalidConfig means a Config value has the wrong type or is out of range
+	ErrInvalidConfig = LLMError{Code: "invalid_config", Message: "Invalid provider configuration"}
 )
 
 type LLMError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Details    string        `json:"details,omitempty"`
+	StatusCode int           `json:"status_code,omitempty"`
+	RetryAfter time.Duration `json:"-"`
 }
 
 func (e LLMError) Error() string {
@@ -114,3 +204,15 @@ func (e LLMError) WithDetails(details string) LLMError {
 	e.Details = details
 	return e
 }
+
+// Is reports whether target is an LLMError with the same code, so errors.Is(err, ErrRateLimited)
+// matches regardless of details
+func (e LLMError) Is(target error) bool {
+	t, ok := target.(LLMError)
+	return ok && t.Code == e.Code
+}
+
+// IsRetryable reports whether a failed call may succeed when repeated
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) || errors.Is(err, ErrConnectionFailed)
+}
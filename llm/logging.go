@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// Attribute keys used by every log record the framework writes, so records from the
+// providers, agents, tools and orchestrator can be filtered the same way
+const (
+	LogKeyAgent    = "agent"
+	LogKeyTaskID   = "task_id"
+	LogKeyTool     = "tool"
+	LogKeyModel    = "model"
+	LogKeyProvider = "provider"
+)
+
+// Redact builds a log attribute for a value that may contain prompts, replies, tool
+// arguments or credentials. It is logged as its size only, unless the handler was
+// wrapped with RevealContent.
+func Redact(key string, value interface{}) slog.Attr {
+	return slog.Any(key, redacted{value: value})
+}
+
+// redacted hides its value from handlers that resolve it
+type redacted struct {
+	value interface{}
+}
+
+// LogValue reports the size of the value instead of the value itself
+func (r redacted) LogValue() slog.Value {
+	if r.value == nil {
+		return slog.StringValue("[redacted]")
+	}
+	return slog.StringValue(fmt.Sprintf("[redacted %d chars]", utf8.RuneCountInString(fmt.Sprint(r.value))))
+}
+
+// RevealContent wraps a handler so that Redact attributes are logged in full. It is meant
+// for local debugging, never enable it where logs leave the machine.
+func RevealContent(handler slog.Handler) slog.Handler {
+	return revealHandler{next: handler}
+}
+
+type revealHandler struct {
+	next slog.Handler
+}
+
+func (h revealHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h revealHandler) Handle(ctx context.Context, record slog.Record) error {
+	revealed := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		revealed.AddAttrs(reveal(attr))
+		return true
+	})
+	return h.next.Handle(ctx, revealed)
+}
+
+func (h revealHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	revealed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		revealed[i] = reveal(attr)
+	}
+	return revealHandler{next: h.next.WithAttrs(revealed)}
+}
+
+func (h revealHandler) WithGroup(name string) slog.Handler {
+	return revealHandler{next: h.next.WithGroup(name)}
+}
+
+func reveal(attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		revealed := make([]any, len(group))
+		for i, member := range group {
+			revealed[i] = reveal(member)
+		}
+		return slog.Group(attr.Key, revealed...)
+	}
+	if r, ok := attr.Value.Any().(redacted); ok {
+		return slog.Any(attr.Key, r.value)
+	}
+	return attr
+}
+
+// ContextLogger adds the task and agency tags carried by ctx, see WithRequestTags, to logger
+func ContextLogger(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	tags := RequestTags(ctx)
+	if taskID := tags[TagTaskID]; taskID != "" {
+		logger = logger.With(LogKeyTaskID, taskID)
+	}
+	if agency := tags[TagAgency]; agency != "" {
+		logger = logger.With(TagAgency, agency)
+	}
+	return logger
+}
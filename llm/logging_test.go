@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a diary kept in a shared cabin, these tests make sure the log says who came and went without copying down what anyone whispered—unless you are alone and ask for it.
+ */
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("tool call", LogKeyTool, "search", Redact("params", "my password is hunter2"))
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("log leaked redacted content: %q", out)
+	}
+	if !strings.Contains(out, "tool=search") || !strings.Contains(out, "[redacted 22 chars]") {
+		t.Errorf("expected the tool and the size of the params, got %q", out)
+	}
+}
+
+func TestRevealContent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(RevealContent(slog.NewTextHandler(&buf, nil)))
+	logger.With(Redact("prompt", "fjords")).Info("request", slog.Group("call", Redact("reply", "glaciers")))
+
+	out := buf.String()
+	if !strings.Contains(out, "prompt=fjords") || !strings.Contains(out, "call.reply=glaciers") {
+		t.Errorf("expected revealed content, got %q", out)
+	}
+}
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithRequestTags(context.Background(), map[string]string{TagTaskID: "t-1", TagAgency: "crew"})
+	ContextLogger(ctx, slog.New(slog.NewTextHandler(&buf, nil))).Info("step")
+
+	if out := buf.String(); !strings.Contains(out, "task_id=t-1") || !strings.Contains(out, "agency=crew") {
+		t.Errorf("expected task and agency attributes, got %q", out)
+	}
+}
@@ -0,0 +1,418 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// Middleware decorates a Provider, e.g. to throttle, observe or short-circuit requests.
+// Providers are usually shared by every agent, so cross-cutting concerns belong here
+// rather than in the individual providers.
+type Middleware func(Provider) Provider
+
+// Wrap applies middlewares to a provider. The first middleware is the outermost, so
+// Wrap(p, RateLimit(5, 1), WithHooks(h)) throttles before the hooks observe a request.
+func Wrap(provider Provider, middlewares ...Middleware) Provider {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			provider = middlewares[i](provider)
+		}
+	}
+	return provider
+}
+
+// chatFunc and streamFunc are the two calls a middleware can intercept
+type (
+	chatFunc   func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
+	streamFunc func(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error)
+)
+
+// middlewareProvider forwards everything to next except the intercepted calls. It always
+// streams: when next cannot, the complete response is replayed as a stream.
+type middlewareProvider struct {
+	next   Provider
+	chat   chatFunc
+	stream streamFunc
+}
+
+func (p *middlewareProvider) ID() string {
+	return p.next.ID()
+}
+
+func (p *middlewareProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return p.chat(ctx, req)
+}
+
+func (p *middlewareProvider) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+	return p.stream(ctx, req)
+}
+
+// SupportsResponseFormat keeps native structured output available through middleware
+func (p *middlewareProvider) SupportsResponseFormat(model string) bool {
+	return SupportsResponseFormat(p.next, model)
+}
+
+// ModelCapabilities keeps capability probing available through middleware
+func (p *middlewareProvider) ModelCapabilities(ctx context.Context, model string) (ModelCapabilities, error) {
+	return Capabilities(ctx, p.next, model)
+}
+
+func (p *middlewareProvider) GetModels(ctx context.Context) ([]string, error) {
+	return p.next.GetModels(ctx)
+}
+
+func (p *middlewareProvider) Close() error {
+	return p.next.Close()
+}
+
+// Unwrap returns the provider the middleware decorates, see ProviderAs
+func (p *middlewareProvider) Unwrap() Provider {
+	return p.next
+}
+
+// ProviderAs finds a provider of type T in the chain of middleware around provider, e.g.
+// ProviderAs[*OllamaProvider](wrapped) to reach PullModel
+func ProviderAs[T any](provider Provider) (T, bool) {
+	for provider != nil {
+		if target, ok := provider.(T); ok {
+			return target, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() Provider })
+		if !ok {
+			break
+		}
+		provider = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// nextStream starts a stream on provider, falling back to a replayed complete response
+func nextStream(provider Provider) streamFunc {
+	if streamer, ok := provider.(StreamingProvider); ok {
+		return streamer.ChatCompletionStream
+	}
+	return func(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+		resp, err := provider.ChatCompletion(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return streamResponse(resp), nil
+	}
+}
+
+// guard runs acquire before every call and release once the call, or the whole stream, is finished
+func guard(acquire func(ctx context.Context) error, release func()) Middleware {
+	return func(next Provider) Provider {
+		stream := nextStream(next)
+		return &middlewareProvider{
+			next: next,
+			chat: func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+				if err := acquire(ctx); err != nil {
+					return nil, err
+				}
+				defer release()
+				return next.ChatCompletion(ctx, req)
+			},
+			stream: func(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+				if err := acquire(ctx); err != nil {
+					return nil, err
+				}
+				chunks, err := stream(ctx, req)
+				if err != nil {
+					release()
+					return nil, err
+				}
+				return forwardStream(ctx, chunks, nil, release), nil
+			},
+		}
+	}
+}
+
+// forwardStream relays chunks, calling observe for each one and done after the last.
+// Delivery stops when ctx is done so an abandoned stream does not block the relay.
+func forwardStream(ctx context.Context, in <-chan StreamChunk, observe func(StreamChunk), done func()) <-chan StreamChunk {
+	out := make(chan StreamChunk)
+	go func() {
+		defer close(out)
+		defer done()
+		for chunk := range in {
+			if observe != nil {
+				observe(chunk)
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// Drain so the upstream producer can finish
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// RateLimit throttles requests with a token bucket refilled at perSecond tokens per
+// second and holding at most burst tokens. Callers wait for a token or until ctx is done.
+func RateLimit(perSecond float64, burst int) Middleware {
+	if burst < 1 {
+		burst = 1
+	}
+	bucket := &tokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	return guard(bucket.wait, func() {})
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// reserve takes a token if one is available, otherwise it reports how long to wait
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		delay := b.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// ConcurrencyLimit allows at most max requests in flight, a stream counts until it is fully read
+func ConcurrencyLimit(max int) Middleware {
+	if max < 1 {
+		max = 1
+	}
+	slots := make(chan struct{}, max)
+	acquire := func(ctx context.Context) error {
+		select {
+		case slots <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return guard(acquire, func() { <-slots })
+}
+
+// Hooks observe provider traffic. OnResponse receives either the response or the error,
+// for streams it is called once with the assembled response after the last chunk.
+type Hooks struct {
+	OnRequest  func(ctx context.Context, req ChatCompletionRequest)
+	OnResponse func(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, latency time.Duration)
+}
+
+// WithHooks calls the hooks around every request
+func WithHooks(hooks Hooks) Middleware {
+	return func(next Provider) Provider {
+		stream := nextStream(next)
+		before := func(ctx context.Context, req ChatCompletionRequest) time.Time {
+			if hooks.OnRequest != nil {
+				hooks.OnRequest(ctx, req)
+			}
+			return time.Now()
+		}
+		after := func(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, start time.Time) {
+			if hooks.OnResponse != nil {
+				hooks.OnResponse(ctx, req, resp, err, time.Since(start))
+			}
+		}
+
+		return &middlewareProvider{
+			next: next,
+			chat: func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+				start := before(ctx, req)
+				resp, err := next.ChatCompletion(ctx, req)
+				after(ctx, req, resp, err, start)
+				return resp, err
+			},
+			stream: func(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+				start := before(ctx, req)
+				chunks, err := stream(ctx, req)
+				if err != nil {
+					after(ctx, req, nil, err, start)
+					return nil, err
+				}
+
+				acc := NewStreamAccumulator()
+				var streamErr error
+				observe := func(chunk StreamChunk) {
+					if chunk.Err != nil {
+						streamErr = chunk.Err
+						return
+					}
+					acc.Add(chunk)
+				}
+				done := func() {
+					// A stream cut short by cancellation has not succeeded
+					if streamErr == nil {
+						streamErr = ctx.Err()
+					}
+					if streamErr != nil {
+						after(ctx, req, nil, streamErr, start)
+						return
+					}
+					after(ctx, req, acc.Response(), nil, start)
+				}
+				return forwardStream(ctx, chunks, observe, done), nil
+			},
+		}
+	}
+}
+
+// LogRequests logs every request and its outcome at info level, slog.Default() when logger
+// is nil. Message content is only logged as its size, see Redact.
+func LogRequests(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return WithHooks(Hooks{
+		OnRequest: func(ctx context.Context, req ChatCompletionRequest) {
+			ContextLogger(ctx, logger).LogAttrs(ctx, slog.LevelInfo, "llm request",
+				slog.String(LogKeyAgent, agentName(req)),
+				slog.String(LogKeyModel, req.Model),
+				slog.Int("messages", len(req.Messages)),
+				slog.Int("tools", len(req.Tools)))
+		},
+		OnResponse: func(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, latency time.Duration) {
+			logger := ContextLogger(ctx, logger)
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "llm request failed",
+					slog.String(LogKeyAgent, agentName(req)),
+					slog.String(LogKeyModel, req.Model),
+					slog.Duration("latency", latency),
+					slog.String("error", err.Error()))
+				return
+			}
+			logger.LogAttrs(ctx, slog.LevelInfo, "llm response",
+				slog.String(LogKeyAgent, agentName(req)),
+				slog.String(LogKeyModel, resp.Model),
+				slog.Duration("latency", latency),
+				slog.Int("total_tokens", resp.Usage.TotalTokens))
+		},
+	})
+}
+
+// agentName reads the calling agent from the request tags
+func agentName(req ChatCompletionRequest) string {
+	if name, ok := req.Extra[TagAgent].(string); ok && name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// Metrics aggregates request counts, latency and token usage, it is safe for concurrent use
+type Metrics struct {
+	mu      sync.Mutex
+	total   MetricsSnapshot
+	byModel map[string]MetricsSnapshot
+}
+
+// MetricsSnapshot is a point-in-time copy of the collected metrics
+type MetricsSnapshot struct {
+	Requests     int           `json:"requests"`
+	Failures     int           `json:"failures"`
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+	Usage        Usage         `json:"usage"`
+}
+
+// AverageLatency returns the mean latency over all requests
+func (s MetricsSnapshot) AverageLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{byModel: make(map[string]MetricsSnapshot)}
+}
+
+// Middleware records every request passing through the provider
+func (m *Metrics) Middleware() Middleware {
+	return WithHooks(Hooks{OnResponse: m.record})
+}
+
+func (m *Metrics) record(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, latency time.Duration) {
+	model := req.Model
+	if resp != nil && resp.Model != "" {
+		model = resp.Model
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update := func(s MetricsSnapshot) MetricsSnapshot {
+		s.Requests++
+		if err != nil {
+			s.Failures++
+		}
+		s.TotalLatency += latency
+		if latency > s.MaxLatency {
+			s.MaxLatency = latency
+		}
+		if resp != nil {
+			s.Usage.PromptTokens += resp.Usage.PromptTokens
+			s.Usage.CompletionTokens += resp.Usage.CompletionTokens
+			s.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+		return s
+	}
+	m.total = update(m.total)
+	m.byModel[model] = update(m.byModel[model])
+}
+
+// Snapshot returns the totals over all models
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// ByModel returns the metrics per model
+func (m *Metrics) ByModel() map[string]MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]MetricsSnapshot, len(m.byModel))
+	for model, s := range m.byModel {
+		out[model] = s
+	}
+	return out
+}
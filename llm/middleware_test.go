@@ -0,0 +1,254 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ * Norwegian-style doc: One ferry quay serves the whole fjord, so the queue, the harbour master and the tally book sit at the quay rather than on every boat—these tests check that the middleware in front of a shared provider throttles, counts and observes every crossing.
+ */
+
+// slowProvider tracks how many requests are in flight at once
+type slowProvider struct {
+	delay    time.Duration
+	inFlight int32
+	peak     int32
+}
+
+func (p *slowProvider) ID() string { return "slow" }
+
+func (p *slowProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	current := atomic.AddInt32(&p.inFlight, 1)
+	defer atomic.AddInt32(&p.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&p.peak)
+		if current <= peak || atomic.CompareAndSwapInt32(&p.peak, peak, current) {
+			break
+		}
+	}
+	time.Sleep(p.delay)
+	return TextResponse("done"), nil
+}
+
+func (p *slowProvider) GetModels(ctx context.Context) ([]string, error) { return nil, nil }
+
+func (p *slowProvider) Close() error { return nil }
+
+func TestWrap_OrderIsOutermostFirst(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return WithHooks(Hooks{OnRequest: func(ctx context.Context, req ChatCompletionRequest) {
+			order = append(order, name)
+		}})
+	}
+
+	provider := Wrap(NewSequenceProvider(TextResponse("hi")), trace("outer"), trace("inner"))
+	if _, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("expected outer,inner, got %v", order)
+	}
+	if provider.ID() != "scripted" {
+		t.Errorf("expected ID to pass through, got %s", provider.ID())
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	inner := &slowProvider{delay: 20 * time.Millisecond}
+	provider := Wrap(inner, ConcurrencyLimit(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := atomic.LoadInt32(&inner.peak); peak > 2 {
+		t.Errorf("expected at most 2 requests in flight, saw %d", peak)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	provider := Wrap(&slowProvider{}, RateLimit(50, 1))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// One token up front, two more at 50/s take about 40ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected requests to be throttled, took %v", elapsed)
+	}
+
+	starved := Wrap(&slowProvider{}, RateLimit(0.001, 1))
+	starved.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := starved.ChatCompletion(ctx, ChatCompletionRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected cancellation while waiting for a token, got %v", err)
+	}
+}
+
+func TestMetrics_RecordsCallsAndStreams(t *testing.T) {
+	resp := TextResponse("hello there")
+	resp.Model = "m1"
+	resp.Usage = Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+
+	metrics := NewMetrics()
+	provider := Wrap(NewScriptedProvider(
+		ScriptRule{Match: MatchLastMessageContains("fail"), Err: ErrServerError},
+		ScriptRule{Response: resp},
+	), metrics.Middleware())
+
+	provider.ChatCompletion(context.Background(), ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	provider.ChatCompletion(context.Background(), ChatCompletionRequest{Model: "m1", Messages: []Message{{Role: RoleUser, Content: "fail"}}})
+
+	stream, err := provider.(StreamingProvider).ChatCompletionStream(context.Background(), ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if streamed, err := CollectStream(stream); err != nil || streamed.Choices[0].Message.Content != "hello there" {
+		t.Fatalf("unexpected stream result %+v, %v", streamed, err)
+	}
+
+	snapshot := metrics.Snapshot()
+	if snapshot.Requests != 3 || snapshot.Failures != 1 {
+		t.Errorf("expected 3 requests and 1 failure, got %+v", snapshot)
+	}
+	if snapshot.Usage.TotalTokens != 10 {
+		t.Errorf("expected 10 tokens, got %d", snapshot.Usage.TotalTokens)
+	}
+	if got := metrics.ByModel()["m1"].Requests; got != 3 {
+		t.Errorf("expected 3 requests for m1, got %d", got)
+	}
+}
+
+func TestLogRequests_OmitsContent(t *testing.T) {
+	var buf bytes.Buffer
+	provider := Wrap(NewSequenceProvider(TextResponse("secret answer")), LogRequests(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Model:    "gpt-test",
+		Messages: []Message{{Role: RoleUser, Content: "secret question"}},
+		Extra:    map[string]interface{}{"agent_name": "writer"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "agent=writer") || !strings.Contains(out, "model=gpt-test") {
+		t.Errorf("expected agent and model in log, got %q", out)
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("log leaked message content: %q", out)
+	}
+}
+
+func TestFactory_AppliesConfigMiddleware(t *testing.T) {
+	factory := NewFactory()
+	factory.Register("scripted", func(config Config) (Provider, error) {
+		return NewSequenceProvider(TextResponse("ok")), nil
+	})
+
+	metrics := NewMetrics()
+	provider, err := factory.Create(Config{ProviderType: "scripted", Middleware: []Middleware{metrics.Middleware()}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider.ChatCompletion(context.Background(), ChatCompletionRequest{})
+
+	if metrics.Snapshot().Requests != 1 {
+		t.Errorf("expected the factory to wrap the provider with config middleware")
+	}
+}
+
+// hangingStreamProvider sends one chunk and then holds the stream open until ctx is done
+type hangingStreamProvider struct {
+	slowProvider
+}
+
+func (p *hangingStreamProvider) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+	stream := make(chan StreamChunk)
+	go func() {
+		defer close(stream)
+		select {
+		case stream <- StreamChunk{Content: "partial"}:
+		case <-ctx.Done():
+			return
+		}
+		<-ctx.Done()
+	}()
+	return stream, nil
+}
+
+func TestWithHooks_ReportsCancelledStream(t *testing.T) {
+	reported := make(chan error, 1)
+	provider := Wrap(&hangingStreamProvider{}, WithHooks(Hooks{
+		OnResponse: func(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, latency time.Duration) {
+			reported <- err
+		},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := provider.(StreamingProvider).ChatCompletionStream(ctx, ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-stream
+	cancel()
+	for range stream {
+	}
+
+	select {
+	case err := <-reported:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the cancelled stream to be reported as context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected OnResponse after the stream ended")
+	}
+}
+
+func TestMiddleware_ForwardsOllamaExtensions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"capabilities":["completion","tools"]}`))
+	}))
+	defer server.Close()
+	ollama, _ := NewOllamaProvider(Config{BaseURL: server.URL})
+
+	provider := Wrap(ollama, LogRequests(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))), NewMetrics().Middleware())
+
+	caps, err := Capabilities(context.Background(), provider, "llama3.1")
+	if err != nil || !caps.Tools {
+		t.Errorf("expected the wrapped provider's capabilities, got %+v, %v", caps, err)
+	}
+	if found, ok := ProviderAs[*OllamaProvider](provider); !ok || found != ollama {
+		t.Error("expected ProviderAs to reach the ollama provider through the middleware")
+	}
+	if _, ok := ProviderAs[*AnthropicProvider](provider); ok {
+		t.Error("expected ProviderAs to report a missing provider type")
+	}
+	if _, err := Capabilities(context.Background(), Wrap(NewSequenceProvider(), NewMetrics().Middleware()), ""); !errors.Is(err, ErrCapabilitiesUnknown) {
+		t.Errorf("expected ErrCapabilitiesUnknown, got %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaProvider implements Provider on top of a local Ollama server's native API
+type OllamaProvider struct {
+	id           string
+	baseURL      string
+	defaultModel string
+	httpClient   *http.Client
+}
+
+// NewOllamaProvider creates an Ollama provider. No API key is needed, BaseURL defaults
+// to the local server and the timeout is generous because local models can be slow.
+func NewOllamaProvider(config Config) (Provider, error) {
+	baseURL := "http://localhost:11434"
+	if config.BaseURL != "" {
+		baseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+
+	defaultModel := "llama3.1"
+	if config.DefaultModel != "" {
+		defaultModel = config.DefaultModel
+	}
+
+	timeout := 120
+	if config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+
+	return &OllamaProvider{
+		id:           "ollama",
+		baseURL:      baseURL,
+		defaultModel: defaultModel,
+		httpClient: &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+		},
+	}, nil
+}
+
+// ID returns the provider identifier
+func (p *OllamaProvider) ID() string {
+	return p.id
+}
+
+type ollamaChatRequest struct {
+	Model    string                   `json:"model"`
+	Messages []ollamaMessage          `json:"messages"`
+	Tools    []map[string]interface{} `json:"tools,omitempty"`
+	Stream   bool                     `json:"stream"`
+	Format   json.RawMessage          `json:"format,omitempty"`
+	Options  map[string]interface{}   `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaToolCall carries arguments as a JSON object rather than an encoded string
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// ChatCompletion sends a non-streaming request to /api/chat
+func (p *OllamaProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	body, err := p.buildRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ollamaChatResponse
+	if err := p.post(ctx, "/api/chat", body, &result); err != nil {
+		return nil, err
+	}
+
+	return result.toChatCompletion(), nil
+}
+
+// GetModels returns the models available on the local server from /api/tags
+func (p *OllamaProvider) GetModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+
+	var result struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if err := p.do(httpReq, &result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Models))
+	for _, model := range result.Models {
+		name := model.Name
+		if name == "" {
+			name = model.Model
+		}
+		models = append(models, name)
+	}
+
+	return models, nil
+}
+
+// PullModel downloads a model to the local server and blocks until it is available
+func (p *OllamaProvider) PullModel(ctx context.Context, model string) error {
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := p.post(ctx, "/api/pull", map[string]interface{}{"model": model, "stream": false}, &result); err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return ErrRequestFailed.WithDetails(fmt.Sprintf("pull %s: %s", model, result.Error))
+	}
+	return nil
+}
+
+// ModelCapabilities probes /api/show to find out whether a model supports tools or images.
+// Newer servers list capabilities explicitly; older ones are inferred from the chat
+// template and the model families.
+func (p *OllamaProvider) ModelCapabilities(ctx context.Context, model string) (ModelCapabilities, error) {
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	var result struct {
+		Capabilities []string `json:"capabilities"`
+		Template     string   `json:"template"`
+		Details      struct {
+			Families []string `json:"families"`
+		} `json:"details"`
+		ProjectorInfo map[string]interface{} `json:"projector_info"`
+	}
+	if err := p.post(ctx, "/api/show", map[string]string{"model": model}, &result); err != nil {
+		return ModelCapabilities{}, err
+	}
+
+	var caps ModelCapabilities
+	if len(result.Capabilities) > 0 {
+		for _, capability := range result.Capabilities {
+			switch capability {
+			case "tools":
+				caps.Tools = true
+			case "vision":
+				caps.Vision = true
+			}
+		}
+		return caps, nil
+	}
+
+	caps.Tools = strings.Contains(result.Template, ".Tools")
+	caps.Vision = len(result.ProjectorInfo) > 0
+	for _, family := range result.Details.Families {
+		if family == "clip" || family == "mllama" {
+			caps.Vision = true
+		}
+	}
+	return caps, nil
+}
+
+// SupportsResponseFormat reports that Ollama enforces JSON formats for every model
+func (p *OllamaProvider) SupportsResponseFormat(model string) bool {
+	return true
+}
+
+// Close releases provider resources
+func (p *OllamaProvider) Close() error {
+	return nil
+}
+
+// buildRequest converts a chat completion request into the native /api/chat shape
+func (p *OllamaProvider) buildRequest(ctx context.Context, req ChatCompletionRequest) (ollamaChatRequest, error) {
+	out := ollamaChatRequest{
+		Model: req.Model,
+		Tools: req.Tools,
+	}
+	if out.Model == "" {
+		out.Model = p.defaultModel
+	}
+
+	// Ollama takes either "json" or a JSON Schema as the format
+	if format := req.ResponseFormat; format != nil {
+		out.Format = json.RawMessage(`"json"`)
+		if format.Type == ResponseFormatJSONSchema && len(format.Schema) > 0 {
+			out.Format = format.Schema
+		}
+	}
+
+	options := make(map[string]interface{})
+	if req.Temperature != 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.TopP != 0 {
+		options["top_p"] = req.TopP
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if len(options) > 0 {
+		out.Options = options
+	}
+
+	for i, msg := range req.Messages {
+		converted := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, image := range msg.Images {
+			data, err := p.resolveImage(ctx, image)
+			if err != nil {
+				return out, ErrRequestFailed.WithDetails(fmt.Sprintf("message %d: %v", i, err))
+			}
+			converted.Images = append(converted.Images, data)
+		}
+		for _, call := range msg.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Function.Name
+			tc.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if strings.TrimSpace(call.Function.Arguments) == "" {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			if !json.Valid(tc.Function.Arguments) {
+				return out, ErrRequestFailed.WithDetails(fmt.Sprintf("tool call %s has invalid JSON arguments", call.ID))
+			}
+			converted.ToolCalls = append(converted.ToolCalls, tc)
+		}
+		out.Messages = append(out.Messages, converted)
+	}
+
+	return out, nil
+}
+
+// toChatCompletion maps a native chat response back to the common response shape
+func (r ollamaChatResponse) toChatCompletion() *ChatCompletionResponse {
+	msg := Message{Role: r.Message.Role, Content: r.Message.Content}
+	if msg.Role == "" {
+		msg.Role = RoleAssistant
+	}
+
+	// Ollama does not assign tool call IDs, synthesize stable ones so tool results can refer back
+	for i, call := range r.Message.ToolCalls {
+		arguments := string(call.Function.Arguments)
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+			ID:       fmt.Sprintf("call_%d", i),
+			Type:     "function",
+			Function: FunctionCall{Name: call.Function.Name, Arguments: arguments},
+		})
+	}
+
+	finishReason := r.DoneReason
+	switch {
+	case len(msg.ToolCalls) > 0:
+		finishReason = FinishReasonToolCalls
+	case finishReason == "":
+		finishReason = FinishReasonStop
+	}
+
+	return &ChatCompletionResponse{
+		ID:      fmt.Sprintf("ollama-%d", r.CreatedAt.UnixNano()),
+		Object:  "chat.completion",
+		Created: r.CreatedAt.Unix(),
+		Model:   r.Model,
+		Choices: []Choice{{Index: 0, Message: msg, FinishReason: finishReason}},
+		Usage: Usage{
+			PromptTokens:     r.PromptEvalCount,
+			CompletionTokens: r.EvalCount,
+			TotalTokens:      r.PromptEvalCount + r.EvalCount,
+		},
+	}
+}
+
+// post sends a JSON body to an API path and decodes the JSON reply into out
+func (p *OllamaProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return ErrRequestFailed.WithDetails(err.Error())
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return ErrRequestFailed.WithDetails(err.Error())
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return p.do(httpReq, out)
+}
+
+func (p *OllamaProvider) do(httpReq *http.Request, out interface{}) error {
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return ErrConnectionFailed.WithDetails(err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrResponseInvalid.WithDetails(err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		llmErr := classifyHTTPError(resp, body)
+		llmErr.Details = fmt.Sprintf("%s %s: %s", httpReq.Method, httpReq.URL.Path, llmErr.Details)
+		return llmErr
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return ErrResponseInvalid.WithDetails(err.Error())
+	}
+	return nil
+}
+
+// resolveImage turns an entry of Message.Images into the bare base64 payload Ollama expects.
+// Paths are read like for the other providers and URLs are downloaded, as the server
+// does not fetch images.
+func (p *OllamaProvider) resolveImage(ctx context.Context, image string) (string, error) {
+	url, err := ResolveImage(image)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(url, "data:") {
+		if url, err = ImageFromURL(ctx, p.httpClient, url); err != nil {
+			return "", err
+		}
+	}
+	_, data, err := parseDataURL(url)
+	return data, err
+}
+
+func init() {
+	DefaultFactory.Register("ollama", func(config Config) (Provider, error) {
+		return NewOllamaProvider(config)
+	})
+}
@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a cabin stove that keeps working when the power lines are down, the Ollama provider lets agents think offline. These tests stand in for the local server so CI never needs a real model.
+ */
+
+func newTestOllamaServer(t *testing.T) (*OllamaProvider, *map[string]interface{}) {
+	t.Helper()
+	var lastChat map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[{"name":"llama3.1:8b"},{"name":"llava:7b"}]}`))
+	})
+	mux.HandleFunc("/api/show", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req["model"] {
+		case "llama3.1:8b":
+			w.Write([]byte(`{"capabilities":["completion","tools"]}`))
+		case "llava:7b":
+			w.Write([]byte(`{"template":"{{ .Prompt }}","details":{"families":["llama","clip"]}}`))
+		default:
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("/api/pull", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success"}`))
+	})
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&lastChat)
+		w.Write([]byte(`{
+			"model": "llama3.1:8b",
+			"created_at": "2024-07-22T20:33:28.123648Z",
+			"message": {
+				"role": "assistant",
+				"content": "",
+				"tool_calls": [{"function": {"name": "search", "arguments": {"query": "fjords"}}}]
+			},
+			"done": true,
+			"done_reason": "stop",
+			"prompt_eval_count": 20,
+			"eval_count": 6
+		}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	provider, err := DefaultFactory.Create(Config{ProviderType: "ollama", BaseURL: server.URL, DefaultModel: "llama3.1:8b"})
+	if err != nil {
+		t.Fatalf("expected ollama provider to be registered, got %v", err)
+	}
+	return provider.(*OllamaProvider), &lastChat
+}
+
+func TestOllamaProvider_ChatCompletion(t *testing.T) {
+	provider, lastChat := newTestOllamaServer(t)
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{
+			{Role: RoleUser, Content: "describe", Images: []string{"data:image/png;base64,iVBORw0KGgo="}},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Function: FunctionCall{Name: "search", Arguments: `{"query":"a"}`}}}},
+			{Role: RoleTool, ToolCallID: "call_0", Content: "nothing"},
+		},
+		MaxTokens: 64,
+		Tools:     []map[string]interface{}{{"type": "function", "function": map[string]interface{}{"name": "search"}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent := *lastChat
+	if sent["stream"] != false || sent["model"] != "llama3.1:8b" {
+		t.Errorf("expected non-streaming request for the default model, got %v", sent)
+	}
+	if options := sent["options"].(map[string]interface{}); options["num_predict"] != float64(64) {
+		t.Errorf("expected max tokens mapped to num_predict, got %v", options)
+	}
+	messages := sent["messages"].([]interface{})
+	if images := messages[0].(map[string]interface{})["images"].([]interface{}); images[0] != "iVBORw0KGgo=" {
+		t.Errorf("expected bare base64 image, got %v", images)
+	}
+	args := messages[1].(map[string]interface{})["tool_calls"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})["arguments"]
+	if args.(map[string]interface{})["query"] != "a" {
+		t.Errorf("expected tool call arguments sent as an object, got %v", args)
+	}
+
+	choice := resp.Choices[0]
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID == "" || choice.Message.ToolCalls[0].Function.Arguments != `{"query": "fjords"}` {
+		t.Errorf("expected tool call with synthesized ID, got %+v", choice.Message.ToolCalls)
+	}
+	if choice.FinishReason != FinishReasonToolCalls {
+		t.Errorf("expected finish reason tool_calls, got %s", choice.FinishReason)
+	}
+	if resp.Usage.TotalTokens != 26 {
+		t.Errorf("expected usage of 26 tokens, got %+v", resp.Usage)
+	}
+}
+
+func TestOllamaProvider_ResolvesImages(t *testing.T) {
+	provider, lastChat := newTestOllamaServer(t)
+
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngHeader)
+	}))
+	defer images.Close()
+	path := filepath.Join(t.TempDir(), "local.png")
+	if err := os.WriteFile(path, pngHeader, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Content: "compare", Images: []string{images.URL + "/remote.png", path}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := base64.StdEncoding.EncodeToString(pngHeader)
+	sent := (*lastChat)["messages"].([]interface{})[0].(map[string]interface{})["images"].([]interface{})
+	if len(sent) != 2 || sent[0] != want || sent[1] != want {
+		t.Errorf("expected both images as bare base64, got %v", sent)
+	}
+
+	_, err = provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Images: []string{"no such image"}}},
+	})
+	if !errors.Is(err, ErrRequestFailed) {
+		t.Errorf("expected an unresolvable image to fail the request, got %v", err)
+	}
+}
+
+func TestOllamaProvider_GetModelsAndPull(t *testing.T) {
+	provider, _ := newTestOllamaServer(t)
+
+	models, err := provider.GetModels(context.Background())
+	if err != nil || len(models) != 2 || models[0] != "llama3.1:8b" {
+		t.Errorf("expected local models, got %v (err: %v)", models, err)
+	}
+	if err := provider.PullModel(context.Background(), "llama3.1:8b"); err != nil {
+		t.Errorf("unexpected pull error: %v", err)
+	}
+}
+
+func TestOllamaProvider_ModelCapabilities(t *testing.T) {
+	provider, _ := newTestOllamaServer(t)
+	ctx := context.Background()
+
+	caps, err := provider.ModelCapabilities(ctx, "llama3.1:8b")
+	if err != nil || !caps.Tools || caps.Vision {
+		t.Errorf("expected tools without vision, got %+v (err: %v)", caps, err)
+	}
+	caps, err = provider.ModelCapabilities(ctx, "llava:7b")
+	if err != nil || caps.Tools || !caps.Vision {
+		t.Errorf("expected vision inferred from families, got %+v (err: %v)", caps, err)
+	}
+	if _, err := provider.ModelCapabilities(ctx, "missing"); err == nil {
+		t.Error("expected error for unknown model")
+	}
+
+	var _ CapabilityProvider = provider
+}
@@ -1,12 +1,15 @@
 package llm
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -16,6 +19,8 @@ type OpenAIProvider struct {
 	baseURL      string
 	defaultModel string
 	httpClient   *http.Client
+	retry        retryPolicy
+	logger       *slog.Logger
 }
 
 func NewOpenAIProvider(config Config) (Provider, error) {
@@ -38,6 +43,15 @@ func NewOpenAIProvider(config Config) (Provider, error) {
 		timeout = config.Timeout
 	}
 
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With(LogKeyProvider, "openai")
+
+	retry := newRetryPolicy(config.RetryCount)
+	retry.logger = logger
+
 	return &OpenAIProvider{
 		id:           "openai",
 		apiKey:       config.APIKey,
@@ -46,6 +60,8 @@ func NewOpenAIProvider(config Config) (Provider, error) {
 		httpClient: &http.Client{
 			Timeout: time.Duration(timeout) * time.Second,
 		},
+		retry:  retry,
+		logger: logger,
 	}, nil
 }
 
@@ -58,64 +74,259 @@ func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req ChatCompletionR
 		req.Model = p.defaultModel
 	}
 
-	reqURL := fmt.Sprintf("%s/chat/completions", p.baseURL)
-
-	// Check if agent name exists in extra information
-	agentName := "Unknown Agent"
-	if req.Extra != nil {
-		if name, ok := req.Extra["agent_name"].(string); ok && name != "" {
-			agentName = name
-		}
-	}
-
-	fmt.Printf("Agent[%s] sending request to OpenAI: model=%s\n", agentName, req.Model)
-
-	reqBody, err := json.Marshal(req)
+	wireReq, err := newOpenAIChatRequest(req)
 	if err != nil {
-		fmt.Printf("Agent[%s] failed to serialize request body: %v\n", agentName, err)
-		return nil, ErrRequestFailed.WithDetails(err.Error())
+		return nil, err
 	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(reqBody))
+	reqBody, err := json.Marshal(wireReq)
 	if err != nil {
-		fmt.Printf("Agent[%s] failed to create HTTP request: %v\n", agentName, err)
 		return nil, ErrRequestFailed.WithDetails(err.Error())
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
-
-	fmt.Println("Sending request...")
-	resp, err := p.httpClient.Do(httpReq)
+	resp, err := p.post(ctx, p.httpClient, fmt.Sprintf("%s/chat/completions", p.baseURL), reqBody, "application/json")
 	if err != nil {
-		fmt.Printf("Agent[%s] HTTP request failed: %v\n", agentName, err)
-		return nil, ErrRequestFailed.WithDetails(err.Error())
+		return nil, err
 	}
 	defer resp.Body.Close()
-	fmt.Printf("Response received: status code=%d\n", resp.StatusCode)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Agent[%s] failed to read response body: %v\n", agentName, err)
 		return nil, ErrResponseInvalid.WithDetails(err.Error())
 	}
-	fmt.Println("Response data received")
-
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Agent[%s] API response error: status code=%d\n", agentName, resp.StatusCode)
-		return nil, ErrRequestFailed.WithDetails(fmt.Sprintf("status code: %d", resp.StatusCode))
-	}
 
 	var result ChatCompletionResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		fmt.Printf("Agent[%s] failed to parse response JSON: %v\n", agentName, err)
 		return nil, ErrResponseInvalid.WithDetails(err.Error())
 	}
-	fmt.Printf("Agent[%s] successfully parsed response: %s\n", agentName, result.Choices[0].Message.Content)
+	if len(result.Choices) == 0 {
+		return nil, ErrResponseInvalid.WithDetails("response contains no choices")
+	}
+
+	p.logger.LogAttrs(ctx, slog.LevelDebug, "chat completion",
+		slog.String(LogKeyModel, result.Model),
+		slog.Int("messages", len(req.Messages)),
+		slog.Int("total_tokens", result.Usage.TotalTokens),
+		Redact("reply", result.Choices[0].Message.Content))
 
 	return &result, nil
 }
 
+// openAIChatRequest is a chat completion request with messages in the OpenAI wire format
+type openAIChatRequest struct {
+	ChatCompletionRequest
+	Messages []openAIMessage `json:"messages"`
+}
+
+// openAIMessage carries either plain string content or, when images are attached, an
+// array of content parts
+type openAIMessage struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// newOpenAIChatRequest converts messages with images into content-part arrays, reading
+// local files and bare base64 into data URLs
+func newOpenAIChatRequest(req ChatCompletionRequest) (openAIChatRequest, error) {
+	out := openAIChatRequest{ChatCompletionRequest: req, Messages: make([]openAIMessage, 0, len(req.Messages))}
+	for i, msg := range req.Messages {
+		converted := openAIMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		if len(msg.Images) > 0 {
+			parts := make([]openAIContentPart, 0, len(msg.Images)+1)
+			if msg.Content != "" {
+				parts = append(parts, openAIContentPart{Type: "text", Text: msg.Content})
+			}
+			for _, image := range msg.Images {
+				url, err := ResolveImage(image)
+				if err != nil {
+					return out, ErrRequestFailed.WithDetails(fmt.Sprintf("message %d: %v", i, err))
+				}
+				parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: url}})
+			}
+			converted.Content = parts
+		}
+
+		out.Messages = append(out.Messages, converted)
+	}
+	return out, nil
+}
+
+// openAIStreamRequest adds the streaming switches to a chat completion request
+type openAIStreamRequest struct {
+	openAIChatRequest
+	Stream        bool                `json:"stream"`
+	StreamOptions openAIStreamOptions `json:"stream_options"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIStreamChunk is a single SSE payload of a streaming chat completion
+type openAIStreamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role      string          `json:"role"`
+			Content   string          `json:"content"`
+			ToolCalls []ToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// ChatCompletionStream streams a chat completion using server-sent events
+func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+	if req.Model == "" {
+		req.Model = p.defaultModel
+	}
+
+	wireReq, err := newOpenAIChatRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	reqBody, err := json.Marshal(openAIStreamRequest{
+		openAIChatRequest: wireReq,
+		Stream:            true,
+		StreamOptions:     openAIStreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return nil, ErrRequestFailed.WithDetails(err.Error())
+	}
+
+	// The client timeout would cut long streams short, cancellation is left to ctx
+	client := *p.httpClient
+	client.Timeout = 0
+	resp, err := p.post(ctx, &client, fmt.Sprintf("%s/chat/completions", p.baseURL), reqBody, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+
+	stream := make(chan StreamChunk)
+	go func() {
+		defer close(stream)
+		defer resp.Body.Close()
+
+		send := func(chunk StreamChunk) bool {
+			select {
+			case stream <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "[DONE]" {
+				return
+			}
+
+			var payload openAIStreamChunk
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				send(StreamChunk{Err: ErrResponseInvalid.WithDetails(err.Error())})
+				return
+			}
+
+			chunk := StreamChunk{ID: payload.ID, Model: payload.Model, Usage: payload.Usage}
+			if len(payload.Choices) > 0 {
+				choice := payload.Choices[0]
+				chunk.Role = choice.Delta.Role
+				chunk.Content = choice.Delta.Content
+				chunk.ToolCalls = choice.Delta.ToolCalls
+				if choice.FinishReason != nil {
+					chunk.FinishReason = *choice.FinishReason
+				}
+			}
+			if !send(chunk) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			send(StreamChunk{Err: ErrResponseInvalid.WithDetails(err.Error())})
+		}
+	}()
+
+	return stream, nil
+}
+
+// post sends a JSON body, retrying rate limits, server errors and connection failures
+// according to the retry policy. On success the caller owns the open response body.
+func (p *OpenAIProvider) post(ctx context.Context, client *http.Client, url string, body []byte, accept string) (*http.Response, error) {
+	var resp *http.Response
+	err := p.retry.do(ctx, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return ErrRequestFailed.WithDetails(err.Error())
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", accept)
+		httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+
+		r, err := client.Do(httpReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ErrConnectionFailed.WithDetails(err.Error())
+		}
+
+		if r.StatusCode != http.StatusOK {
+			defer r.Body.Close()
+			respBody, _ := io.ReadAll(r.Body)
+			return classifyHTTPError(r, respBody)
+		}
+
+		resp = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SupportsResponseFormat reports whether the model accepts response_format. Legacy
+// models predating JSON mode are prompted instead.
+func (p *OpenAIProvider) SupportsResponseFormat(model string) bool {
+	if model == "" {
+		model = p.defaultModel
+	}
+	return !(strings.HasPrefix(model, "gpt-3.5") || model == "gpt-4" || strings.HasPrefix(model, "gpt-4-0"))
+}
+
 func (p *OpenAIProvider) GetModels(ctx context.Context) ([]string, error) {
 	reqURL := fmt.Sprintf("%s/models", p.baseURL)
 
@@ -168,11 +379,3 @@ func init() {
 		return NewOpenAIProvider(config)
 	})
 }
-
-// Helper function min gets the smaller of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
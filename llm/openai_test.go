@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/**
+ * Norwegian-style doc: Like a ferry timetable checked against the real crossing, these tests hold the OpenAI provider to the wire format—what we send is what the API expects, and what comes back is read without guesswork.
+ */
+
+func newTestOpenAIProvider(t *testing.T, handler http.HandlerFunc) *OpenAIProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	provider, err := NewOpenAIProvider(Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	openai := provider.(*OpenAIProvider)
+	openai.retry.baseDelay = time.Millisecond
+	return openai
+}
+
+func TestOpenAIProvider_ToolCallingRoundTrip(t *testing.T) {
+	var received map[string]interface{}
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"choices": [{
+				"index": 0,
+				"finish_reason": "tool_calls",
+				"message": {
+					"role": "assistant",
+					"content": null,
+					"tool_calls": [{
+						"id": "call_1",
+						"type": "function",
+						"function": {"name": "search", "arguments": "{\"query\":\"fjords {and} lakes\\n\"}"}
+					}]
+				}
+			}]
+		}`))
+	})
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{
+			{Role: RoleUser, Content: "find fjords"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_0", Type: "function", Function: FunctionCall{Name: "search", Arguments: "{}"}}}},
+			{Role: RoleTool, ToolCallID: "call_0", Content: "no results"},
+		},
+		Tools: []map[string]interface{}{
+			{"type": "function", "function": map[string]interface{}{"name": "search"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tools, ok := received["tools"].([]interface{}); !ok || len(tools) != 1 {
+		t.Errorf("expected tools to be sent, got %v", received["tools"])
+	}
+	messages := received["messages"].([]interface{})
+	if calls, ok := messages[1].(map[string]interface{})["tool_calls"].([]interface{}); !ok || len(calls) != 1 {
+		t.Errorf("expected assistant tool_calls to be sent, got %v", messages[1])
+	}
+	if id := messages[2].(map[string]interface{})["tool_call_id"]; id != "call_0" {
+		t.Errorf("expected tool_call_id 'call_0', got %v", id)
+	}
+
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "search" {
+		t.Fatalf("expected one parsed tool call, got %+v", calls)
+	}
+	var args map[string]string
+	if err := json.Unmarshal([]byte(calls[0].Function.Arguments), &args); err != nil || args["query"] != "fjords {and} lakes\n" {
+		t.Errorf("expected arguments to survive braces and newlines, got %q (err: %v)", calls[0].Function.Arguments, err)
+	}
+}
+
+func TestOpenAIProvider_EmptyChoices(t *testing.T) {
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "chatcmpl-1", "choices": []}`))
+	})
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	})
+	if err == nil {
+		t.Error("expected error for response without choices")
+	}
+}
+
+func TestOpenAIProvider_ChatCompletionStream(t *testing.T) {
+	var received map[string]interface{}
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"id":"c1","model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+			`{"id":"c1","model":"m","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+			`{"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"q\":"}}]}}]}`,
+			`{"id":"c1","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"fjord\"}"}}]}}]}`,
+			`{"id":"c1","model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"id":"c1","model":"m","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+			`[DONE]`,
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	stream, err := provider.ChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var deltas []string
+	acc := NewStreamAccumulator()
+	for chunk := range stream {
+		if chunk.Err != nil {
+			t.Fatalf("unexpected stream error: %v", chunk.Err)
+		}
+		if chunk.Content != "" {
+			deltas = append(deltas, chunk.Content)
+		}
+		acc.Add(chunk)
+	}
+
+	if received["stream"] != true {
+		t.Errorf("expected stream=true in request, got %v", received["stream"])
+	}
+	if len(deltas) != 2 {
+		t.Errorf("expected 2 content deltas, got %v", deltas)
+	}
+	resp := acc.Response()
+	msg := resp.Choices[0].Message
+	if msg.Content != "Hello" {
+		t.Errorf("expected content 'Hello', got %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"q":"fjord"}` {
+		t.Errorf("expected assembled tool call, got %+v", msg.ToolCalls)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" || resp.Usage.TotalTokens != 10 {
+		t.Errorf("expected finish reason and usage, got %q / %+v", resp.Choices[0].FinishReason, resp.Usage)
+	}
+}
+
+func TestOpenAIProvider_ChatCompletionStream_HTTPError(t *testing.T) {
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	_, err := provider.ChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err == nil {
+		t.Error("expected error for non-200 stream response")
+	}
+}
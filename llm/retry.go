@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRetryCount is used when Config.RetryCount is zero, a negative value disables retries
+	defaultRetryCount = 2
+	// defaultRetryBaseDelay is the backoff before the first retry
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	// defaultRetryMaxDelay caps the exponential backoff
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryPolicy retries retryable failures with jittered exponential backoff
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	logger     *slog.Logger
+}
+
+// newRetryPolicy builds a policy from Config.RetryCount
+func newRetryPolicy(retryCount int) retryPolicy {
+	maxRetries := defaultRetryCount
+	if retryCount > 0 {
+		maxRetries = retryCount
+	} else if retryCount < 0 {
+		maxRetries = 0
+	}
+	return retryPolicy{
+		maxRetries: maxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+	}
+}
+
+// do runs fn until it succeeds, fails with a non-retryable error, exhausts the
+// retry budget or ctx is done. A Retry-After hint on the error takes precedence
+// over the computed backoff, capped at maxDelay like the backoff.
+func (r retryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsRetryable(err) || attempt >= r.maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		delay := r.backoff(attempt)
+		var llmErr LLMError
+		if errors.As(err, &llmErr) && llmErr.RetryAfter > 0 {
+			delay = min(llmErr.RetryAfter, r.maxDelay)
+		}
+
+		if r.logger != nil {
+			r.logger.LogAttrs(ctx, slog.LevelWarn, "retrying llm request",
+				slog.Int("attempt", attempt+1), slog.Duration("delay", delay), slog.String("error", err.Error()))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a full-jitter delay for the given attempt
+func (r retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := r.baseDelay << uint(attempt)
+	if ceiling <= 0 || ceiling > r.maxDelay {
+		ceiling = r.maxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+// classifyHTTPError maps a non-200 response onto a typed LLMError
+func classifyHTTPError(resp *http.Response, body []byte) LLMError {
+	details := fmt.Sprintf("status code: %d, body: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+
+	var apiErr struct {
+		Error struct {
+			Code    interface{} `json:"code"`
+			Type    string      `json:"type"`
+			Message string      `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	code := fmt.Sprint(apiErr.Error.Code)
+
+	var err LLMError
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		err = ErrAuthentication
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err = ErrRateLimited
+	case code == "context_length_exceeded" || strings.Contains(apiErr.Error.Message, "maximum context length"):
+		err = ErrContextLengthExceeded
+	case apiErr.Error.Type == "invalid_request_error" && strings.Contains(apiErr.Error.Message, "prompt is too long"):
+		// Anthropic reports an overlong prompt as a plain invalid request
+		err = ErrContextLengthExceeded
+	case resp.StatusCode >= 500:
+		err = ErrServerError
+	default:
+		err = ErrRequestFailed
+	}
+
+	err = err.WithDetails(details)
+	err.StatusCode = resp.StatusCode
+	err.RetryAfter = parseRetryAfter(resp.Header, time.Now())
+	return err
+}
+
+// parseRetryAfter reads retry-after-ms, or Retry-After as seconds or an HTTP date
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if v, err := strconv.ParseFloat(ms, 64); err == nil && v > 0 {
+			return time.Duration(v * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/**
+ * Norwegian-style doc: A fisherman who finds the harbour closed waits for the tide and tries again, but never argues with a locked gate—these tests check that throttling and outages are retried patiently while bad keys and oversized prompts fail at once.
+ */
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"missing", http.Header{}, 0},
+		{"seconds", http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{"http date", http.Header{"Retry-After": {now.Add(10 * time.Second).Format(http.TimeFormat)}}, 10 * time.Second},
+		{"past date", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0},
+		{"garbage", http.Header{"Retry-After": {"soon"}}, 0},
+	}
+
+	for _, tc := range cases {
+		if got := parseRetryAfter(tc.header, now); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestClassifyHTTPError(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		want      LLMError
+		retryable bool
+	}{
+		{http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`, ErrRateLimited, true},
+		{http.StatusUnauthorized, `{"error":{"message":"bad key"}}`, ErrAuthentication, false},
+		{http.StatusBadRequest, `{"error":{"code":"context_length_exceeded","message":"too long"}}`, ErrContextLengthExceeded, false},
+		{http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`, ErrContextLengthExceeded, false},
+		{http.StatusBadGateway, `upstream down`, ErrServerError, true},
+		{http.StatusBadRequest, `{"error":{"message":"bad temperature"}}`, ErrRequestFailed, false},
+	}
+
+	for _, tc := range cases {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+		err := classifyHTTPError(resp, []byte(tc.body))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("status %d: expected %s, got %s", tc.status, tc.want.Code, err.Code)
+		}
+		if err.StatusCode != tc.status {
+			t.Errorf("status %d: expected status code on error, got %d", tc.status, err.StatusCode)
+		}
+		if IsRetryable(err) != tc.retryable {
+			t.Errorf("status %d: expected retryable=%v", tc.status, tc.retryable)
+		}
+	}
+}
+
+func TestOpenAIProvider_RetriesRateLimit(t *testing.T) {
+	var attempts int32
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After-Ms", "5")
+			http.Error(w, `{"error":{"message":"rate limited"}}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	})
+
+	resp, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if resp.Choices[0].Message.Content != "ok" {
+		t.Errorf("unexpected content %q", resp.Choices[0].Message.Content)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestOpenAIProvider_DoesNotRetryAuthentication(t *testing.T) {
+	var attempts int32
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+	})
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	if !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("expected ErrAuthentication, got %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+}
+
+func TestOpenAIProvider_ExhaustsRetries(t *testing.T) {
+	var attempts int32
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	})
+	provider.retry.maxRetries = 3
+
+	_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	if !errors.Is(err, ErrServerError) {
+		t.Fatalf("expected ErrServerError, got %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 4 {
+		t.Errorf("expected 4 attempts, got %d", got)
+	}
+}
+
+func TestOpenAIProvider_RetryStopsOnCancel(t *testing.T) {
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := provider.ChatCompletion(ctx, ChatCompletionRequest{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context deadline, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("retry did not honour cancellation")
+	}
+}
+
+func TestRetryPolicy_ClampsRetryAfter(t *testing.T) {
+	policy := retryPolicy{maxRetries: 1, baseDelay: time.Millisecond, maxDelay: 20 * time.Millisecond}
+
+	calls := 0
+	start := time.Now()
+	err := policy.do(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			rateLimited := ErrRateLimited
+			rateLimited.RetryAfter = time.Hour
+			return rateLimited
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("expected a successful retry, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the Retry-After hint to be capped at maxDelay, waited %v", elapsed)
+	}
+}
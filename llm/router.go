@@ -0,0 +1,280 @@
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// ExtraBackend is the ChatCompletionResponse.Extra key under which a RouterProvider
+// reports the name of the route that answered
+const ExtraBackend = "backend"
+
+// ErrNoRoute is returned when no route of a RouterProvider matches the request
+var ErrNoRoute = LLMError{Code: "no_route", Message: "No provider route matches the request"}
+
+// Route is one backend of a RouterProvider
+type Route struct {
+	// Name identifies the route in ExtraBackend, it defaults to the provider ID
+	Name string
+
+	// Provider answers the requests sent to this route
+	Provider Provider
+
+	// Model replaces the requested model, e.g. to send cheap tasks to a cheaper model
+	// or to name the equivalent model of another vendor. Empty keeps the requested model.
+	Model string
+
+	// Match selects the requests this route may answer, nil matches everything
+	Match RequestMatcher
+}
+
+// RouterProvider sends each request to the matching routes in priority order. When a
+// route fails with a retryable error the next matching route is tried, any other error
+// is returned as is.
+type RouterProvider struct {
+	routes []Route
+}
+
+// NewRouterProvider creates a provider over the given routes, listed in priority order
+func NewRouterProvider(routes ...Route) *RouterProvider {
+	for i := range routes {
+		if routes[i].Name == "" {
+			routes[i].Name = routes[i].Provider.ID()
+		}
+	}
+	return &RouterProvider{routes: routes}
+}
+
+// NewFallbackProvider tries the providers in order until one answers
+func NewFallbackProvider(providers ...Provider) *RouterProvider {
+	routes := make([]Route, len(providers))
+	for i, provider := range providers {
+		routes[i] = Route{Provider: provider}
+	}
+	return NewRouterProvider(routes...)
+}
+
+// ID returns the provider identifier
+func (p *RouterProvider) ID() string {
+	return "router"
+}
+
+// ChatCompletion answers from the first matching route that does not fail retryably.
+// The answering route's name is reported in resp.Extra[ExtraBackend].
+func (p *RouterProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	var resp *ChatCompletionResponse
+	err := p.try(ctx, req, func(route Route, routed ChatCompletionRequest) error {
+		var err error
+		resp, err = route.Provider.ChatCompletion(ctx, routed)
+		if err != nil {
+			return err
+		}
+		if resp.Extra == nil {
+			resp.Extra = make(map[string]interface{})
+		}
+		resp.Extra[ExtraBackend] = route.Name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ChatCompletionStream falls back while the stream is being set up, once a stream has
+// started its failures are delivered on the stream. The answering route's name is reported
+// in the Extra[ExtraBackend] of the first chunk, and so in the collected response.
+func (p *RouterProvider) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+	var stream <-chan StreamChunk
+	var backend string
+	err := p.try(ctx, req, func(route Route, routed ChatCompletionRequest) error {
+		var err error
+		stream, err = nextStream(route.Provider)(ctx, routed)
+		backend = route.Name
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tagStream(ctx, stream, backend), nil
+}
+
+// tagStream sets Extra[ExtraBackend] on the first chunk of stream
+func tagStream(ctx context.Context, in <-chan StreamChunk, backend string) <-chan StreamChunk {
+	out := make(chan StreamChunk)
+	go func() {
+		defer close(out)
+		first := true
+		for chunk := range in {
+			if first {
+				extra := make(map[string]interface{}, len(chunk.Extra)+1)
+				for key, value := range chunk.Extra {
+					extra[key] = value
+				}
+				extra[ExtraBackend] = backend
+				chunk.Extra = extra
+				first = false
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// Drain so the upstream producer can finish
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// route returns the first route a request for model would be sent to, with the model
+// that route would request
+func (p *RouterProvider) route(model string) (Route, string, bool) {
+	req := ChatCompletionRequest{Model: model}
+	for _, route := range p.routes {
+		if route.Match != nil && !route.Match(req) {
+			continue
+		}
+		if route.Model != "" {
+			return route, route.Model, true
+		}
+		return route, model, true
+	}
+	return Route{}, "", false
+}
+
+// SupportsResponseFormat reports the support of the route a request for model is sent to
+// first, fallback routes are not consulted
+func (p *RouterProvider) SupportsResponseFormat(model string) bool {
+	route, routed, ok := p.route(model)
+	return ok && SupportsResponseFormat(route.Provider, routed)
+}
+
+// ModelCapabilities reports the capabilities of the route a request for model is sent to first
+func (p *RouterProvider) ModelCapabilities(ctx context.Context, model string) (ModelCapabilities, error) {
+	route, routed, ok := p.route(model)
+	if !ok {
+		return ModelCapabilities{}, ErrNoRoute.WithDetails("model " + model)
+	}
+	return Capabilities(ctx, route.Provider, routed)
+}
+
+// try calls fn for each matching route until it succeeds or fails non-retryably
+func (p *RouterProvider) try(ctx context.Context, req ChatCompletionRequest, fn func(Route, ChatCompletionRequest) error) error {
+	var lastErr error
+	for _, route := range p.routes {
+		if route.Match != nil && !route.Match(req) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		routed := req
+		if route.Model != "" {
+			routed.Model = route.Model
+		}
+
+		err := fn(route, routed)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	return ErrNoRoute.WithDetails("model " + req.Model)
+}
+
+// GetModels returns the models of every backend, backends that fail to list are skipped
+func (p *RouterProvider) GetModels(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	models := make([]string, 0)
+	var lastErr error
+	listed := false
+
+	for _, route := range p.routes {
+		names, err := route.Provider.GetModels(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		listed = true
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				models = append(models, name)
+			}
+		}
+	}
+
+	if !listed && lastErr != nil {
+		return nil, lastErr
+	}
+	return models, nil
+}
+
+// Close closes every backend once, returning the first error
+func (p *RouterProvider) Close() error {
+	closed := make(map[Provider]bool)
+	var firstErr error
+	for _, route := range p.routes {
+		if closed[route.Provider] {
+			continue
+		}
+		closed[route.Provider] = true
+		if err := route.Provider.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// MatchModel matches requests for any of the given models, a trailing "*" matches a prefix
+func MatchModel(models ...string) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		for _, model := range models {
+			if prefix, ok := strings.CutSuffix(model, "*"); ok {
+				if strings.HasPrefix(req.Model, prefix) {
+					return true
+				}
+			} else if req.Model == model {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchTag matches requests whose Extra[key] equals value
+func MatchTag(key string, value interface{}) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		tag, ok := req.Extra[key]
+		return ok && tag == value
+	}
+}
+
+// MatchPromptTokensAtMost matches requests whose estimated prompt size is at most limit tokens
+func MatchPromptTokensAtMost(limit int) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		return estimatePromptTokens(req) <= limit
+	}
+}
+
+// MatchPromptTokensAbove matches requests whose estimated prompt size exceeds limit tokens
+func MatchPromptTokensAbove(limit int) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		return estimatePromptTokens(req) > limit
+	}
+}
+
+// estimatePromptTokens counts the prompt with the counter registered for the requested model
+func estimatePromptTokens(req ChatCompletionRequest) int {
+	return CountMessageTokens(TokenCounterFor(req.Model), req.Messages)
+}
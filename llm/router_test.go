@@ -0,0 +1,247 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: When the coastal express is storm-bound the mail goes by road, and small parcels never needed the ship at all—these tests check that the router sends each request down the right road and tells us which one carried it.
+ */
+
+func TestRouterProvider_FallsBackOnRetryableError(t *testing.T) {
+	primary := NewScriptedProvider(ScriptRule{Err: ErrRateLimited})
+	secondary := NewSequenceProvider(TextResponse("from secondary"))
+
+	router := NewRouterProvider(
+		Route{Name: "primary", Provider: primary},
+		Route{Name: "secondary", Provider: secondary, Model: "backup-model"},
+	)
+
+	resp, err := router.ChatCompletion(context.Background(), ChatCompletionRequest{Model: "main-model"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Extra[ExtraBackend] != "secondary" {
+		t.Errorf("expected secondary to answer, got %v", resp.Extra[ExtraBackend])
+	}
+	if got := secondary.Requests()[0].Model; got != "backup-model" {
+		t.Errorf("expected route model override, got %q", got)
+	}
+}
+
+func TestRouterProvider_StopsOnNonRetryableError(t *testing.T) {
+	secondary := NewSequenceProvider(TextResponse("unused"))
+	router := NewFallbackProvider(NewScriptedProvider(ScriptRule{Err: ErrAuthentication}), secondary)
+
+	_, err := router.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	if !errors.Is(err, ErrAuthentication) {
+		t.Errorf("expected ErrAuthentication, got %v", err)
+	}
+	if len(secondary.Requests()) != 0 {
+		t.Error("expected no fallback after a non-retryable error")
+	}
+}
+
+func TestRouterProvider_AllBackendsDown(t *testing.T) {
+	router := NewFallbackProvider(
+		NewScriptedProvider(ScriptRule{Err: ErrServerError}),
+		NewScriptedProvider(ScriptRule{Err: ErrConnectionFailed}),
+	)
+
+	_, err := router.ChatCompletion(context.Background(), ChatCompletionRequest{})
+	if !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("expected the last backend's error, got %v", err)
+	}
+}
+
+func TestRouterProvider_Rules(t *testing.T) {
+	cheap := NewScriptedProvider(ScriptRule{Response: TextResponse("cheap")})
+	large := NewScriptedProvider(ScriptRule{Response: TextResponse("large")})
+	claude := NewScriptedProvider(ScriptRule{Response: TextResponse("claude")})
+	standard := NewScriptedProvider(ScriptRule{Response: TextResponse("standard")})
+
+	router := NewRouterProvider(
+		Route{Name: "claude", Provider: claude, Match: MatchModel("claude-*")},
+		Route{Name: "cheap", Provider: cheap, Match: MatchTag("tier", "cheap")},
+		Route{Name: "large", Provider: large, Match: MatchPromptTokensAbove(100)},
+		Route{Name: "standard", Provider: standard},
+	)
+
+	cases := []struct {
+		req  ChatCompletionRequest
+		want string
+	}{
+		{ChatCompletionRequest{Model: "claude-3-5-haiku"}, "claude"},
+		{ChatCompletionRequest{Extra: map[string]interface{}{"tier": "cheap"}}, "cheap"},
+		{ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: strings.Repeat("word ", 200)}}}, "large"},
+		{ChatCompletionRequest{Model: "gpt-4o", Messages: []Message{{Role: RoleUser, Content: "hi"}}}, "standard"},
+	}
+
+	for _, tc := range cases {
+		resp, err := router.ChatCompletion(context.Background(), tc.req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Extra[ExtraBackend] != tc.want {
+			t.Errorf("expected %s, got %v", tc.want, resp.Extra[ExtraBackend])
+		}
+	}
+}
+
+func TestRouterProvider_NoRoute(t *testing.T) {
+	router := NewRouterProvider(Route{Provider: NewSequenceProvider(), Match: MatchModel("gpt-4o")})
+
+	_, err := router.ChatCompletion(context.Background(), ChatCompletionRequest{Model: "llama3"})
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+}
+
+func TestRouterProvider_StreamFallback(t *testing.T) {
+	router := NewFallbackProvider(
+		NewScriptedProvider(ScriptRule{Err: ErrRateLimited}),
+		NewSequenceProvider(TextResponse("streamed answer")),
+	)
+
+	stream, err := router.ChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := CollectStream(stream)
+	if err != nil || resp.Choices[0].Message.Content != "streamed answer" {
+		t.Errorf("unexpected stream result %+v, %v", resp, err)
+	}
+}
+
+func TestRouterProvider_StreamReportsBackend(t *testing.T) {
+	router := NewRouterProvider(
+		Route{Name: "primary", Provider: NewScriptedProvider(ScriptRule{Err: ErrServerError})},
+		Route{Name: "secondary", Provider: NewSequenceProvider(TextResponse("streamed answer"))},
+	)
+
+	stream, err := router.ChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := CollectStream(stream)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if resp.Extra[ExtraBackend] != "secondary" {
+		t.Errorf("expected the stream to report the answering route, got %v", resp.Extra[ExtraBackend])
+	}
+}
+
+// outageServer answers every request with status and body
+func outageServer(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRouterProvider_FallsBackOnProviderOutage(t *testing.T) {
+	overloaded := outageServer(t, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	unavailable := outageServer(t, http.StatusServiceUnavailable, `{"error":"server busy"}`)
+
+	anthropic, err := NewAnthropicProvider(Config{APIKey: "key", BaseURL: overloaded.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ollama, err := NewOllamaProvider(Config{BaseURL: unavailable.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := NewSequenceProvider(TextResponse("from backup"), TextResponse("streamed from backup"))
+
+	router := NewRouterProvider(
+		Route{Name: "anthropic", Provider: anthropic},
+		Route{Name: "ollama", Provider: ollama},
+		Route{Name: "backup", Provider: backup},
+	)
+	req := ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+	resp, err := router.ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected fallback past both outages, got %v", err)
+	}
+	if resp.Extra[ExtraBackend] != "backup" {
+		t.Errorf("expected backup to answer, got %v", resp.Extra[ExtraBackend])
+	}
+
+	stream, err := router.ChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected stream fallback past both outages, got %v", err)
+	}
+	if resp, err = CollectStream(stream); err != nil || resp.Extra[ExtraBackend] != "backup" {
+		t.Errorf("unexpected stream result %+v, %v", resp, err)
+	}
+}
+
+func TestRouterProvider_OutageErrorsAreRetryable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   LLMError
+	}{
+		{"rate limited", http.StatusTooManyRequests, ErrRateLimited},
+		{"unavailable", http.StatusServiceUnavailable, ErrServerError},
+		{"overloaded", 529, ErrServerError},
+	}
+
+	for _, tc := range tests {
+		server := outageServer(t, tc.status, `{"error":"down"}`)
+		anthropic, _ := NewAnthropicProvider(Config{APIKey: "key", BaseURL: server.URL})
+		ollama, _ := NewOllamaProvider(Config{BaseURL: server.URL})
+
+		for _, provider := range []Provider{anthropic, ollama} {
+			_, err := provider.ChatCompletion(context.Background(), ChatCompletionRequest{})
+			if !errors.Is(err, tc.want) || !IsRetryable(err) {
+				t.Errorf("%s %s: expected retryable %s, got %v", provider.ID(), tc.name, tc.want.Code, err)
+			}
+		}
+	}
+
+	closed := outageServer(t, http.StatusOK, "")
+	closed.Close()
+	ollama, _ := NewOllamaProvider(Config{BaseURL: closed.URL})
+	if _, err := ollama.ChatCompletion(context.Background(), ChatCompletionRequest{}); !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("expected ErrConnectionFailed for an unreachable server, got %v", err)
+	}
+}
+
+func TestRouterProvider_ForwardsRouteCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"capabilities":["completion","vision"]}`))
+	}))
+	defer server.Close()
+	ollama, _ := NewOllamaProvider(Config{BaseURL: server.URL})
+
+	router := NewRouterProvider(
+		Route{Name: "local", Provider: ollama, Match: MatchModel("llava*")},
+		Route{Name: "scripted", Provider: NewSequenceProvider()},
+	)
+
+	if !SupportsResponseFormat(router, "llava:7b") {
+		t.Error("expected response format support of the ollama route")
+	}
+	if SupportsResponseFormat(router, "gpt-4o") {
+		t.Error("expected no response format support of the scripted route")
+	}
+
+	caps, err := Capabilities(context.Background(), router, "llava:7b")
+	if err != nil || !caps.Vision {
+		t.Errorf("expected the ollama route's capabilities, got %+v, %v", caps, err)
+	}
+	if _, err := Capabilities(context.Background(), router, "gpt-4o"); !errors.Is(err, ErrCapabilitiesUnknown) {
+		t.Errorf("expected ErrCapabilitiesUnknown, got %v", err)
+	}
+}
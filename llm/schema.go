@@ -0,0 +1,345 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrSchemaInvalid is returned when a JSON Schema cannot be derived or parsed
+var ErrSchemaInvalid = LLMError{Code: "schema_invalid", Message: "Invalid JSON schema"}
+
+// SchemaFor derives a JSON Schema from a Go value's type. Struct fields follow their json
+// tags, fields without omitempty are required and a `description:"..."` tag documents a
+// field for the model. Recursive types are not supported.
+func SchemaFor(v interface{}) (json.RawMessage, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, ErrSchemaInvalid.WithDetails("cannot derive a schema from nil")
+	}
+	schema, err := schemaForType(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, ErrSchemaInvalid.WithDetails(err.Error())
+	}
+	return data, nil
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage(nil))
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+func schemaForType(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case t == rawJSONType || t == interfaceType:
+		return map[string]interface{}{}, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		// encoding/json writes byte slices as base64 strings
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaForType(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, ErrSchemaInvalid.WithDetails(fmt.Sprintf("map key of %s must be a string", t))
+		}
+		values, err := schemaForType(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t, visiting)
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	}
+	return nil, ErrSchemaInvalid.WithDetails(fmt.Sprintf("unsupported type %s", t))
+}
+
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	if visiting[t] {
+		return nil, ErrSchemaInvalid.WithDetails(fmt.Sprintf("recursive type %s", t))
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// Untagged embedded structs are flattened, as encoding/json does, even when
+		// the embedded type itself is unexported
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded, err := structSchema(field.Type, visiting)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			required = append(required, embedded["required"].([]string)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		prop, err := schemaForType(field.Type, visiting)
+		if err != nil {
+			return nil, err
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
+
+// ValidateJSON checks data against a JSON Schema. The supported keywords are type, enum,
+// properties, required, additionalProperties, items, minItems, maxItems, minLength,
+// maxLength, pattern, minimum, maximum, anyOf and oneOf.
+func ValidateJSON(schema json.RawMessage, data []byte) error {
+	var s interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return ErrSchemaInvalid.WithDetails(err.Error())
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return ErrResponseInvalid.WithDetails(fmt.Sprintf("not valid JSON: %v", err))
+	}
+
+	var problems []string
+	validateValue(s, value, "$", &problems)
+	if len(problems) > 0 {
+		return ErrResponseInvalid.WithDetails(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateValue(schemaValue interface{}, value interface{}, path string, problems *[]string) {
+	schema, ok := schemaValue.(map[string]interface{})
+	if !ok {
+		// true or an unknown shape accepts everything, false accepts nothing
+		if b, isBool := schemaValue.(bool); isBool && !b {
+			*problems = append(*problems, fmt.Sprintf("%s is not allowed", path))
+		}
+		return
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+" "+fmt.Sprintf(format, args...))
+	}
+
+	if branches, ok := firstOf(schema, "anyOf", "oneOf"); ok {
+		matched := false
+		for _, branch := range branches {
+			var branchProblems []string
+			validateValue(branch, value, path, &branchProblems)
+			if len(branchProblems) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("matches none of the allowed schemas")
+		}
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("should be %v, got %s", t, jsonTypeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if sameJSON(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("should be one of %v", enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := v[fmt.Sprint(name)]; !present {
+					fail("is missing required property %q", name)
+				}
+			}
+		}
+		for name, propValue := range v {
+			if propSchema, ok := properties[name]; ok {
+				validateValue(propSchema, propValue, path+"."+name, problems)
+			} else if additional, ok := schema["additionalProperties"]; ok {
+				if b, isBool := additional.(bool); isBool && !b {
+					fail("has unexpected property %q", name)
+				} else {
+					validateValue(additional, propValue, path+"."+name, problems)
+				}
+			}
+		}
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("should have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("should have at most %v items", n)
+		}
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("should be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("should be at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("should match %s", pattern)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			fail("should be at least %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			fail("should be at most %v", n)
+		}
+	}
+}
+
+func firstOf(schema map[string]interface{}, keys ...string) ([]interface{}, bool) {
+	for _, key := range keys {
+		if branches, ok := schema[key].([]interface{}); ok {
+			return branches, true
+		}
+	}
+	return nil, false
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch types := t.(type) {
+	case string:
+		return matchesTypeName(types, value)
+	case []interface{}:
+		for _, name := range types {
+			if matchesTypeName(fmt.Sprint(name), value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	default:
+		return jsonTypeName(value) == name
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// sameJSON compares an enum entry, decoded with float numbers, to a value decoded with json.Number
+func sameJSON(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a joiner measuring twice before cutting, these tests check that the schema we hand the model is drawn from the real struct, and that every answer is measured against it before anyone builds on it.
+ */
+
+type schemaAddress struct {
+	City string `json:"city"`
+}
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaPerson struct {
+	schemaBase
+	Name     string         `json:"name" description:"Full name"`
+	Age      int            `json:"age"`
+	Tags     []string       `json:"tags,omitempty"`
+	Address  *schemaAddress `json:"address"`
+	internal string
+	Skipped  string `json:"-"`
+}
+
+type schemaNode struct {
+	Children []schemaNode `json:"children"`
+}
+
+func TestSchemaFor_Struct(t *testing.T) {
+	data, err := SchemaFor(schemaPerson{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var schema struct {
+		Type                 string                            `json:"type"`
+		Properties           map[string]map[string]interface{} `json:"properties"`
+		Required             []string                          `json:"required"`
+		AdditionalProperties bool                              `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	if schema.Type != "object" || schema.AdditionalProperties {
+		t.Errorf("expected a closed object schema, got %s", data)
+	}
+	for _, name := range []string{"id", "name", "age", "tags", "address"} {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("expected property %q in %s", name, data)
+		}
+	}
+	if _, ok := schema.Properties["Skipped"]; ok {
+		t.Errorf("fields tagged json:\"-\" must be left out")
+	}
+	if schema.Properties["name"]["description"] != "Full name" {
+		t.Errorf("expected description on name, got %v", schema.Properties["name"])
+	}
+	if schema.Properties["age"]["type"] != "integer" {
+		t.Errorf("expected integer age, got %v", schema.Properties["age"])
+	}
+	if got := strings.Join(schema.Required, ","); got != "id,name,age,address" {
+		t.Errorf("unexpected required fields: %s", got)
+	}
+}
+
+func TestSchemaFor_Bytes(t *testing.T) {
+	type attachment struct {
+		Name string `json:"name"`
+		Data []byte `json:"data"`
+	}
+	schema, err := SchemaFor(attachment{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(schema), `"data":{"contentEncoding":"base64","type":"string"}`) {
+		t.Errorf("expected a base64 string for []byte, got %s", schema)
+	}
+
+	data, _ := json.Marshal(attachment{Name: "pixel.png", Data: []byte("\x89PNG")})
+	if err := ValidateJSON(schema, data); err != nil {
+		t.Errorf("expected the encoded struct to match its own schema, got %v", err)
+	}
+}
+
+func TestSchemaFor_RecursiveType(t *testing.T) {
+	if _, err := SchemaFor(schemaNode{}); !errors.Is(err, ErrSchemaInvalid) {
+		t.Errorf("expected ErrSchemaInvalid for a recursive type, got %v", err)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema, err := SchemaFor(schemaPerson{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := ValidateJSON(schema, []byte(`{"id":"p1","name":"Ada","age":36,"address":{"city":"Oslo"}}`)); err != nil {
+		t.Errorf("expected valid document, got %v", err)
+	}
+
+	err = ValidateJSON(schema, []byte(`{"id":"p1","name":"Ada","age":36.5,"address":{"town":"Oslo"},"extra":true}`))
+	if !errors.Is(err, ErrResponseInvalid) {
+		t.Fatalf("expected ErrResponseInvalid, got %v", err)
+	}
+	details := err.(LLMError).Details
+	for _, want := range []string{"$.age should be integer", `$.address is missing required property "city"`, `$ has unexpected property "extra"`} {
+		if !strings.Contains(details, want) {
+			t.Errorf("expected %q in %q", want, details)
+		}
+	}
+}
+
+func TestValidateJSON_Keywords(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"level": {"enum": ["low", "high"]},
+			"code": {"type": "string", "pattern": "^[A-Z]{3}$", "maxLength": 3},
+			"score": {"type": "number", "minimum": 0, "maximum": 1},
+			"items": {"type": "array", "minItems": 1},
+			"id": {"anyOf": [{"type": "string"}, {"type": "integer"}]}
+		}
+	}`)
+
+	tests := []struct {
+		doc   string
+		valid bool
+	}{
+		{`{"level":"low","code":"ABC","score":0.5,"items":[1],"id":7}`, true},
+		{`{"level":"medium"}`, false},
+		{`{"code":"abc"}`, false},
+		{`{"score":2}`, false},
+		{`{"items":[]}`, false},
+		{`{"id":true}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		err := ValidateJSON(schema, []byte(tt.doc))
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateJSON(%s) = %v, expected valid=%v", tt.doc, err, tt.valid)
+		}
+	}
+}
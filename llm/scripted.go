@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ErrNoScriptedResponse is returned when no script rule matches a request
+var ErrNoScriptedResponse = LLMError{Code: "no_scripted_response", Message: "No scripted response matches the request"}
+
+// RequestMatcher decides whether a script rule applies to a request
+type RequestMatcher func(req ChatCompletionRequest) bool
+
+// MatchAny matches every request
+func MatchAny() RequestMatcher {
+	return func(ChatCompletionRequest) bool { return true }
+}
+
+// MatchLastMessageContains matches when the most recent message contains substr
+func MatchLastMessageContains(substr string) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		if len(req.Messages) == 0 {
+			return false
+		}
+		return strings.Contains(req.Messages[len(req.Messages)-1].Content, substr)
+	}
+}
+
+// MatchAnyMessageContains matches when any message in the conversation contains substr
+func MatchAnyMessageContains(substr string) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		for _, msg := range req.Messages {
+			if strings.Contains(msg.Content, substr) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchLastRole matches when the most recent message has the given role,
+// e.g. RoleTool to answer once tool results have been fed back
+func MatchLastRole(role string) RequestMatcher {
+	return func(req ChatCompletionRequest) bool {
+		return len(req.Messages) > 0 && req.Messages[len(req.Messages)-1].Role == role
+	}
+}
+
+// ScriptRule pairs a matcher with the response to give when it matches
+type ScriptRule struct {
+	// Match selects the requests this rule answers, nil matches everything
+	Match RequestMatcher
+
+	// Response is returned when the rule matches and Err is nil
+	Response *ChatCompletionResponse
+
+	// Err is returned instead of a response, to script provider failures
+	Err error
+
+	// Once consumes the rule after its first use so later rules can take over
+	Once bool
+}
+
+// ScriptedProvider is a deterministic Provider for tests. Rules are tried in
+// order and the first matching, unconsumed rule answers the request.
+type ScriptedProvider struct {
+	rules    []ScriptRule
+	used     []bool
+	requests []ChatCompletionRequest
+	mu       sync.Mutex
+}
+
+// NewScriptedProvider creates a provider answering from the given rules
+func NewScriptedProvider(rules ...ScriptRule) *ScriptedProvider {
+	return &ScriptedProvider{
+		rules: rules,
+		used:  make([]bool, len(rules)),
+	}
+}
+
+// NewSequenceProvider creates a provider that returns the responses in order, one per request
+func NewSequenceProvider(responses ...*ChatCompletionResponse) *ScriptedProvider {
+	rules := make([]ScriptRule, len(responses))
+	for i, resp := range responses {
+		rules[i] = ScriptRule{Response: resp, Once: true}
+	}
+	return NewScriptedProvider(rules...)
+}
+
+// ID returns the provider identifier
+func (p *ScriptedProvider) ID() string {
+	return "scripted"
+}
+
+// ChatCompletion answers from the first matching rule
+func (p *ScriptedProvider) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	for i, rule := range p.rules {
+		if p.used[i] || (rule.Match != nil && !rule.Match(req)) {
+			continue
+		}
+		if rule.Once {
+			p.used[i] = true
+		}
+		if rule.Err != nil {
+			return nil, rule.Err
+		}
+		return cloneResponse(rule.Response), nil
+	}
+
+	last := ""
+	if len(req.Messages) > 0 {
+		last = req.Messages[len(req.Messages)-1].Content
+	}
+	return nil, ErrNoScriptedResponse.WithDetails("last message: " + last)
+}
+
+// ChatCompletionStream replays the matched response word by word
+func (p *ScriptedProvider) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error) {
+	resp, err := p.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return streamResponse(resp), nil
+}
+
+// GetModels returns the models named in the scripted responses
+func (p *ScriptedProvider) GetModels(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := make(map[string]bool)
+	models := make([]string, 0)
+	for _, rule := range p.rules {
+		if rule.Response != nil && rule.Response.Model != "" && !seen[rule.Response.Model] {
+			seen[rule.Response.Model] = true
+			models = append(models, rule.Response.Model)
+		}
+	}
+	return models, nil
+}
+
+// Close releases provider resources
+func (p *ScriptedProvider) Close() error {
+	return nil
+}
+
+// Requests returns a copy of every request received so far
+func (p *ScriptedProvider) Requests() []ChatCompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	requests := make([]ChatCompletionRequest, len(p.requests))
+	copy(requests, p.requests)
+	return requests
+}
+
+// TextResponse builds a response carrying a plain assistant answer
+func TextResponse(content string) *ChatCompletionResponse {
+	return &ChatCompletionResponse{
+		Object: "chat.completion",
+		Choices: []Choice{{
+			Message:      Message{Role: RoleAssistant, Content: content},
+			FinishReason: FinishReasonStop,
+		}},
+	}
+}
+
+// ToolCallResponse builds a response in which the assistant calls the given tools
+func ToolCallResponse(calls ...ToolCall) *ChatCompletionResponse {
+	return &ChatCompletionResponse{
+		Object: "chat.completion",
+		Choices: []Choice{{
+			Message:      Message{Role: RoleAssistant, ToolCalls: calls},
+			FinishReason: FinishReasonToolCalls,
+		}},
+	}
+}
+
+// cloneResponse copies a response so callers cannot mutate a shared script
+func cloneResponse(resp *ChatCompletionResponse) *ChatCompletionResponse {
+	if resp == nil {
+		return nil
+	}
+	clone := *resp
+	clone.Choices = make([]Choice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		clone.Choices[i] = choice
+		clone.Choices[i].Message.ToolCalls = append([]ToolCall(nil), choice.Message.ToolCalls...)
+	}
+	return &clone
+}
+
+// streamResponse emits a complete response as word-sized stream chunks. The channel
+// is fully buffered so an abandoned stream never leaks a goroutine.
+func streamResponse(resp *ChatCompletionResponse) <-chan StreamChunk {
+	var chunks []StreamChunk
+	if resp != nil && len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		chunks = append(chunks, StreamChunk{ID: resp.ID, Model: resp.Model, Role: choice.Message.Role})
+		for _, word := range strings.SplitAfter(choice.Message.Content, " ") {
+			if word != "" {
+				chunks = append(chunks, StreamChunk{Content: word})
+			}
+		}
+		for i, call := range choice.Message.ToolCalls {
+			chunks = append(chunks, StreamChunk{ToolCalls: []ToolCallDelta{{Index: i, ID: call.ID, Type: call.Type, Function: call.Function}}})
+		}
+		usage := resp.Usage
+		chunks = append(chunks, StreamChunk{FinishReason: choice.FinishReason, Usage: &usage})
+	}
+
+	stream := make(chan StreamChunk, len(chunks))
+	for _, chunk := range chunks {
+		stream <- chunk
+	}
+	close(stream)
+	return stream
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a rehearsal with the script in hand, the scripted provider lets every scene play out the same way each time. These tests make sure the lines are delivered in order and no cue is missed.
+ */
+
+func TestScriptedProvider_MatchesRulesInOrder(t *testing.T) {
+	provider := NewScriptedProvider(
+		ScriptRule{Match: MatchLastRole(RoleTool), Response: TextResponse("done")},
+		ScriptRule{Match: MatchLastMessageContains("weather"), Response: ToolCallResponse(ToolCall{ID: "c1", Function: FunctionCall{Name: "forecast"}}), Once: true},
+		ScriptRule{Err: errors.New("unexpected request")},
+	)
+	ctx := context.Background()
+
+	resp, err := provider.ChatCompletion(ctx, ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: "weather in Bergen"}}})
+	if err != nil || len(resp.Choices[0].Message.ToolCalls) != 1 {
+		t.Fatalf("expected tool call response, got %+v (err: %v)", resp, err)
+	}
+
+	resp, err = provider.ChatCompletion(ctx, ChatCompletionRequest{Messages: []Message{{Role: RoleTool, Content: "rain"}}})
+	if err != nil || resp.Choices[0].Message.Content != "done" {
+		t.Fatalf("expected final answer, got %+v (err: %v)", resp, err)
+	}
+
+	// The once-only rule is consumed, so the catch-all error rule answers
+	if _, err := provider.ChatCompletion(ctx, ChatCompletionRequest{Messages: []Message{{Role: RoleUser, Content: "weather again"}}}); err == nil {
+		t.Error("expected catch-all error after the once rule was consumed")
+	}
+	if len(provider.Requests()) != 3 {
+		t.Errorf("expected 3 recorded requests, got %d", len(provider.Requests()))
+	}
+}
+
+func TestSequenceProvider_RunsOut(t *testing.T) {
+	provider := NewSequenceProvider(TextResponse("one"))
+	ctx := context.Background()
+
+	if resp, err := provider.ChatCompletion(ctx, ChatCompletionRequest{}); err != nil || resp.Choices[0].Message.Content != "one" {
+		t.Fatalf("expected first response, got %+v (err: %v)", resp, err)
+	}
+	_, err := provider.ChatCompletion(ctx, ChatCompletionRequest{})
+	var llmErr LLMError
+	if !errors.As(err, &llmErr) || llmErr.Code != ErrNoScriptedResponse.Code {
+		t.Errorf("expected ErrNoScriptedResponse, got %v", err)
+	}
+}
+
+func TestScriptedProvider_Stream(t *testing.T) {
+	provider := NewSequenceProvider(TextResponse("streamed word by word"))
+
+	stream, err := provider.ChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := CollectStream(stream)
+	if err != nil || resp.Choices[0].Message.Content != "streamed word by word" {
+		t.Errorf("expected reassembled content, got %+v (err: %v)", resp, err)
+	}
+}
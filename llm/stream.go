@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// StreamingProvider is implemented by providers that can stream chat completions
+// token by token. It is optional: callers should type-assert a Provider and fall
+// back to ChatCompletion when streaming is not supported.
+type StreamingProvider interface {
+	Provider
+
+	// ChatCompletionStream starts a streaming completion. The returned channel
+	// yields deltas as they arrive and is closed when the stream ends. A failure
+	// after the stream has started is delivered as a final chunk with Err set.
+	ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error)
+}
+
+// StreamChunk is a single incremental update of a streaming completion
+type StreamChunk struct {
+	ID           string          `json:"id,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Role         string          `json:"role,omitempty"`
+	Content      string          `json:"content,omitempty"`
+	ToolCalls    []ToolCallDelta `json:"tool_calls,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Usage        *Usage          `json:"usage,omitempty"`
+	Err          error           `json:"-"`
+
+	// Extra carries provider metadata, merged into ChatCompletionResponse.Extra
+	// by StreamAccumulator
+	Extra map[string]interface{} `json:"-"`
+}
+
+// ToolCallDelta is a fragment of a tool call. Fragments sharing an Index belong
+// to the same call; ID and name arrive first and arguments are appended piecewise.
+type ToolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// StreamAccumulator assembles stream chunks into a complete response
+type StreamAccumulator struct {
+	id           string
+	model        string
+	role         string
+	content      strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+	usage        Usage
+	extra        map[string]interface{}
+}
+
+// NewStreamAccumulator creates an empty accumulator
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		role:      RoleAssistant,
+		toolCalls: make(map[int]*ToolCall),
+	}
+}
+
+// Add merges a chunk into the accumulated response
+func (a *StreamAccumulator) Add(chunk StreamChunk) {
+	if chunk.ID != "" {
+		a.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.Role != "" {
+		a.role = chunk.Role
+	}
+	a.content.WriteString(chunk.Content)
+
+	for _, delta := range chunk.ToolCalls {
+		call, ok := a.toolCalls[delta.Index]
+		if !ok {
+			call = &ToolCall{Type: "function"}
+			a.toolCalls[delta.Index] = call
+		}
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+
+	if chunk.FinishReason != "" {
+		a.finishReason = chunk.FinishReason
+	}
+	if chunk.Usage != nil {
+		a.usage = *chunk.Usage
+	}
+	for key, value := range chunk.Extra {
+		if a.extra == nil {
+			a.extra = make(map[string]interface{})
+		}
+		a.extra[key] = value
+	}
+}
+
+// Response returns the completion assembled so far
+func (a *StreamAccumulator) Response() *ChatCompletionResponse {
+	indexes := make([]int, 0, len(a.toolCalls))
+	for index := range a.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var toolCalls []ToolCall
+	for _, index := range indexes {
+		toolCalls = append(toolCalls, *a.toolCalls[index])
+	}
+
+	return &ChatCompletionResponse{
+		ID:     a.id,
+		Object: "chat.completion",
+		Model:  a.model,
+		Choices: []Choice{{
+			Message: Message{
+				Role:      a.role,
+				Content:   a.content.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: a.finishReason,
+		}},
+		Usage: a.usage,
+		Extra: a.extra,
+	}
+}
+
+// CollectStream drains a stream into a complete response, returning the first stream error
+func CollectStream(stream <-chan StreamChunk) (*ChatCompletionResponse, error) {
+	acc := NewStreamAccumulator()
+	for chunk := range stream {
+		if chunk.Err != nil {
+			return nil, chunk.Err
+		}
+		acc.Add(chunk)
+	}
+	return acc.Response(), nil
+}
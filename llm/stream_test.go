@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like gathering driftwood along the shore into one fire, these tests make sure scattered stream fragments come together as a single, whole answer.
+ */
+
+func TestStreamAccumulator_InterleavedToolCalls(t *testing.T) {
+	acc := NewStreamAccumulator()
+	acc.Add(StreamChunk{ToolCalls: []ToolCallDelta{{Index: 1, ID: "b", Function: FunctionCall{Name: "second", Arguments: "{"}}}})
+	acc.Add(StreamChunk{ToolCalls: []ToolCallDelta{{Index: 0, ID: "a", Function: FunctionCall{Name: "first", Arguments: "{}"}}}})
+	acc.Add(StreamChunk{ToolCalls: []ToolCallDelta{{Index: 1, Function: FunctionCall{Arguments: "}"}}}})
+
+	calls := acc.Response().Choices[0].Message.ToolCalls
+	if len(calls) != 2 || calls[0].ID != "a" || calls[1].ID != "b" {
+		t.Fatalf("expected calls ordered by index, got %+v", calls)
+	}
+	if calls[1].Function.Arguments != "{}" || calls[1].Type != "function" {
+		t.Errorf("expected merged arguments and default type, got %+v", calls[1])
+	}
+}
+
+func TestCollectStream_Error(t *testing.T) {
+	stream := make(chan StreamChunk, 2)
+	stream <- StreamChunk{Content: "partial"}
+	stream <- StreamChunk{Err: errors.New("connection reset")}
+	close(stream)
+
+	if _, err := CollectStream(stream); err == nil {
+		t.Error("expected stream error to be returned")
+	}
+}
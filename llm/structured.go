@@ -0,0 +1,238 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Response format types understood by ResponseFormat
+const (
+	ResponseFormatJSONSchema = "json_schema"
+	ResponseFormatJSONObject = "json_object"
+)
+
+// DefaultMaxRepairs is how often a response that does not match the schema is sent back
+// to the model for correction
+const DefaultMaxRepairs = 2
+
+// ErrInvalidStructuredOutput is returned when the model keeps answering with JSON that
+// does not match the requested schema
+var ErrInvalidStructuredOutput = LLMError{Code: "invalid_structured_output", Message: "Model response does not match the requested JSON schema"}
+
+// ResponseFormat asks the model for JSON, optionally constrained by a JSON Schema
+type ResponseFormat struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+// MarshalJSON encodes the format the way the OpenAI API expects it
+func (f ResponseFormat) MarshalJSON() ([]byte, error) {
+	if f.Type != ResponseFormatJSONSchema {
+		return json.Marshal(map[string]string{"type": f.Type})
+	}
+	return json.Marshal(map[string]interface{}{
+		"type": f.Type,
+		"json_schema": map[string]interface{}{
+			"name":   f.Name,
+			"schema": f.Schema,
+			"strict": f.Strict,
+		},
+	})
+}
+
+// JSONSchemaFormat requests JSON matching the given schema
+func JSONSchemaFormat(name string, schema json.RawMessage) *ResponseFormat {
+	if name == "" {
+		name = "response"
+	}
+	return &ResponseFormat{Type: ResponseFormatJSONSchema, Name: name, Schema: schema}
+}
+
+// JSONSchemaFormatFor requests JSON matching the schema derived from v's type, see SchemaFor
+func JSONSchemaFormatFor(name string, v interface{}) (*ResponseFormat, error) {
+	schema, err := SchemaFor(v)
+	if err != nil {
+		return nil, err
+	}
+	return JSONSchemaFormat(name, schema), nil
+}
+
+// ResponseFormatProvider is implemented by providers that can enforce a ResponseFormat
+// natively. Other providers are prompted with the schema instead.
+type ResponseFormatProvider interface {
+	SupportsResponseFormat(model string) bool
+}
+
+// SupportsResponseFormat reports whether provider enforces response formats for model
+func SupportsResponseFormat(provider Provider, model string) bool {
+	p, ok := provider.(ResponseFormatProvider)
+	return ok && p.SupportsResponseFormat(model)
+}
+
+// ApplyResponseFormat prepares a request for structured output: natively when the provider
+// supports it, otherwise by instructing the model in the system message
+func ApplyResponseFormat(provider Provider, req ChatCompletionRequest, format *ResponseFormat) ChatCompletionRequest {
+	if format == nil {
+		return req
+	}
+	if SupportsResponseFormat(provider, req.Model) {
+		req.ResponseFormat = format
+		return req
+	}
+
+	req.ResponseFormat = nil
+	instruction := StructuredOutputInstruction(format)
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if len(req.Messages) > 0 && req.Messages[0].Role == RoleSystem {
+		system := req.Messages[0]
+		system.Content = strings.TrimSpace(system.Content + "\n\n" + instruction)
+		messages = append(messages, system)
+		messages = append(messages, req.Messages[1:]...)
+	} else {
+		messages = append(messages, Message{Role: RoleSystem, Content: instruction})
+		messages = append(messages, req.Messages...)
+	}
+	req.Messages = messages
+	return req
+}
+
+// StructuredOutputInstruction tells a model without native support how to answer
+func StructuredOutputInstruction(format *ResponseFormat) string {
+	if format.Type != ResponseFormatJSONSchema || len(format.Schema) == 0 {
+		return "Respond with a single JSON value only, without prose or code fences."
+	}
+	return "Respond with a single JSON value only, without prose or code fences. It must match this JSON Schema:\n" + string(format.Schema)
+}
+
+// ParseStructuredOutput extracts the JSON value from a model reply, tolerating code fences
+// and surrounding prose, and validates it against the format's schema
+func ParseStructuredOutput(content string, format *ResponseFormat) (json.RawMessage, error) {
+	data := extractJSON(content)
+	if data == nil {
+		return nil, ErrResponseInvalid.WithDetails("the reply contains no JSON value")
+	}
+	if format != nil && format.Type == ResponseFormatJSONSchema && len(format.Schema) > 0 {
+		if err := ValidateJSON(format.Schema, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// extractJSON finds the JSON value in a reply
+func extractJSON(content string) json.RawMessage {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+		text = strings.TrimSpace(text)
+	}
+	if json.Valid([]byte(text)) {
+		return json.RawMessage(text)
+	}
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return nil
+	}
+	closer := "}"
+	if text[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(text, closer)
+	if end <= start || !json.Valid([]byte(text[start:end+1])) {
+		return nil
+	}
+	return json.RawMessage(text[start : end+1])
+}
+
+// RepairMessage asks the model to correct a reply that failed validation
+func RepairMessage(err error) Message {
+	return Message{
+		Role:    RoleUser,
+		Content: fmt.Sprintf("Your previous reply was not valid: %s. Reply again with only the corrected JSON.", errorDetails(err)),
+	}
+}
+
+// errorDetails prefers the details of an LLMError over its generic message
+func errorDetails(err error) string {
+	var llmErr LLMError
+	if errors.As(err, &llmErr) && llmErr.Details != "" {
+		return llmErr.Details
+	}
+	return err.Error()
+}
+
+// CompleteStructured runs a completion whose reply must match format, sending invalid
+// replies back for repair up to maxRepairs times (DefaultMaxRepairs when zero, none when negative)
+func CompleteStructured(ctx context.Context, provider Provider, req ChatCompletionRequest, format *ResponseFormat, maxRepairs int) (json.RawMessage, *ChatCompletionResponse, error) {
+	if maxRepairs == 0 {
+		maxRepairs = DefaultMaxRepairs
+	}
+	req = ApplyResponseFormat(provider, req, format)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := provider.ChatCompletion(ctx, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, resp, ErrResponseInvalid.WithDetails("response contains no choices")
+		}
+
+		reply := resp.Choices[0].Message
+		data, parseErr := ParseStructuredOutput(reply.Content, format)
+		if parseErr == nil {
+			return data, resp, nil
+		}
+		if attempt >= maxRepairs {
+			return nil, resp, ErrInvalidStructuredOutput.WithDetails(errorDetails(parseErr))
+		}
+
+		if reply.Role == "" {
+			reply.Role = RoleAssistant
+		}
+		req.Messages = append(append([]Message(nil), req.Messages...), reply, RepairMessage(parseErr))
+	}
+}
+
+// CompleteAs runs a structured completion whose schema is derived from T and decodes
+// the reply into a T
+func CompleteAs[T any](ctx context.Context, provider Provider, req ChatCompletionRequest, maxRepairs int) (T, *ChatCompletionResponse, error) {
+	var out T
+	format, err := JSONSchemaFormatFor(fmt.Sprintf("%T", out), out)
+	if err != nil {
+		return out, nil, err
+	}
+	format.Name = schemaName(format.Name)
+
+	data, resp, err := CompleteStructured(ctx, provider, req, format, maxRepairs)
+	if err != nil {
+		return out, resp, err
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, resp, ErrInvalidStructuredOutput.WithDetails(err.Error())
+	}
+	return out, resp, nil
+}
+
+// schemaName turns a Go type name into a name the OpenAI API accepts
+func schemaName(name string) string {
+	name = name[strings.LastIndex(name, ".")+1:]
+	var sb strings.Builder
+	for _, r := range name {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return "response"
+	}
+	return sb.String()
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Like a form at the post office that is handed back until every box is filled, these tests make sure a model's answer is asked for in the right shape, checked, and returned for correction before it is accepted.
+ */
+
+type weatherReport struct {
+	City        string  `json:"city"`
+	Temperature float64 `json:"temperature"`
+}
+
+func TestCompleteStructured_NativeResponseFormat(t *testing.T) {
+	var received map[string]interface{}
+	provider := newTestOpenAIProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"{\"city\":\"Bergen\",\"temperature\":11.5}"}}]}`))
+	})
+
+	report, _, err := CompleteAs[weatherReport](context.Background(), provider, ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: RoleUser, Content: "weather in Bergen"}},
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.City != "Bergen" || report.Temperature != 11.5 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	format, ok := received["response_format"].(map[string]interface{})
+	if !ok || format["type"] != ResponseFormatJSONSchema {
+		t.Fatalf("expected a json_schema response_format, got %v", received["response_format"])
+	}
+	jsonSchema := format["json_schema"].(map[string]interface{})
+	if jsonSchema["name"] != "weatherReport" || jsonSchema["schema"] == nil {
+		t.Errorf("unexpected json_schema: %v", jsonSchema)
+	}
+}
+
+func TestCompleteStructured_PromptFallbackAndRepair(t *testing.T) {
+	provider := NewSequenceProvider(
+		TextResponse("It is sunny in Bergen."),
+		TextResponse("```json\n{\"city\":\"Bergen\"}\n```"),
+		TextResponse("Here you go: {\"city\":\"Bergen\",\"temperature\":11.5}"),
+	)
+
+	report, _, err := CompleteAs[weatherReport](context.Background(), provider, ChatCompletionRequest{
+		Messages: []Message{
+			{Role: RoleSystem, Content: "You are a weather service."},
+			{Role: RoleUser, Content: "weather in Bergen"},
+		},
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Temperature != 11.5 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	requests := provider.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	first := requests[0]
+	if first.ResponseFormat != nil {
+		t.Errorf("providers without native support must not receive a response format")
+	}
+	if system := first.Messages[0].Content; !strings.HasPrefix(system, "You are a weather service.") || !strings.Contains(system, `"temperature"`) {
+		t.Errorf("expected the schema in the system message, got %q", system)
+	}
+
+	// The repair request carries the rejected reply and what was wrong with it
+	third := requests[2].Messages
+	repair := third[len(third)-1]
+	if third[len(third)-2].Role != RoleAssistant || !strings.Contains(repair.Content, `missing required property "temperature"`) {
+		t.Errorf("unexpected repair message: %+v", repair)
+	}
+}
+
+func TestCompleteStructured_RepairsExhausted(t *testing.T) {
+	provider := NewScriptedProvider(ScriptRule{Response: TextResponse("no JSON here")})
+	format, err := JSONSchemaFormatFor("report", weatherReport{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _, err = CompleteStructured(context.Background(), provider, ChatCompletionRequest{
+		Messages: []Message{{Role: RoleUser, Content: "weather"}},
+	}, format, 1)
+	if !errors.Is(err, ErrInvalidStructuredOutput) {
+		t.Fatalf("expected ErrInvalidStructuredOutput, got %v", err)
+	}
+	if got := len(provider.Requests()); got != 2 {
+		t.Errorf("expected the original request and one repair, got %d requests", got)
+	}
+}
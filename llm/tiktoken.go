@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Tiktoken vocabularies of the OpenAI model families
+const (
+	EncodingCL100K = "cl100k_base"
+	EncodingO200K  = "o200k_base"
+)
+
+func init() {
+	// The vocabularies are embedded in the binary instead of downloaded on first use
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// BPETokenCounter counts tokens exactly with a tiktoken vocabulary. The vocabulary is
+// loaded on the first count; should that fail the counter falls back to ApproxTokenCounter.
+type BPETokenCounter struct {
+	encoding string
+	once     sync.Once
+	bpe      *tiktoken.Tiktoken
+}
+
+// NewBPETokenCounter creates a counter for a tiktoken encoding, such as EncodingO200K
+func NewBPETokenCounter(encoding string) *BPETokenCounter {
+	return &BPETokenCounter{encoding: encoding}
+}
+
+// Encoding returns the name of the vocabulary
+func (c *BPETokenCounter) Encoding() string {
+	return c.encoding
+}
+
+// CountTokens encodes text without special tokens and counts the result
+func (c *BPETokenCounter) CountTokens(text string) int {
+	c.once.Do(func() {
+		bpe, err := tiktoken.GetEncoding(c.encoding)
+		if err != nil {
+			slog.Warn("failed to load tokenizer vocabulary, counting approximately", "encoding", c.encoding, "error", err)
+			return
+		}
+		c.bpe = bpe
+	})
+	if c.bpe == nil {
+		return ApproxTokenCounter{}.CountTokens(text)
+	}
+	return len(c.bpe.EncodeOrdinary(text))
+}
+
+// The counters are shared by every model of a family so each vocabulary is loaded once
+var (
+	cl100kCounter = NewBPETokenCounter(EncodingCL100K)
+	o200kCounter  = NewBPETokenCounter(EncodingO200K)
+)
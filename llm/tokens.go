@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultContextWindow is assumed for models missing from the context window table
+const DefaultContextWindow = 8192
+
+// messageOverheadTokens approximates the role and framing tokens added to every message
+const messageOverheadTokens = 4
+
+// TokenCounter counts the tokens a model would see for a piece of text. The OpenAI model
+// families are counted exactly with their BPE vocabularies, other tokenizers can be added
+// with RegisterTokenCounter. ApproxTokenCounter is used when none is registered for a model.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TokenCounterFunc adapts a function, e.g. a tokenizer's encode length, to TokenCounter
+type TokenCounterFunc func(text string) int
+
+// CountTokens calls f
+func (f TokenCounterFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// ApproxTokenCounter estimates BPE token counts without a vocabulary. It tends to
+// overestimate slightly, which is the safe direction when fitting a context window.
+type ApproxTokenCounter struct{}
+
+// CountTokens counts a token per four letters of a word, one per punctuation mark and
+// one per CJK character
+func (ApproxTokenCounter) CountTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// CountMessageTokens counts the prompt tokens of a conversation including per-message overhead
+func CountMessageTokens(counter TokenCounter, messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += messageOverheadTokens + counter.CountTokens(msg.Content)
+		for _, call := range msg.ToolCalls {
+			total += counter.CountTokens(call.Function.Name) + counter.CountTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+var (
+	registryMu    sync.RWMutex
+	tokenCounters = map[string]TokenCounter{
+		"gpt-4.1":                o200kCounter,
+		"gpt-4o":                 o200kCounter,
+		"chatgpt-4o":             o200kCounter,
+		"gpt-4":                  cl100kCounter,
+		"gpt-3.5-turbo":          cl100kCounter,
+		"o1":                     o200kCounter,
+		"o3":                     o200kCounter,
+		"o4-mini":                o200kCounter,
+		"text-embedding-3":       cl100kCounter,
+		"text-embedding-ada-002": cl100kCounter,
+	}
+	contextWindows = map[string]int{
+		"gpt-4.1":       1047576,
+		"gpt-4o":        128000,
+		"gpt-4-turbo":   128000,
+		"gpt-4":         8192,
+		"gpt-3.5-turbo": 16385,
+		"o1":            200000,
+		"o1-mini":       128000,
+		"o1-preview":    128000,
+		"o3":            200000,
+		"o4-mini":       200000,
+		"claude-":       200000,
+		"llama3.1":      128000,
+		"llama3.2":      128000,
+		"llama3":        8192,
+		"mistral":       32768,
+		"qwen2.5":       32768,
+		"deepseek-chat": 65536,
+	}
+)
+
+// RegisterTokenCounter sets the counter for models whose name starts with prefix
+func RegisterTokenCounter(prefix string, counter TokenCounter) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	tokenCounters[prefix] = counter
+}
+
+// TokenCounterFor returns the registered counter with the longest matching prefix,
+// or ApproxTokenCounter
+func TokenCounterFor(model string) TokenCounter {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if prefix, ok := longestPrefix(model, tokenCounters); ok {
+		return tokenCounters[prefix]
+	}
+	return ApproxTokenCounter{}
+}
+
+// RegisterContextWindow records the context window, in tokens, of models whose name starts with prefix
+func RegisterContextWindow(prefix string, tokens int) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	contextWindows[prefix] = tokens
+}
+
+// ContextWindow returns the context window of a model from the table, using the longest
+// matching prefix. Unknown models get DefaultContextWindow and false.
+func ContextWindow(model string) (int, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if prefix, ok := longestPrefix(model, contextWindows); ok {
+		return contextWindows[prefix], true
+	}
+	return DefaultContextWindow, false
+}
+
+func longestPrefix[V any](model string, table map[string]V) (string, bool) {
+	prefixes := make([]string, 0, len(table))
+	for prefix := range table {
+		if strings.HasPrefix(model, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return "", false
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return prefixes[0], true
+}
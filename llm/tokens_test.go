@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Counting herring by the barrel rather than one by one is fine, as long as the barrel is never smaller than the catch—these tests check that token estimates err on the safe side and that every model finds its context window.
+ */
+
+func TestApproxTokenCounter(t *testing.T) {
+	counter := ApproxTokenCounter{}
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 4},
+		{"Hello, world!", 6},
+		{"你好", 2},
+	}
+	for _, tc := range cases {
+		if got := counter.CountTokens(tc.text); got != tc.want {
+			t.Errorf("%q: expected %d tokens, got %d", tc.text, tc.want, got)
+		}
+	}
+
+	// English prose averages about 0.75 words per token, the estimate should not undercount it
+	prose := strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+	if got := counter.CountTokens(prose); got < 900 {
+		t.Errorf("expected at least 900 tokens for 900 words, got %d", got)
+	}
+}
+
+func TestTokenCounterFor(t *testing.T) {
+	if _, ok := TokenCounterFor("claude-3-5-sonnet-latest").(ApproxTokenCounter); !ok {
+		t.Error("expected the approximate fallback")
+	}
+
+	RegisterTokenCounter("test-model", TokenCounterFunc(func(text string) int { return len(text) }))
+	defer func() {
+		registryMu.Lock()
+		delete(tokenCounters, "test-model")
+		registryMu.Unlock()
+	}()
+
+	if got := TokenCounterFor("test-model-large").CountTokens("abc"); got != 3 {
+		t.Errorf("expected the registered counter, got %d", got)
+	}
+	if got := CountMessageTokens(TokenCounterFor("test-model"), []Message{{Role: RoleUser, Content: "abc"}}); got != 3+messageOverheadTokens {
+		t.Errorf("expected content plus overhead, got %d", got)
+	}
+}
+
+func TestTokenCounterFor_OpenAIVocabularies(t *testing.T) {
+	cases := []struct {
+		model    string
+		encoding string
+	}{
+		{"gpt-4o-mini", EncodingO200K},
+		{"gpt-4.1-nano", EncodingO200K},
+		{"o1-mini", EncodingO200K},
+		{"gpt-4-turbo", EncodingCL100K},
+		{"gpt-3.5-turbo-0125", EncodingCL100K},
+	}
+	for _, tc := range cases {
+		counter, ok := TokenCounterFor(tc.model).(*BPETokenCounter)
+		if !ok || counter.Encoding() != tc.encoding {
+			t.Errorf("%s: expected the %s vocabulary, got %#v", tc.model, tc.encoding, TokenCounterFor(tc.model))
+		}
+	}
+}
+
+func TestBPETokenCounter(t *testing.T) {
+	cases := []struct {
+		encoding string
+		text     string
+		want     int
+	}{
+		{EncodingCL100K, "", 0},
+		{EncodingCL100K, "hello world", 2},
+		{EncodingCL100K, "tiktoken is great!", 6},
+		{EncodingO200K, "hello world", 2},
+		// Special tokens in user text are counted as ordinary text
+		{EncodingCL100K, "<|endoftext|>", 7},
+	}
+	for _, tc := range cases {
+		if got := NewBPETokenCounter(tc.encoding).CountTokens(tc.text); got != tc.want {
+			t.Errorf("%s %q: expected %d tokens, got %d", tc.encoding, tc.text, tc.want, got)
+		}
+	}
+
+	if got := NewBPETokenCounter("no_such_vocabulary").CountTokens("hello world"); got != (ApproxTokenCounter{}).CountTokens("hello world") {
+		t.Errorf("expected the approximate fallback for an unknown vocabulary, got %d", got)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	cases := []struct {
+		model string
+		want  int
+		known bool
+	}{
+		{"gpt-4o-mini", 128000, true},
+		{"gpt-4-0613", 8192, true},
+		{"gpt-4.1-mini", 1047576, true},
+		{"o1-2024-12-17", 200000, true},
+		{"o1-mini", 128000, true},
+		{"o1-mini-2024-09-12", 128000, true},
+		{"o1-preview", 128000, true},
+		{"claude-3-5-sonnet-latest", 200000, true},
+		{"llama3.1:8b", 128000, true},
+		{"mystery", DefaultContextWindow, false},
+	}
+	for _, tc := range cases {
+		got, known := ContextWindow(tc.model)
+		if got != tc.want || known != tc.known {
+			t.Errorf("%s: expected %d/%v, got %d/%v", tc.model, tc.want, tc.known, got, known)
+		}
+	}
+}
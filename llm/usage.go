@@ -0,0 +1,317 @@
+package llm
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request tags identify who a request was made for. The agent name is set in
+// ChatCompletionRequest.Extra by the agent, the task and agency travel on the context.
+const (
+	TagAgent  = "agent_name"
+	TagTaskID = "task_id"
+	TagAgency = "agency"
+)
+
+type requestTagsKey struct{}
+
+// WithRequestTags returns a context carrying tags for every request made with it,
+// merged over any tags already on ctx
+func WithRequestTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range RequestTags(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		if v != "" {
+			merged[k] = v
+		}
+	}
+	return context.WithValue(ctx, requestTagsKey{}, merged)
+}
+
+// RequestTags returns the tags carried by ctx
+func RequestTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(requestTagsKey{}).(map[string]string)
+	return tags
+}
+
+// requestTag reads a tag from the request Extra, falling back to the context
+func requestTag(ctx context.Context, req ChatCompletionRequest, key string) string {
+	if v, ok := req.Extra[key].(string); ok && v != "" {
+		return v
+	}
+	return RequestTags(ctx)[key]
+}
+
+// ModelPrice is the price in USD per million tokens
+type ModelPrice struct {
+	PromptPerMillion     float64 `json:"prompt_per_million"`
+	CompletionPerMillion float64 `json:"completion_per_million"`
+}
+
+// Cost returns the price of the given usage
+func (p ModelPrice) Cost(usage Usage) float64 {
+	return (float64(usage.PromptTokens)*p.PromptPerMillion + float64(usage.CompletionTokens)*p.CompletionPerMillion) / 1e6
+}
+
+var modelPrices = map[string]ModelPrice{
+	"gpt-4.1":           {2.00, 8.00},
+	"gpt-4.1-mini":      {0.40, 1.60},
+	"gpt-4.1-nano":      {0.10, 0.40},
+	"gpt-4o":            {2.50, 10.00},
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4-turbo":       {10.00, 30.00},
+	"gpt-4":             {30.00, 60.00},
+	"gpt-3.5-turbo":     {0.50, 1.50},
+	"o1":                {15.00, 60.00},
+	"o1-mini":           {1.10, 4.40},
+	"o3-mini":           {1.10, 4.40},
+	"claude-3-5-haiku":  {0.80, 4.00},
+	"claude-3-5-sonnet": {3.00, 15.00},
+	"claude-3-7-sonnet": {3.00, 15.00},
+	"claude-3-opus":     {15.00, 75.00},
+	"claude-sonnet-4":   {3.00, 15.00},
+	"claude-opus-4":     {15.00, 75.00},
+}
+
+// RegisterModelPrice sets the price of models whose name starts with prefix
+func RegisterModelPrice(prefix string, price ModelPrice) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	modelPrices[prefix] = price
+}
+
+// PriceFor returns the price with the longest matching prefix. Unknown models, such as
+// local ones, report false and cost nothing.
+func PriceFor(model string) (ModelPrice, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if prefix, ok := longestPrefix(model, modelPrices); ok {
+		return modelPrices[prefix], true
+	}
+	return ModelPrice{}, false
+}
+
+// UsageEntry is the token usage and cost of a single completion
+type UsageEntry struct {
+	Time             time.Time `json:"time"`
+	Agent            string    `json:"agent,omitempty"`
+	TaskID           string    `json:"task_id,omitempty"`
+	Agency           string    `json:"agency,omitempty"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost_usd"`
+}
+
+// UsageTotals sums a set of entries
+type UsageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost_usd"`
+}
+
+func (t *UsageTotals) add(e UsageEntry) {
+	t.Requests++
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+	t.TotalTokens += e.TotalTokens
+	t.Cost += e.Cost
+}
+
+// UsageFilter selects ledger entries, empty fields match everything
+type UsageFilter struct {
+	Agent  string
+	TaskID string
+	Agency string
+	Model  string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (f UsageFilter) match(e UsageEntry) bool {
+	return (f.Agent == "" || f.Agent == e.Agent) &&
+		(f.TaskID == "" || f.TaskID == e.TaskID) &&
+		(f.Agency == "" || f.Agency == e.Agency) &&
+		(f.Model == "" || f.Model == e.Model) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// UsageDimension groups ledger totals
+type UsageDimension string
+
+const (
+	UsageByAgent  UsageDimension = "agent"
+	UsageByTask   UsageDimension = "task_id"
+	UsageByAgency UsageDimension = "agency"
+	UsageByModel  UsageDimension = "model"
+)
+
+func (d UsageDimension) key(e UsageEntry) string {
+	switch d {
+	case UsageByAgent:
+		return e.Agent
+	case UsageByTask:
+		return e.TaskID
+	case UsageByAgency:
+		return e.Agency
+	default:
+		return e.Model
+	}
+}
+
+// Ledger records the usage and cost of every completion, it is safe for concurrent use
+type Ledger struct {
+	mu      sync.RWMutex
+	entries []UsageEntry
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{entries: make([]UsageEntry, 0)}
+}
+
+// Middleware records the usage of every successful completion passing through the provider
+func (l *Ledger) Middleware() Middleware {
+	return func(next Provider) Provider {
+		return WithHooks(Hooks{
+			OnResponse: func(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse, err error, latency time.Duration) {
+				if err != nil || resp == nil {
+					return
+				}
+				model := resp.Model
+				if model == "" {
+					model = req.Model
+				}
+				l.Record(UsageEntry{
+					Agent:            requestTag(ctx, req, TagAgent),
+					TaskID:           requestTag(ctx, req, TagTaskID),
+					Agency:           requestTag(ctx, req, TagAgency),
+					Provider:         next.ID(),
+					Model:            model,
+					PromptTokens:     resp.Usage.PromptTokens,
+					CompletionTokens: resp.Usage.CompletionTokens,
+					TotalTokens:      resp.Usage.TotalTokens,
+				})
+			},
+		})(next)
+	}
+}
+
+// Record adds an entry, filling in the time, total and cost when they are missing
+func (l *Ledger) Record(entry UsageEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.TotalTokens == 0 {
+		entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+	}
+	if entry.Cost == 0 {
+		if price, ok := PriceFor(entry.Model); ok {
+			entry.Cost = price.Cost(Usage{PromptTokens: entry.PromptTokens, CompletionTokens: entry.CompletionTokens})
+		}
+	}
+
+	l.mu.Lock()
+	l.entries = append(l.entries, entry)
+	l.mu.Unlock()
+}
+
+// Entries returns the entries matching filter in the order they were recorded
+func (l *Ledger) Entries(filter UsageFilter) []UsageEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := make([]UsageEntry, 0)
+	for _, e := range l.entries {
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Totals sums the entries matching filter
+func (l *Ledger) Totals(filter UsageFilter) UsageTotals {
+	var totals UsageTotals
+	for _, e := range l.Entries(filter) {
+		totals.add(e)
+	}
+	return totals
+}
+
+// TotalsBy sums the entries matching filter per agent, task, agency or model
+func (l *Ledger) TotalsBy(dimension UsageDimension, filter UsageFilter) map[string]UsageTotals {
+	groups := make(map[string]UsageTotals)
+	for _, e := range l.Entries(filter) {
+		key := dimension.key(e)
+		totals := groups[key]
+		totals.add(e)
+		groups[key] = totals
+	}
+	return groups
+}
+
+// WriteJSON exports the entries matching filter as a JSON array
+func (l *Ledger) WriteJSON(w io.Writer, filter UsageFilter) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(l.Entries(filter)); err != nil {
+		return fmt.Errorf("failed to export usage as JSON: %w", err)
+	}
+	return nil
+}
+
+// WriteCSV exports the entries matching filter as CSV with a header row
+func (l *Ledger) WriteCSV(w io.Writer, filter UsageFilter) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"time", "agent", "task_id", "agency", "provider", "model", "prompt_tokens", "completion_tokens", "total_tokens", "cost_usd"}}
+	for _, e := range l.Entries(filter) {
+		rows = append(rows, []string{
+			e.Time.UTC().Format(time.RFC3339),
+			e.Agent,
+			e.TaskID,
+			e.Agency,
+			e.Provider,
+			e.Model,
+			strconv.Itoa(e.PromptTokens),
+			strconv.Itoa(e.CompletionTokens),
+			strconv.Itoa(e.TotalTokens),
+			strconv.FormatFloat(e.Cost, 'f', 6, 64),
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to export usage as CSV: %w", err)
+	}
+	return nil
+}
+
+// RankByCost returns the keys of a TotalsBy result ordered by descending cost, then name,
+// which lists the most expensive agents or tasks first
+func RankByCost(groups map[string]UsageTotals) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if groups[keys[i]].Cost != groups[keys[j]].Cost {
+			return groups[keys[i]].Cost > groups[keys[j]].Cost
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
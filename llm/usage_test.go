@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+/**
+ * Norwegian-style doc: Every crate loaded at the quay goes in the harbour ledger with the ship, the skipper and the price, so the bill at the end of the season holds no surprises—these tests check that usage is tagged, priced, summed and exported.
+ */
+
+func usageResponse(model string, prompt, completion int) *ChatCompletionResponse {
+	resp := TextResponse("ok")
+	resp.Model = model
+	resp.Usage = Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	return resp
+}
+
+func TestLedger_RecordsTaggedUsage(t *testing.T) {
+	ledger := NewLedger()
+	provider := Wrap(NewScriptedProvider(
+		ScriptRule{Match: MatchLastMessageContains("big"), Response: usageResponse("gpt-4o", 1000000, 100000)},
+		ScriptRule{Match: MatchLastMessageContains("fail"), Err: ErrServerError},
+		ScriptRule{Response: usageResponse("llama3.1", 50, 10)},
+	), ledger.Middleware())
+
+	ctx := WithRequestTags(context.Background(), map[string]string{TagTaskID: "task-1", TagAgency: "press"})
+	call := func(agent, content string) {
+		provider.ChatCompletion(ctx, ChatCompletionRequest{
+			Messages: []Message{{Role: RoleUser, Content: content}},
+			Extra:    map[string]interface{}{TagAgent: agent},
+		})
+	}
+	call("writer", "big")
+	call("writer", "fail")
+	call("editor", "small")
+
+	entries := ledger.Entries(UsageFilter{})
+	if len(entries) != 2 {
+		t.Fatalf("expected failed calls to be skipped, got %d entries", len(entries))
+	}
+	if entries[0].TaskID != "task-1" || entries[0].Agency != "press" || entries[0].Provider != "scripted" {
+		t.Errorf("expected context tags and provider on entry, got %+v", entries[0])
+	}
+	if math.Abs(entries[0].Cost-3.5) > 1e-9 {
+		t.Errorf("expected gpt-4o cost 3.5, got %f", entries[0].Cost)
+	}
+	if entries[1].Cost != 0 {
+		t.Errorf("expected unpriced local model to cost nothing, got %f", entries[1].Cost)
+	}
+
+	byAgent := ledger.TotalsBy(UsageByAgent, UsageFilter{TaskID: "task-1"})
+	if byAgent["writer"].TotalTokens != 1100000 || byAgent["editor"].Requests != 1 {
+		t.Errorf("unexpected per-agent totals %+v", byAgent)
+	}
+	if ranked := RankByCost(byAgent); ranked[0] != "writer" {
+		t.Errorf("expected writer to be the most expensive, got %v", ranked)
+	}
+	if totals := ledger.Totals(UsageFilter{Agent: "editor"}); totals.PromptTokens != 50 {
+		t.Errorf("unexpected editor totals %+v", totals)
+	}
+}
+
+func TestLedger_Export(t *testing.T) {
+	ledger := NewLedger()
+	ledger.Record(UsageEntry{Agent: "writer", Model: "gpt-4o-mini", PromptTokens: 2000, CompletionTokens: 1000})
+
+	var csvOut bytes.Buffer
+	if err := ledger.WriteCSV(&csvOut, UsageFilter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "time" || rows[1][1] != "writer" || rows[1][8] != "3000" || rows[1][9] != "0.000900" {
+		t.Errorf("unexpected CSV rows %v", rows)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := ledger.WriteJSON(&jsonOut, UsageFilter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var entries []UsageEntry
+	if err := json.Unmarshal(jsonOut.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Model != "gpt-4o-mini" {
+		t.Errorf("unexpected JSON export %s (%v)", jsonOut.String(), err)
+	}
+}
+
+func TestPriceFor_LongestPrefixWins(t *testing.T) {
+	tests := []struct {
+		model string
+		want  ModelPrice
+	}{
+		{"o1-2024-12-17", ModelPrice{15.00, 60.00}},
+		{"o1-mini", ModelPrice{1.10, 4.40}},
+		{"o1-mini-2024-09-12", ModelPrice{1.10, 4.40}},
+		{"gpt-4o-mini-2024-07-18", ModelPrice{0.15, 0.60}},
+	}
+	for _, tc := range tests {
+		price, ok := PriceFor(tc.model)
+		if !ok || price != tc.want {
+			t.Errorf("%s: expected %+v, got %+v (%v)", tc.model, tc.want, price, ok)
+		}
+	}
+}
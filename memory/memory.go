@@ -2,8 +2,9 @@ package memory
 
 import (
 	"context"
-	"time"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Memory defines the memory system for agents
@@ -64,9 +65,11 @@ func New(config Config) Memory {
 	}
 }
 
+// InMemory keeps memories in a bounded slice, it is safe for concurrent use
 type InMemory struct {
 	items    []MemoryItem
 	capacity int
+	mu       sync.RWMutex
 }
 
 func NewInMemory(config Config) *InMemory {
@@ -82,6 +85,8 @@ func NewInMemory(config Config) *InMemory {
 }
 
 func (m *InMemory) Add(ctx context.Context, item MemoryItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if len(m.items) >= m.capacity {
 		// remove the oldest memory
 		m.items = m.items[1:]
@@ -91,6 +96,8 @@ func (m *InMemory) Add(ctx context.Context, item MemoryItem) error {
 }
 
 func (m *InMemory) Get(ctx context.Context, id string) (MemoryItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, item := range m.items {
 		if item.ID == id {
 			return item, nil
@@ -100,6 +107,8 @@ func (m *InMemory) Get(ctx context.Context, id string) (MemoryItem, error) {
 }
 
 func (m *InMemory) Search(ctx context.Context, query string, limit int) ([]MemoryItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	// TODO: implement fuzzy matching, vector search, etc.
 	result := make([]MemoryItem, 0)
 	count := 0
@@ -116,25 +125,32 @@ func (m *InMemory) Search(ctx context.Context, query string, limit int) ([]Memor
 }
 
 func (m *InMemory) GetRecent(ctx context.Context, n int) ([]MemoryItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if n <= 0 || len(m.items) == 0 {
 		return []MemoryItem{}, nil
 	}
 
+	// Copy so callers never share the backing array with later Adds
 	if n >= len(m.items) {
-		return m.items, nil
+		return append([]MemoryItem(nil), m.items...), nil
 	}
 
-	return m.items[len(m.items)-n:], nil
+	return append([]MemoryItem(nil), m.items[len(m.items)-n:]...), nil
 }
 
 func (m *InMemory) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.items = make([]MemoryItem, 0)
 	return nil
 }
 
-	// VectorStore implements a memory system based on vector storage
+// VectorStore implements a memory system based on vector storage, it is safe for concurrent use
 type VectorStore struct {
 	items []MemoryItem
+	mu    sync.RWMutex
 	// TODO: implement vector CLI
 }
 
@@ -146,11 +162,15 @@ func NewVectorStore(config Config) *VectorStore {
 }
 
 func (v *VectorStore) Add(ctx context.Context, item MemoryItem) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.items = append(v.items, item)
 	return nil
 }
 
 func (v *VectorStore) Get(ctx context.Context, id string) (MemoryItem, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 	for _, item := range v.items {
 		if item.ID == id {
 			return item, nil
@@ -160,6 +180,8 @@ func (v *VectorStore) Get(ctx context.Context, id string) (MemoryItem, error) {
 }
 
 func (v *VectorStore) Search(ctx context.Context, query string, limit int) ([]MemoryItem, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 	// TODO: perform vector similarity search
 	result := make([]MemoryItem, 0)
 	count := 0
@@ -176,18 +198,23 @@ func (v *VectorStore) Search(ctx context.Context, query string, limit int) ([]Me
 }
 
 func (v *VectorStore) GetRecent(ctx context.Context, n int) ([]MemoryItem, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	if n <= 0 || len(v.items) == 0 {
 		return []MemoryItem{}, nil
 	}
 
 	if n >= len(v.items) {
-		return v.items, nil
+		return append([]MemoryItem(nil), v.items...), nil
 	}
 
-	return v.items[len(v.items)-n:], nil
+	return append([]MemoryItem(nil), v.items[len(v.items)-n:]...), nil
 }
 
 func (v *VectorStore) Clear(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	v.items = make([]MemoryItem, 0)
 	return nil
 }
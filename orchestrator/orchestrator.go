@@ -3,6 +3,7 @@ package orchestrator
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/voocel/mas/agent"
 	"github.com/voocel/mas/communication"
+	"github.com/voocel/mas/llm"
 )
 
 type Task struct {
@@ -26,6 +28,10 @@ type Task struct {
 	Output      interface{}            `json:"output,omitempty"`
 	Error       string                 `json:"error,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Budget      llm.Budget             `json:"budget"`
+	Usage       llm.UsageTotals        `json:"usage"`
+	// Blocked is set when a guardrail stopped the task
+	Blocked *agent.GuardrailError `json:"blocked,omitempty"`
 }
 
 type TaskStatus string
@@ -49,6 +55,10 @@ type Options struct {
 	Bus          communication.Bus
 	DefaultTTL   time.Duration
 	PollInterval time.Duration
+
+	// Logger receives task lifecycle records, slog.Default() when nil. Task input and
+	// output are never logged.
+	Logger *slog.Logger
 }
 
 // Orchestrator defines an orchestrator for multi-agent systems
@@ -85,6 +95,7 @@ type BasicOrchestrator struct {
 	bus       communication.Bus
 	ttl       time.Duration
 	pollInt   time.Duration
+	logger    *slog.Logger
 	running   bool
 	ctx       context.Context
 	cancelCtx context.CancelFunc
@@ -103,6 +114,11 @@ func NewBasicOrchestrator(opts Options) *BasicOrchestrator {
 		pollInt = opts.PollInterval
 	}
 
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &BasicOrchestrator{
@@ -111,6 +127,7 @@ func NewBasicOrchestrator(opts Options) *BasicOrchestrator {
 		bus:       opts.Bus,
 		ttl:       ttl,
 		pollInt:   pollInt,
+		logger:    logger,
 		running:   false,
 		ctx:       ctx,
 		cancelCtx: cancel,
@@ -160,13 +177,13 @@ func (o *BasicOrchestrator) ListAgents() []agent.Agent {
 
 // SubmitTask submits a task
 func (o *BasicOrchestrator) SubmitTask(ctx context.Context, task Task) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
 	if !o.running {
 		return "", errors.New("orchestrator not running")
 	}
 
-	o.mu.Lock()
-	defer o.mu.Unlock()
-
 	if task.ID == "" {
 		task.ID = uuid.New().String()
 	}
@@ -184,8 +201,9 @@ func (o *BasicOrchestrator) SubmitTask(ctx context.Context, task Task) (string,
 
 	o.tasks[task.ID] = task
 
-	// Start asynchronous task processing
-	go o.processTask(task.ID)
+	// Start asynchronous task processing, a task submitted while another task runs, e.g. by
+	// SendMessageTool, is also charged against the budgets of the submitting task
+	go o.processTask(task.ID, llm.Budgets(ctx))
 
 	return task.ID, nil
 }
@@ -254,7 +272,7 @@ func (o *BasicOrchestrator) Stop() error {
 }
 
 // processTask processes task asynchronously
-func (o *BasicOrchestrator) processTask(taskID string) {
+func (o *BasicOrchestrator) processTask(taskID string, inherited []*llm.BudgetTracker) {
 	o.mu.Lock()
 	task, ok := o.tasks[taskID]
 	if !ok || task.Status != TaskStatusPending {
@@ -273,8 +291,20 @@ func (o *BasicOrchestrator) processTask(taskID string) {
 	ctx, cancel := context.WithTimeout(o.ctx, o.ttl)
 	defer cancel()
 
+	// Tag every LLM request made for this task so usage can be attributed to it
+	agency, _ := task.Metadata[llm.TagAgency].(string)
+	ctx = llm.WithRequestTags(ctx, map[string]string{llm.TagTaskID: task.ID, llm.TagAgency: agency})
+
+	// Charge every LLM call to the task, enforcing its budget and those it inherited
+	budget := llm.NewBudgetTracker("task "+task.ID, task.Budget)
+	ctx = llm.WithBudgets(llm.WithBudgets(ctx, inherited...), budget)
+
+	logger := llm.ContextLogger(ctx, o.logger)
+	logger.InfoContext(ctx, "task started", "task", task.Name, "agents", task.AgentIDs)
+
 	// todo need more complex collaboration logic
-	var result interface{}
+	// The first agent receives the task input, later agents receive their predecessor's output
+	result := task.Input
 	var taskErr error
 
 	// Process with each agent sequentially
@@ -290,6 +320,7 @@ func (o *BasicOrchestrator) processTask(taskID string) {
 
 		result, taskErr = agent.Process(ctx, result)
 		if taskErr != nil {
+			logger.ErrorContext(ctx, "agent failed", llm.LogKeyAgent, agentID, "error", taskErr)
 			break
 		}
 	}
@@ -305,14 +336,26 @@ func (o *BasicOrchestrator) processTask(taskID string) {
 	now = time.Now()
 	task.UpdatedAt = now
 	task.FinishedAt = &now
+	task.Usage = budget.Spent()
 
 	if taskErr != nil {
 		task.Status = TaskStatusFailed
 		task.Error = taskErr.Error()
+
+		var llmErr llm.LLMError
+		if errors.Is(taskErr, llm.ErrBudgetExceeded) && errors.As(taskErr, &llmErr) {
+			task.Error = fmt.Sprintf("%s: %s", llmErr.Message, llmErr.Details)
+		}
+
+		var blocked *agent.GuardrailError
+		if errors.As(taskErr, &blocked) {
+			task.Blocked = blocked
+		}
 	} else {
 		task.Status = TaskStatusCompleted
 		task.Output = result
 	}
+	logger.InfoContext(ctx, "task finished", "status", task.Status, "total_tokens", task.Usage.TotalTokens, "duration", now.Sub(*task.StartedAt))
 
 	o.tasks[taskID] = task
 }
@@ -3,10 +3,13 @@ package orchestrator
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 	"github.com/voocel/mas/agent"
 	"github.com/voocel/mas/knowledge"
+	"github.com/voocel/mas/llm"
 	"github.com/voocel/mas/memory"
 	"github.com/voocel/mas/tools"
 )
@@ -118,22 +121,21 @@ func TestOrchestrator_Concurrency(t *testing.T) {
 	orch.Start()
 	a := &successAgent{}
 	_ = orch.RegisterAgent(a)
-	done := make(chan struct{})
+	var wg sync.WaitGroup
 	n := 10
 	ids := make([]string, n)
 	for i := 0; i < n; i++ {
+		wg.Add(1)
 		go func(idx int) {
+			defer wg.Done()
 			task := Task{AgentIDs: []string{"success"}, Input: idx}
 			id, err := orch.SubmitTask(context.Background(), task)
 			if err == nil {
 				ids[idx] = id
 			}
-			if idx == n-1 {
-				close(done)
-			}
 		}(i)
 	}
-	<-done
+	wg.Wait()
 	// Wait for all tasks to reach a terminal state (completed or failed)
 	for _, id := range ids {
 		if id == "" {
@@ -274,3 +276,123 @@ func (a *blockingAgent) GetMemory() memory.Memory { return nil }
 func (a *blockingAgent) GetKnowledgeGraph() knowledge.Graph { return nil }
 func (a *blockingAgent) GetTools() []tools.Tool { return nil }
 
+
+// waitForTask polls until the task leaves the pending and running states
+func waitForTask(t *testing.T, orch *BasicOrchestrator, id string) Task {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		task, err := orch.GetTask(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if task.Status != TaskStatusPending && task.Status != TaskStatusRunning {
+			return task
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("task %s did not finish", id)
+	return Task{}
+}
+
+func TestTaskBudget_FailsTaskWithReason(t *testing.T) {
+	// The agent keeps calling a tool, each round costing 600 tokens
+	call := llm.ToolCall{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "missing", Arguments: "{}"}}
+	resp := llm.ToolCallResponse(call)
+	resp.Usage = llm.Usage{PromptTokens: 500, CompletionTokens: 100, TotalTokens: 600}
+	provider := llm.NewScriptedProvider(llm.ScriptRule{Response: resp})
+
+	orch := NewBasicOrchestrator(Options{})
+	orch.Start()
+	defer orch.Stop()
+	_ = orch.RegisterAgent(agent.NewLLMAgent(agent.LLMAgentConfig{Name: "looper", Provider: provider, MaxIterations: 10}))
+
+	id, _ := orch.SubmitTask(context.Background(), Task{AgentIDs: []string{"looper"}, Input: "loop", Budget: llm.Budget{MaxTokens: 1000}})
+	task := waitForTask(t, orch, id)
+
+	if task.Status != TaskStatusFailed {
+		t.Fatalf("expected failed status, got %v", task.Status)
+	}
+	if !strings.Contains(task.Error, "budget exceeded") || !strings.Contains(task.Error, "1200 of 1000 tokens") {
+		t.Errorf("expected the budget to be named as the reason, got %q", task.Error)
+	}
+	if task.Usage.TotalTokens != 1200 || len(provider.Requests()) != 2 {
+		t.Errorf("expected two calls before the budget stopped the loop, got %+v after %d calls", task.Usage, len(provider.Requests()))
+	}
+}
+
+func TestTaskBudget_InheritedBySubmittedTasks(t *testing.T) {
+	parent := llm.NewBudgetTracker("conversation", llm.Budget{MaxTokens: 10})
+	parent.Charge(&llm.ChatCompletionResponse{Usage: llm.Usage{TotalTokens: 10}})
+	provider := llm.NewSequenceProvider(llm.TextResponse("unused"))
+
+	orch := NewBasicOrchestrator(Options{})
+	orch.Start()
+	defer orch.Stop()
+	_ = orch.RegisterAgent(agent.NewLLMAgent(agent.LLMAgentConfig{Name: "child", Provider: provider}))
+
+	ctx := llm.WithBudgets(context.Background(), parent)
+	id, _ := orch.SubmitTask(ctx, Task{AgentIDs: []string{"child"}, Input: "hello"})
+	task := waitForTask(t, orch, id)
+
+	if task.Status != TaskStatusFailed || !strings.Contains(task.Error, "conversation spent") {
+		t.Errorf("expected the inherited budget to fail the task, got %v %q", task.Status, task.Error)
+	}
+	if len(provider.Requests()) != 0 {
+		t.Error("expected no LLM call once the inherited budget was spent")
+	}
+}
+
+func TestOrchestrator_ParallelTasksOnOneLLMAgent(t *testing.T) {
+	const tasks = 24
+	rules := make([]llm.ScriptRule, tasks)
+	for i := range rules {
+		rules[i] = llm.ScriptRule{
+			Match:    llm.MatchLastMessageContains(fmt.Sprintf("Input: task-%d\n", i)),
+			Response: llm.TextResponse(fmt.Sprintf("handled task-%d", i)),
+		}
+	}
+
+	orch := NewBasicOrchestrator(Options{})
+	orch.Start()
+	defer orch.Stop()
+	_ = orch.RegisterAgent(agent.NewLLMAgent(agent.LLMAgentConfig{Name: "shared", Provider: llm.NewScriptedProvider(rules...)}))
+
+	ids := make([]string, tasks)
+	for i := range ids {
+		id, err := orch.SubmitTask(context.Background(), Task{AgentIDs: []string{"shared"}, Input: fmt.Sprintf("task-%d", i)})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids[i] = id
+	}
+	for i, id := range ids {
+		task := waitForTask(t, orch, id)
+		if want := fmt.Sprintf("handled task-%d", i); task.Status != TaskStatusCompleted || task.Output != want {
+			t.Errorf("task %d: expected %q, got %v %v %q", i, want, task.Status, task.Output, task.Error)
+		}
+	}
+}
+
+func TestOrchestrator_RecordsGuardrailBlock(t *testing.T) {
+	orch := NewBasicOrchestrator(Options{})
+	orch.Start()
+	defer orch.Stop()
+	_ = orch.RegisterAgent(agent.NewLLMAgent(agent.LLMAgentConfig{
+		Name:            "guarded",
+		Provider:        llm.NewScriptedProvider(llm.ScriptRule{Response: llm.TextResponse("never sent")}),
+		InputGuardrails: []agent.Guardrail{agent.NewMaxLengthGuardrail(5, false)},
+	}))
+
+	id, err := orch.SubmitTask(context.Background(), Task{AgentIDs: []string{"guarded"}, Input: "far too long"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	task := waitForTask(t, orch, id)
+	if task.Status != TaskStatusFailed || task.Blocked == nil {
+		t.Fatalf("expected a blocked task, got %v %+v", task.Status, task.Blocked)
+	}
+	if task.Blocked.Guardrail != "max_length" || task.Blocked.Stage != agent.GuardrailStageInput {
+		t.Errorf("unexpected block: %+v", task.Blocked)
+	}
+}
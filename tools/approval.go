@@ -0,0 +1,43 @@
+package tools
+
+import "strings"
+
+// ApprovalRequirer is implemented by tools that must be approved by a person before
+// some or all of their calls run
+type ApprovalRequirer interface {
+	// RequiresApproval reports whether a call with params needs approval
+	RequiresApproval(params map[string]interface{}) bool
+}
+
+// NeedsApproval reports whether a call of tool with params needs approval
+func NeedsApproval(tool Tool, params map[string]interface{}) bool {
+	requirer, ok := tool.(ApprovalRequirer)
+	return ok && requirer.RequiresApproval(params)
+}
+
+// approvalTool marks a wrapped tool as requiring approval
+type approvalTool struct {
+	Tool
+	when func(params map[string]interface{}) bool
+}
+
+// RequireApproval marks tool as requiring approval for the calls when matches, or for
+// every call when it is nil
+func RequireApproval(tool Tool, when func(params map[string]interface{}) bool) Tool {
+	return &approvalTool{Tool: tool, when: when}
+}
+
+func (t *approvalTool) RequiresApproval(params map[string]interface{}) bool {
+	return t.when == nil || t.when(params)
+}
+
+// IsMutatingHTTPRequest matches http tool calls that may change state on the server,
+// every method other than GET and HEAD
+func IsMutatingHTTPRequest(params map[string]interface{}) bool {
+	method, _ := params["method"].(string)
+	switch strings.ToUpper(method) {
+	case "", "GET", "HEAD":
+		return false
+	}
+	return true
+}
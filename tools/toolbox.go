@@ -3,21 +3,36 @@ package tools
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
+
+	"github.com/voocel/mas/llm"
 )
 
 // Toolbox manages a collection of tools available to agents
 type Toolbox struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools  map[string]Tool
+	logger *slog.Logger
+	mu     sync.RWMutex
 }
 
 // NewToolbox creates a new toolbox
 func NewToolbox() *Toolbox {
 	return &Toolbox{
-		tools: make(map[string]Tool),
+		tools:  make(map[string]Tool),
+		logger: slog.Default(),
+	}
+}
+
+// SetLogger replaces the logger used by Execute, nil restores slog.Default(). Tool
+// parameters and results are redacted, see llm.RevealContent.
+func (tb *Toolbox) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.Default()
 	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.logger = logger
 }
 
 // Add adds a tool to the toolbox
@@ -39,7 +54,7 @@ func (tb *Toolbox) Get(name string) (Tool, bool) {
 func (tb *Toolbox) List() []Tool {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
-	
+
 	result := make([]Tool, 0, len(tb.tools))
 	for _, tool := range tb.tools {
 		result = append(result, tool)
@@ -51,7 +66,7 @@ func (tb *Toolbox) List() []Tool {
 func (tb *Toolbox) Names() []string {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
-	
+
 	names := make([]string, 0, len(tb.tools))
 	for name := range tb.tools {
 		names = append(names, name)
@@ -61,23 +76,26 @@ func (tb *Toolbox) Names() []string {
 
 // Execute executes a tool with the specified name
 func (tb *Toolbox) Execute(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
+	tb.mu.RLock()
+	logger := llm.ContextLogger(ctx, tb.logger).With(llm.LogKeyTool, toolName)
+	tb.mu.RUnlock()
+
 	tool, ok := tb.Get(toolName)
 	if !ok {
-		log.Printf("Tool not found in toolbox: %s", toolName)
+		logger.WarnContext(ctx, "tool not found in toolbox")
 		return nil, fmt.Errorf("%w: %s", ErrToolNotFound, toolName)
 	}
-	
-	log.Printf("Toolbox executing tool: %s, params: %+v", toolName, params)
-	
+
+	logger.LogAttrs(ctx, slog.LevelInfo, "executing tool", llm.Redact("params", params))
+
 	result, err := tool.Execute(ctx, params)
-	
 	if err != nil {
-		log.Printf("Toolbox failed to execute tool [%s]: %v", toolName, err)
+		logger.ErrorContext(ctx, "tool failed", "error", err)
 		return nil, err
 	}
-	
-	log.Printf("Toolbox successfully executed tool [%s]: %v", toolName, result)
-	
+
+	logger.LogAttrs(ctx, slog.LevelDebug, "tool succeeded", llm.Redact("result", result))
+
 	return result, nil
 }
 
@@ -102,4 +120,4 @@ func WithTools(tools ...Tool) *Toolbox {
 		tb.Add(tool)
 	}
 	return tb
-} 
\ No newline at end of file
+}
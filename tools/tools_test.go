@@ -1,8 +1,11 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
@@ -79,3 +82,38 @@ func TestConvertToolsToFunctions(t *testing.T) {
 		t.Errorf("expected type 'function', got %v", funcs[0]["type"])
 	}
 }
+
+func TestToolbox_ExecuteLogsWithoutParams(t *testing.T) {
+	var buf bytes.Buffer
+	tb := WithTools(NewTool("lookup", "desc", json.RawMessage(`{"type":"object"}`), func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "account 4242", nil
+	}))
+	tb.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if _, err := tb.Execute(context.Background(), "lookup", map[string]interface{}{"token": "sk-secret"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "tool=lookup") {
+		t.Errorf("expected the tool name in the log, got %q", out)
+	}
+	if strings.Contains(out, "sk-secret") || strings.Contains(out, "4242") {
+		t.Errorf("log leaked tool params or result: %q", out)
+	}
+}
+
+func TestRequireApproval(t *testing.T) {
+	http := RequireApproval(NewHTTPTool(), IsMutatingHTTPRequest)
+	if http.Name() != "http" {
+		t.Errorf("expected the wrapped tool's name, got %s", http.Name())
+	}
+	if NeedsApproval(http, map[string]interface{}{"url": "http://internal"}) {
+		t.Errorf("expected GET requests to run without approval")
+	}
+	if !NeedsApproval(http, map[string]interface{}{"url": "http://internal", "method": "delete"}) {
+		t.Errorf("expected DELETE requests to need approval")
+	}
+	if NeedsApproval(NewHTTPTool(), map[string]interface{}{"method": "POST"}) {
+		t.Errorf("expected unmarked tools to run without approval")
+	}
+}